@@ -0,0 +1,1056 @@
+// Package codegen generates C# source code from the semantic UAST.
+//
+// Generator expects nodes of the same shape as produced by the semantic mode of the driver,
+// but the nodes are not required to come from C# code. For example, a uast:FunctionGroup
+// extracted from the UAST of a different language can be printed as a C# method stub.
+//
+// Only a subset of nodes is supported: uast:FunctionGroup, uast:Import, uast:Block, uast:Group,
+// uast:Comment, uast:Identifier, uast:QualifiedIdentifier, uast:String, uast:Bool and some
+// statements and expressions of the driver, such as ReturnStatement. Declarations of functions
+// can also use the attributes, type parameters, documentation comments and type expressions of
+// the driver. Other nodes are reported as an error, instead of generating code that cannot be
+// compiled.
+package codegen
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+)
+
+// indent is a string used for a single level of indentation.
+const indent = "    "
+
+// Fprint writes the C# code for the semantic UAST node to w.
+//
+// The node can be either one of the supported nodes, or an array of them. Each top-level
+// node is written on a separate line, and imports are separated from other declarations
+// with an empty line.
+func Fprint(w io.Writer, n nodes.Node) error {
+	g := &generator{}
+	if err := g.topLevel(n); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, g.buf.String())
+	return err
+}
+
+// Sprint returns the C# code for the semantic UAST node.
+func Sprint(n nodes.Node) (string, error) {
+	var buf strings.Builder
+	if err := Fprint(&buf, n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// typeOf returns the type of the node without the namespace of the driver.
+//
+// Nodes returned by the driver have the "csharp:" prefix, while the nodes produced by
+// the normalizer directly don't have it.
+func typeOf(n nodes.Node) string {
+	return strings.TrimPrefix(uast.TypeOf(n), "csharp:")
+}
+
+// generator writes the code with the current indentation level.
+type generator struct {
+	buf   strings.Builder
+	depth int
+}
+
+// line starts a new line with the current indentation.
+func (g *generator) line() {
+	for i := 0; i < g.depth; i++ {
+		g.buf.WriteString(indent)
+	}
+}
+
+func (g *generator) topLevel(n nodes.Node) error {
+	arr, ok := n.(nodes.Array)
+	if !ok {
+		arr = nodes.Array{n}
+	}
+	prev := ""
+	for i, sub := range arr {
+		typ := typeOf(sub)
+		if i > 0 && (typ != prev || typ != uast.TypeOf(uast.Import{})) {
+			g.buf.WriteString("\n")
+		}
+		if err := g.declaration(sub); err != nil {
+			return err
+		}
+		prev = typ
+	}
+	return nil
+}
+
+// declaration writes a top-level node or a statement of a block, including the trailing newline.
+func (g *generator) declaration(n nodes.Node) error {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return fmt.Errorf("expected an object, got: %T", n)
+	}
+	switch typeOf(obj) {
+	case uast.TypeOf(uast.Import{}):
+		return g.importDecl(obj)
+	case uast.TypeOf(uast.FunctionGroup{}):
+		return g.funcGroup(obj)
+	case uast.TypeOf(uast.Block{}):
+		g.line()
+		if err := g.block(obj); err != nil {
+			return err
+		}
+		g.buf.WriteString("\n")
+		return nil
+	case uast.TypeOf(uast.Group{}):
+		arr, _ := obj["Nodes"].(nodes.Array)
+		for _, sub := range arr {
+			if err := g.declaration(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	case uast.TypeOf(uast.Comment{}), "DocumentationComment":
+		g.comment(obj)
+		return nil
+	case "ReturnStatement":
+		return g.returnStmt(obj)
+	}
+	return fmt.Errorf("unsupported node: %s", uast.TypeOf(obj))
+}
+
+// lineEndings replaces all line endings with \n.
+var lineEndings = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// comment writes uast:Comment or the DocumentationComment node of the driver, including
+// the trailing newline. Block comments are written as line comments, since the text of
+// the comment may contain the end of the block.
+func (g *generator) comment(obj nodes.Object) {
+	prefix := "//"
+	if typeOf(obj) == "DocumentationComment" {
+		obj, _ = obj["Comment"].(nodes.Object)
+		prefix = "///"
+	}
+	text, _ := obj["Text"].(nodes.String)
+	for _, line := range strings.Split(lineEndings.Replace(string(text)), "\n") {
+		g.line()
+		if line == "" {
+			g.buf.WriteString(prefix + "\n")
+		} else {
+			g.buf.WriteString(prefix + " " + line + "\n")
+		}
+	}
+}
+
+// importDecl writes a using directive for uast:Import.
+//
+// Imports of the uast:String path are written as #r and #load directives of C# scripts,
+// depending on the Target of the import.
+func (g *generator) importDecl(obj nodes.Object) error {
+	target, _ := obj["Target"].(nodes.Object)
+	if path, ok := obj["Path"].(nodes.Object); ok && typeOf(path) == uast.TypeOf(uast.String{}) {
+		dir := "load"
+		if target["reference"] == nodes.Bool(true) {
+			dir = "r"
+		}
+		val, _ := path["Value"].(nodes.String)
+		g.line()
+		g.buf.WriteString("#" + dir + " " + quote(string(val)) + "\n")
+		return nil
+	}
+	if all, _ := obj["All"].(nodes.Bool); !all {
+		return fmt.Errorf("only imports of all symbols are supported")
+	}
+	var (
+		path  = obj["Path"]
+		using = "using "
+	)
+	if alias, ok := path.(nodes.Object); ok && typeOf(alias) == uast.TypeOf(uast.Alias{}) {
+		if target["static"] == nodes.Bool(true) {
+			return fmt.Errorf("static imports cannot have an alias")
+		}
+		name, err := identifier(alias["Name"])
+		if err != nil {
+			return err
+		}
+		using += name + " = "
+		path = alias["Node"]
+	} else if target["static"] == nodes.Bool(true) {
+		using += "static "
+	}
+	name, err := qualifiedName(path)
+	if err != nil {
+		return err
+	}
+	g.line()
+	g.buf.WriteString(using + name + ";\n")
+	return nil
+}
+
+// Names of the functions generated by the normalizer for C# declarations that have no name.
+const (
+	// entryPointName is the name of the implicit entry point of a program with top-level statements.
+	entryPointName = "<Main>$"
+	// indexerName is the name of the function of an indexer.
+	indexerName = "this[]"
+)
+
+// funcDecl is a uast:FunctionGroup split into parts.
+type funcDecl struct {
+	comments []nodes.Object
+	attrs    nodes.Array
+	mods     []string
+	name     string
+	fnc      nodes.Object
+}
+
+// splitGroup splits uast:FunctionGroup into comments, attributes, modifiers and a function.
+//
+// The group may contain comments, an array of modifier keywords and must contain a uast:Alias
+// with a uast:Function. Attributes are taken from the Attributes field of the group, as well as
+// from the modifiers array.
+func splitGroup(obj nodes.Object) (*funcDecl, error) {
+	d := &funcDecl{}
+	if attrs, ok := obj["Attributes"].(nodes.Array); ok {
+		d.attrs = append(d.attrs, attrs...)
+	}
+	arr, _ := obj["Nodes"].(nodes.Array)
+	var alias nodes.Object
+	for _, sub := range arr {
+		switch sub := sub.(type) {
+		case nil:
+		case nodes.Array:
+			for _, m := range sub {
+				if typeOf(m) == "Attribute" {
+					d.attrs = append(d.attrs, m)
+					continue
+				}
+				kw, err := keyword(m)
+				if err != nil {
+					return nil, err
+				}
+				d.mods = append(d.mods, kw)
+			}
+		case nodes.Object:
+			switch typeOf(sub) {
+			case uast.TypeOf(uast.Comment{}), "DocumentationComment":
+				d.comments = append(d.comments, sub)
+			case uast.TypeOf(uast.Alias{}):
+				if alias != nil {
+					return nil, fmt.Errorf("function group has multiple aliases")
+				}
+				alias = sub
+			case uast.TypeOf(uast.Function{}):
+				return nil, fmt.Errorf("anonymous functions are not supported")
+			default:
+				return nil, fmt.Errorf("unsupported node in function group: %s", uast.TypeOf(sub))
+			}
+		default:
+			return nil, fmt.Errorf("unexpected node in function group: %T", sub)
+		}
+	}
+	if alias == nil {
+		return nil, fmt.Errorf("function group has no alias")
+	}
+	id, ok := alias["Name"].(nodes.Object)
+	if !ok || typeOf(id) != uast.TypeOf(uast.Identifier{}) {
+		return nil, fmt.Errorf("expected an identifier, got: %s", uast.TypeOf(alias["Name"]))
+	}
+	name, _ := id["Name"].(nodes.String)
+	d.name = string(name)
+	d.fnc, ok = alias["Node"].(nodes.Object)
+	if !ok || typeOf(d.fnc) != uast.TypeOf(uast.Function{}) {
+		return nil, fmt.Errorf("expected a function, got: %s", uast.TypeOf(alias["Node"]))
+	}
+	return d, nil
+}
+
+// header writes comments, attributes and modifiers of the function group. Modifiers are
+// written on a new line and are followed by a space.
+func (g *generator) header(d *funcDecl) error {
+	for _, c := range d.comments {
+		g.comment(c)
+	}
+	for _, a := range d.attrs {
+		s, err := attributeList(nodes.Array{a})
+		if err != nil {
+			return err
+		}
+		g.line()
+		g.buf.WriteString(s + "\n")
+	}
+	g.line()
+	for _, m := range d.mods {
+		g.buf.WriteString(m + " ")
+	}
+	return nil
+}
+
+// funcGroup writes a method declaration for uast:FunctionGroup, see splitGroup.
+//
+// A function without a body is written as a declaration that ends with a semicolon. A body
+// with a single ReturnStatement without the return keyword (see arrowBlock in the normalizer)
+// is written as an arrow expression. Functions without return values are written as void
+// methods, including constructors, since they have no return type in the semantic UAST.
+// Destructors are named with a "~" prefix by the normalizer and are written as is.
+//
+// The implicit entry point of a program is written as top-level statements, and the function
+// of an indexer is written as an indexer with its accessors.
+func (g *generator) funcGroup(obj nodes.Object) error {
+	d, err := splitGroup(obj)
+	if err != nil {
+		return err
+	}
+	if d.name == entryPointName {
+		return g.entryPoint(d)
+	}
+	ftype, ok := d.fnc["Type"].(nodes.Object)
+	if !ok {
+		return fmt.Errorf("function %s has no type", d.name)
+	}
+	indexer := d.name == indexerName
+	destructor := strings.HasPrefix(d.name, "~")
+	name := "this"
+	if !indexer {
+		if name, err = escapeName(strings.TrimPrefix(d.name, "~")); err != nil {
+			return err
+		}
+	}
+	if destructor {
+		name = "~" + name
+	}
+	if iface, ok := obj["ExplicitInterface"].(nodes.Object); ok {
+		typ, err := typeName(iface["Name"])
+		if err != nil {
+			return err
+		}
+		name = typ + "." + name
+	}
+	params, where, err := typeParams(obj["TypeParameters"])
+	if err != nil {
+		return err
+	}
+	args, err := arguments(ftype["Arguments"])
+	if err != nil {
+		return err
+	}
+	ret, err := returnType(ftype["Returns"])
+	if err != nil {
+		return err
+	}
+	sig := ret + " " + name + params + "(" + args + ")" + where
+	if indexer {
+		sig = ret + " " + name + "[" + args + "]"
+	} else if destructor {
+		sig = name + "()"
+	}
+	if err := g.header(d); err != nil {
+		return err
+	}
+	g.buf.WriteString(sig)
+	if indexer {
+		return g.accessors(d.fnc["Body"])
+	}
+	return g.funcBody(d.fnc["Body"])
+}
+
+// funcBody writes the body of a function after its signature, including the trailing newline.
+func (g *generator) funcBody(n nodes.Node) error {
+	body, ok := n.(nodes.Object)
+	if !ok {
+		if n != nil {
+			return fmt.Errorf("expected a block, got: %T", n)
+		}
+		g.buf.WriteString(";\n")
+		return nil
+	}
+	if expr := arrowExpr(body); expr != nil {
+		s, err := expression(expr)
+		if err != nil {
+			return err
+		}
+		g.buf.WriteString(" => " + s + ";\n")
+		return nil
+	}
+	g.buf.WriteString("\n")
+	g.line()
+	if err := g.block(body); err != nil {
+		return err
+	}
+	g.buf.WriteString("\n")
+	return nil
+}
+
+// entryPoint writes the statements of the implicit entry point of a program as top-level statements.
+func (g *generator) entryPoint(d *funcDecl) error {
+	body, ok := d.fnc["Body"].(nodes.Object)
+	if !ok || typeOf(body) != uast.TypeOf(uast.Block{}) {
+		return fmt.Errorf("expected a block, got: %s", uast.TypeOf(d.fnc["Body"]))
+	}
+	for _, c := range d.comments {
+		g.comment(c)
+	}
+	stmts, _ := body["Statements"].(nodes.Array)
+	for _, st := range stmts {
+		if err := g.declaration(st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accessors writes the accessors of an indexer in braces, each on a separate line.
+//
+// Accessors without a body are the AccessorDeclaration nodes of the driver, and other accessors
+// are function groups named after the CLR name of the accessor, for example get_Item.
+func (g *generator) accessors(n nodes.Node) error {
+	body, ok := n.(nodes.Object)
+	if !ok || typeOf(body) != uast.TypeOf(uast.Block{}) {
+		return fmt.Errorf("expected accessors of an indexer, got: %s", uast.TypeOf(n))
+	}
+	stmts, _ := body["Statements"].(nodes.Array)
+	g.buf.WriteString("\n")
+	g.line()
+	g.buf.WriteString("{\n")
+	g.depth++
+	for _, st := range stmts {
+		obj, ok := st.(nodes.Object)
+		if !ok {
+			return fmt.Errorf("expected an accessor, got: %T", st)
+		}
+		switch typeOf(obj) {
+		case "AccessorDeclaration":
+			kind, ok := obj["Kind"].(nodes.String)
+			if !ok || kind == "" {
+				return fmt.Errorf("accessor has no kind")
+			}
+			d := &funcDecl{}
+			d.attrs, _ = obj["Attributes"].(nodes.Array)
+			mods, _ := obj["Modifiers"].(nodes.Array)
+			for _, m := range mods {
+				kw, err := keyword(m)
+				if err != nil {
+					return err
+				}
+				d.mods = append(d.mods, kw)
+			}
+			if err := g.header(d); err != nil {
+				return err
+			}
+			g.buf.WriteString(string(kind) + ";\n")
+		case uast.TypeOf(uast.FunctionGroup{}):
+			d, err := splitGroup(obj)
+			if err != nil {
+				return err
+			}
+			i := strings.Index(d.name, "_")
+			if i <= 0 {
+				return fmt.Errorf("unexpected name of an accessor: %q", d.name)
+			}
+			if err := g.header(d); err != nil {
+				return err
+			}
+			g.buf.WriteString(d.name[:i])
+			if err := g.funcBody(d.fnc["Body"]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported accessor: %s", uast.TypeOf(obj))
+		}
+	}
+	g.depth--
+	g.line()
+	g.buf.WriteString("}\n")
+	return nil
+}
+
+// arrowExpr returns the expression of the body that was defined with an arrow expression,
+// or nil if the body is a regular block.
+func arrowExpr(body nodes.Object) nodes.Node {
+	stmts, _ := body["Statements"].(nodes.Array)
+	if len(stmts) != 1 {
+		return nil
+	}
+	ret, ok := stmts[0].(nodes.Object)
+	if !ok || typeOf(ret) != "ReturnStatement" {
+		return nil
+	}
+	if _, ok := ret["ReturnKeyword"]; ok {
+		return nil
+	}
+	return ret["Expression"]
+}
+
+// block writes uast:Block in braces, each on a separate line. It assumes that the
+// indentation is already written, and doesn't write the trailing newline.
+func (g *generator) block(obj nodes.Object) error {
+	if typeOf(obj) != uast.TypeOf(uast.Block{}) {
+		return fmt.Errorf("expected a block, got: %s", uast.TypeOf(obj))
+	}
+	stmts, ok := obj["Statements"].(nodes.Array)
+	if !ok && obj["Statements"] != nil {
+		return fmt.Errorf("expected an array of statements, got: %T", obj["Statements"])
+	}
+	g.buf.WriteString("{\n")
+	g.depth++
+	for _, st := range stmts {
+		if err := g.declaration(st); err != nil {
+			return err
+		}
+	}
+	g.depth--
+	g.line()
+	g.buf.WriteString("}")
+	return nil
+}
+
+// returnStmt writes the ReturnStatement node of the driver.
+func (g *generator) returnStmt(obj nodes.Object) error {
+	g.line()
+	if obj["Expression"] == nil {
+		g.buf.WriteString("return;\n")
+		return nil
+	}
+	expr, err := expression(obj["Expression"])
+	if err != nil {
+		return err
+	}
+	g.buf.WriteString("return " + expr + ";\n")
+	return nil
+}
+
+// expression returns the code for an expression node.
+func expression(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return "", fmt.Errorf("expected an expression, got: %T", n)
+	}
+	switch typeOf(obj) {
+	case uast.TypeOf(uast.Identifier{}), uast.TypeOf(uast.QualifiedIdentifier{}):
+		return qualifiedName(obj)
+	case uast.TypeOf(uast.String{}):
+		val, ok := obj["Value"].(nodes.String)
+		if !ok {
+			return "", fmt.Errorf("expected a string value, got: %T", obj["Value"])
+		}
+		return quote(string(val)), nil
+	case uast.TypeOf(uast.Bool{}):
+		val, ok := obj["Value"].(nodes.Bool)
+		if !ok {
+			return "", fmt.Errorf("expected a bool value, got: %T", obj["Value"])
+		}
+		if val {
+			return "true", nil
+		}
+		return "false", nil
+	case "NullLiteralExpression":
+		return "null", nil
+	case "DefaultLiteralExpression":
+		return "default", nil
+	case "NumericLiteralExpression":
+		tok, _ := obj["Token"].(nodes.Object)
+		val, ok := tok[uast.KeyToken].(nodes.String)
+		if !ok || val == "" {
+			return "", fmt.Errorf("numeric literal has no value")
+		}
+		return string(val), nil
+	case "SimpleMemberAccessExpression":
+		x, err := expression(obj["Expression"])
+		if err != nil {
+			return "", err
+		}
+		name, err := identifier(obj["Name"])
+		if err != nil {
+			return "", err
+		}
+		return x + "." + name, nil
+	}
+	return "", fmt.Errorf("unsupported expression: %s", uast.TypeOf(obj))
+}
+
+// attributeList returns the code for an array of the Attribute nodes of the driver, in brackets.
+func attributeList(arr nodes.Array) (string, error) {
+	list := make([]string, 0, len(arr))
+	for _, a := range arr {
+		s, err := attribute(a)
+		if err != nil {
+			return "", err
+		}
+		list = append(list, s)
+	}
+	return "[" + strings.Join(list, ", ") + "]", nil
+}
+
+// attribute returns the code for the Attribute node of the driver, without brackets.
+func attribute(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || typeOf(obj) != "Attribute" {
+		return "", fmt.Errorf("expected an attribute, got: %s", uast.TypeOf(n))
+	}
+	name, err := typeName(obj["Name"])
+	if err != nil {
+		return "", err
+	}
+	if target, ok := obj["Target"].(nodes.String); ok && target != "" {
+		name = string(target) + ": " + name
+	}
+	args, _ := obj["Arguments"].(nodes.Array)
+	if len(args) == 0 {
+		return name, nil
+	}
+	list := make([]string, 0, len(args))
+	for _, a := range args {
+		arg, ok := a.(nodes.Object)
+		if !ok || typeOf(arg) != "AttributeArgument" {
+			return "", fmt.Errorf("expected an attribute argument, got: %s", uast.TypeOf(a))
+		}
+		val, err := expression(arg["Value"])
+		if err != nil {
+			return "", err
+		}
+		if arg["Name"] != nil {
+			id, err := identifier(arg["Name"])
+			if err != nil {
+				return "", err
+			}
+			if arg["Property"] == nodes.Bool(true) {
+				val = id + " = " + val
+			} else {
+				val = id + ": " + val
+			}
+		}
+		list = append(list, val)
+	}
+	return name + "(" + strings.Join(list, ", ") + ")", nil
+}
+
+// typeParams returns the code for an array of the GenericParameter nodes of the driver:
+// a list of type parameters in angle brackets and constraint clauses that start with a space.
+func typeParams(n nodes.Node) (string, string, error) {
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return "", "", fmt.Errorf("expected an array of type parameters, got: %T", n)
+	}
+	if len(arr) == 0 {
+		return "", "", nil
+	}
+	var (
+		params = make([]string, 0, len(arr))
+		where  strings.Builder
+	)
+	for _, p := range arr {
+		obj, ok := p.(nodes.Object)
+		if ok && typeOf(obj) == "TypeParameterConstraintClause" {
+			// constraint clause for an undeclared type parameter
+			name, err := identifier(obj["Name"])
+			if err != nil {
+				return "", "", err
+			}
+			if err := writeWhere(&where, name, obj["Constraints"]); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+		if !ok || typeOf(obj) != "GenericParameter" {
+			return "", "", fmt.Errorf("expected a type parameter, got: %s", uast.TypeOf(p))
+		}
+		name, err := identifier(obj["Name"])
+		if err != nil {
+			return "", "", err
+		}
+		param := name
+		if v, _ := obj["Variance"].(nodes.String); v != "" {
+			param = string(v) + " " + param
+		}
+		if attrs, _ := obj["Attributes"].(nodes.Array); len(attrs) != 0 {
+			s, err := attributeList(attrs)
+			if err != nil {
+				return "", "", err
+			}
+			param = s + " " + param
+		}
+		params = append(params, param)
+		if err := writeWhere(&where, name, obj["Constraints"]); err != nil {
+			return "", "", err
+		}
+	}
+	if len(params) == 0 {
+		return "", where.String(), nil
+	}
+	return "<" + strings.Join(params, ", ") + ">", where.String(), nil
+}
+
+// writeWhere writes a constraint clause for the type parameter, if there are any constraints.
+func writeWhere(w *strings.Builder, name string, n nodes.Node) error {
+	cons, _ := n.(nodes.Array)
+	if len(cons) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(cons))
+	for _, c := range cons {
+		s, err := constraint(c)
+		if err != nil {
+			return err
+		}
+		list = append(list, s)
+	}
+	w.WriteString(" where " + name + " : " + strings.Join(list, ", "))
+	return nil
+}
+
+// constraint returns the code for the GenericConstraint node of the driver.
+func constraint(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || typeOf(obj) != "GenericConstraint" {
+		return "", fmt.Errorf("expected a constraint, got: %s", uast.TypeOf(n))
+	}
+	kind, _ := obj["Kind"].(nodes.String)
+	switch kind {
+	case "class", "struct":
+		if obj["Nullable"] == nodes.Bool(true) {
+			return string(kind) + "?", nil
+		}
+		return string(kind), nil
+	case "unmanaged", "default", "allows ref struct":
+		return string(kind), nil
+	case "new":
+		return "new()", nil
+	case "type":
+		return typeName(obj["Type"])
+	}
+	return "", fmt.Errorf("unsupported constraint: %q", kind)
+}
+
+// returnType returns the code for the return type of a function. No return values are
+// written as void, and multiple return values are written as a tuple.
+func returnType(n nodes.Node) (string, error) {
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return "", fmt.Errorf("expected an array of return values, got: %T", n)
+	}
+	switch len(arr) {
+	case 0:
+		return "void", nil
+	case 1:
+		obj, ok := arr[0].(nodes.Object)
+		if !ok {
+			return "", fmt.Errorf("expected an argument, got: %T", arr[0])
+		}
+		return typeName(obj["Type"])
+	}
+	elems := make([]string, 0, len(arr))
+	for _, a := range arr {
+		obj, ok := a.(nodes.Object)
+		if !ok {
+			return "", fmt.Errorf("expected an argument, got: %T", a)
+		}
+		typ, err := typeName(obj["Type"])
+		if err != nil {
+			return "", err
+		}
+		if obj["Name"] != nil {
+			name, err := identifier(obj["Name"])
+			if err != nil {
+				return "", err
+			}
+			typ += " " + name
+		}
+		elems = append(elems, typ)
+	}
+	return "(" + strings.Join(elems, ", ") + ")", nil
+}
+
+// arguments returns the code for the parameter list of a function, without parentheses.
+func arguments(n nodes.Node) (string, error) {
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return "", fmt.Errorf("expected an array of arguments, got: %T", n)
+	}
+	out := make([]string, 0, len(arr))
+	for i, a := range arr {
+		obj, ok := a.(nodes.Object)
+		if !ok || typeOf(obj) != uast.TypeOf(uast.Argument{}) {
+			return "", fmt.Errorf("expected an argument, got: %s", uast.TypeOf(a))
+		}
+		var buf strings.Builder
+		if attrs, _ := obj["Attributes"].(nodes.Array); len(attrs) != 0 {
+			s, err := attributeList(attrs)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(s + " ")
+		}
+		if obj["Receiver"] == nodes.Bool(true) {
+			buf.WriteString("this ")
+		}
+		if obj["Variadic"] == nodes.Bool(true) {
+			buf.WriteString("params ")
+		}
+		typ, err := typeName(obj["Type"])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(typ + " ")
+		if obj["Name"] != nil {
+			name, err := identifier(obj["Name"])
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(name)
+		} else {
+			// unnamed arguments are not allowed in C#
+			fmt.Fprintf(&buf, "arg%d", i)
+		}
+		if obj["Init"] != nil {
+			init, err := expression(obj["Init"])
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(" = " + init)
+		}
+		out = append(out, buf.String())
+	}
+	return strings.Join(out, ", "), nil
+}
+
+// typeName returns the code for a type expression.
+//
+// Arguments extracted from languages without static typing have no type, in this case
+// the type is written as object.
+func typeName(n nodes.Node) (string, error) {
+	if n == nil {
+		return "object", nil
+	}
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return "", fmt.Errorf("expected a type, got: %T", n)
+	}
+	switch typeOf(obj) {
+	case "PredefinedType":
+		return keyword(obj["Keyword"])
+	case "ByRefType":
+		kind, ok := obj["Kind"].(nodes.String)
+		if !ok {
+			return "", fmt.Errorf("expected a kind of reference, got: %T", obj["Kind"])
+		}
+		typ, err := typeName(obj["Type"])
+		if err != nil {
+			return "", err
+		}
+		return string(kind) + " " + typ, nil
+	case "RefType":
+		typ, err := typeName(obj["Type"])
+		if err != nil {
+			return "", err
+		}
+		if typeOf(obj["ReadOnlyKeyword"]) == "ReadOnlyKeyword" {
+			return "ref readonly " + typ, nil
+		}
+		return "ref " + typ, nil
+	case "ArrayType":
+		typ, err := typeName(obj["ElementType"])
+		if err != nil {
+			return "", err
+		}
+		ranks, _ := obj["RankSpecifiers"].(nodes.Array)
+		for _, r := range ranks {
+			rank, _ := r.(nodes.Object)
+			sizes, _ := rank["Sizes"].(nodes.Array)
+			if len(sizes) == 0 {
+				return "", fmt.Errorf("array rank has no sizes")
+			}
+			typ += "[" + strings.Repeat(",", len(sizes)-1) + "]"
+		}
+		return typ, nil
+	case "NullableType", "PointerType":
+		typ, err := typeName(obj["ElementType"])
+		if err != nil {
+			return "", err
+		}
+		if typeOf(obj) == "PointerType" {
+			return typ + "*", nil
+		}
+		return typ + "?", nil
+	case "TupleType":
+		elems, _ := obj["Elements"].(nodes.Array)
+		list := make([]string, 0, len(elems))
+		for _, e := range elems {
+			elem, _ := e.(nodes.Object)
+			typ, err := typeName(elem["Type"])
+			if err != nil {
+				return "", err
+			}
+			if typeOf(elem["Identifier"]) == uast.TypeOf(uast.Identifier{}) {
+				name, err := identifier(elem["Identifier"])
+				if err != nil {
+					return "", err
+				}
+				typ += " " + name
+			}
+			list = append(list, typ)
+		}
+		return "(" + strings.Join(list, ", ") + ")", nil
+	}
+	return qualifiedName(obj)
+}
+
+// simpleName returns the code for uast:Identifier or the GenericName node of the driver.
+func simpleName(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || typeOf(obj) != "GenericName" {
+		return identifier(n)
+	}
+	name, err := identifier(obj["Identifier"])
+	if err != nil {
+		return "", err
+	}
+	list, _ := obj["TypeArgumentList"].(nodes.Object)
+	args, _ := list["Arguments"].(nodes.Array)
+	types := make([]string, 0, len(args))
+	for _, a := range args {
+		typ, err := typeName(a)
+		if err != nil {
+			return "", err
+		}
+		types = append(types, typ)
+	}
+	return name + "<" + strings.Join(types, ", ") + ">", nil
+}
+
+// qualifiedName returns the code for uast:Identifier or uast:QualifiedIdentifier. Names can
+// also be the GenericName nodes of the driver.
+func qualifiedName(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || typeOf(obj) != uast.TypeOf(uast.QualifiedIdentifier{}) {
+		return simpleName(n)
+	}
+	arr, ok := obj["Names"].(nodes.Array)
+	if !ok || len(arr) == 0 {
+		return "", fmt.Errorf("qualified identifier has no names")
+	}
+	names := make([]string, 0, len(arr))
+	for _, id := range arr {
+		name, err := simpleName(id)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "."), nil
+}
+
+// identifier returns the code for uast:Identifier. Names that are C# keywords are escaped with @.
+func identifier(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || typeOf(obj) != uast.TypeOf(uast.Identifier{}) {
+		return "", fmt.Errorf("expected an identifier, got: %s", uast.TypeOf(n))
+	}
+	name, _ := obj["Name"].(nodes.String)
+	return escapeName(string(name))
+}
+
+// escapeName checks that the name is a valid C# identifier and escapes keywords with @.
+func escapeName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("identifier has no name")
+	}
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return "", fmt.Errorf("invalid identifier: %q", name)
+		}
+	}
+	if keywords[name] {
+		return "@" + name, nil
+	}
+	return name, nil
+}
+
+// keyword returns the text of a keyword node of the driver, for example a modifier of
+// a function or a keyword of the predefined type.
+//
+// If the node has no text, the keyword is derived from the node type: PublicKeyword
+// is written as public.
+func keyword(n nodes.Node) (string, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return "", fmt.Errorf("expected a keyword, got: %T", n)
+	}
+	if text, ok := obj["Text"].(nodes.String); ok && text != "" {
+		return string(text), nil
+	}
+	if tok, ok := obj[uast.KeyToken].(nodes.String); ok && tok != "" {
+		return string(tok), nil
+	}
+	typ := typeOf(obj)
+	kw := strings.ToLower(strings.TrimSuffix(typ, "Keyword"))
+	if kw == "" || kw == strings.ToLower(typ) {
+		return "", fmt.Errorf("unsupported keyword: %s", typ)
+	}
+	return kw, nil
+}
+
+// quote returns a regular C# string literal for the value.
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case 0:
+			buf.WriteString(`\0`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			switch {
+			case r > 0xffff && !unicode.IsPrint(r):
+				fmt.Fprintf(&buf, `\U%08x`, r)
+			case !unicode.IsPrint(r):
+				// \x has a variable length in C#, thus \u is used instead
+				fmt.Fprintf(&buf, `\u%04x`, r)
+			default:
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// keywords is a set of reserved C# keywords that cannot be used as identifiers without @.
+var keywords = map[string]bool{
+	"abstract": true, "as": true, "base": true, "bool": true, "break": true,
+	"byte": true, "case": true, "catch": true, "char": true, "checked": true,
+	"class": true, "const": true, "continue": true, "decimal": true, "default": true,
+	"delegate": true, "do": true, "double": true, "else": true, "enum": true,
+	"event": true, "explicit": true, "extern": true, "false": true, "finally": true,
+	"fixed": true, "float": true, "for": true, "foreach": true, "goto": true,
+	"if": true, "implicit": true, "in": true, "int": true, "interface": true,
+	"internal": true, "is": true, "lock": true, "long": true, "namespace": true,
+	"new": true, "null": true, "object": true, "operator": true, "out": true,
+	"override": true, "params": true, "private": true, "protected": true, "public": true,
+	"readonly": true, "ref": true, "return": true, "sbyte": true, "sealed": true,
+	"short": true, "sizeof": true, "stackalloc": true, "static": true, "string": true,
+	"struct": true, "switch": true, "this": true, "throw": true, "true": true,
+	"try": true, "typeof": true, "uint": true, "ulong": true, "unchecked": true,
+	"unsafe": true, "ushort": true, "using": true, "virtual": true, "void": true,
+	"volatile": true, "while": true,
+}
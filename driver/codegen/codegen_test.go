@@ -0,0 +1,401 @@
+package codegen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	"github.com/bblfsh/sdk/v3/uast/uastyaml"
+)
+
+func ident(name string) nodes.Object {
+	return nodes.Object{
+		"@type": nodes.String("uast:Identifier"),
+		"Name":  nodes.String(name),
+	}
+}
+
+func arg(name string, typ nodes.Node) nodes.Object {
+	return nodes.Object{
+		"@type":    nodes.String("uast:Argument"),
+		"Name":     ident(name),
+		"Type":     typ,
+		"Init":     nil,
+		"Variadic": nodes.Bool(false),
+		"Receiver": nodes.Bool(false),
+	}
+}
+
+func funcGroup(mods nodes.Array, name string, args, returns nodes.Array, body nodes.Node) nodes.Object {
+	return nodes.Object{
+		"@type": nodes.String("uast:FunctionGroup"),
+		"Nodes": nodes.Array{
+			mods,
+			nodes.Object{
+				"@type": nodes.String("uast:Alias"),
+				"Name":  ident(name),
+				"Node": nodes.Object{
+					"@type": nodes.String("uast:Function"),
+					"Type": nodes.Object{
+						"@type":     nodes.String("uast:FunctionType"),
+						"Arguments": args,
+						"Returns":   returns,
+					},
+					"Body": body,
+				},
+			},
+		},
+	}
+}
+
+func block(stmts ...nodes.Node) nodes.Object {
+	return nodes.Object{
+		"@type":      nodes.String("uast:Block"),
+		"Statements": nodes.Array(stmts),
+	}
+}
+
+func TestSprint(t *testing.T) {
+	str := nodes.Object{
+		"@type":  nodes.String("uast:String"),
+		"Value":  nodes.String("a \"b\"\n"),
+		"Format": nodes.String(""),
+	}
+	ret := nodes.Object{
+		"@type":         nodes.String("csharp:ReturnStatement"),
+		"Expression":    str,
+		"ReturnKeyword": nodes.Object{"@type": nodes.String("csharp:ReturnKeyword")},
+	}
+	strType := nodes.Object{
+		"@type":   nodes.String("csharp:PredefinedType"),
+		"Keyword": nodes.Object{"@type": nodes.String("csharp:StringKeyword")},
+	}
+	returns := nodes.Array{nodes.Object{"@type": nodes.String("uast:Argument"), "Type": strType}}
+	ast := nodes.Array{
+		nodes.Object{
+			"@type": nodes.String("uast:Import"),
+			"Path": nodes.Object{
+				"@type": nodes.String("uast:QualifiedIdentifier"),
+				"Names": nodes.Array{ident("System"), ident("IO")},
+			},
+			"All": nodes.Bool(true),
+		},
+		nodes.Object{
+			"@type": nodes.String("uast:Import"),
+			"Path": nodes.Object{
+				"@type": nodes.String("uast:Alias"),
+				"Name":  ident("M"),
+				"Node":  ident("Math"),
+			},
+			"All": nodes.Bool(true),
+		},
+		nodes.Object{
+			"@type":  nodes.String("uast:Import"),
+			"Path":   ident("Console"),
+			"All":    nodes.Bool(true),
+			"Target": nodes.Object{"static": nodes.Bool(true)},
+		},
+		funcGroup(
+			nodes.Array{
+				nodes.Object{"@type": nodes.String("csharp:PublicKeyword"), "Text": nodes.String("public")},
+				nodes.Object{"@type": nodes.String("StaticKeyword")},
+			},
+			"Name",
+			nodes.Array{
+				arg("event", nodes.Object{
+					"@type": nodes.String("ByRefType"),
+					"Kind":  nodes.String("ref"),
+					"Type":  ident("Event"),
+				}),
+				arg("data", nil),
+			},
+			returns,
+			block(ret, block(nodes.Object{"@type": nodes.String("ReturnStatement"), "ReturnKeyword": nil})),
+		),
+		// arrow expression, as produced by arrowBlock of the normalizer
+		funcGroup(nil, "Arrow", nil, returns, block(nodes.Object{
+			"@type":      nodes.String("ReturnStatement"),
+			"Expression": ident("s"),
+		})),
+		funcGroup(nil, "Abstract", nil, nil, nil),
+		funcGroup(nil, "~Name", nil, nil, block()),
+	}
+	const exp = `using System.IO;
+using M = Math;
+using static Console;
+
+public static string Name(ref Event @event, object data)
+{
+    return "a \"b\"\n";
+    {
+        return;
+    }
+}
+
+string Arrow() => s;
+
+void Abstract();
+
+~Name()
+{
+}
+`
+	got, err := Sprint(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != exp {
+		t.Errorf("unexpected code:\n%s", got)
+	}
+}
+
+func TestSprintUnsupported(t *testing.T) {
+	ast := funcGroup(nil, "F", nil, nil, block(nodes.Object{
+		"@type": nodes.String("csharp:IfStatement"),
+	}))
+	if _, err := Sprint(ast); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSprintComments(t *testing.T) {
+	comment := func(text string) nodes.Object {
+		return nodes.Object{
+			"@type": nodes.String("uast:Comment"),
+			"Text":  nodes.String(text),
+			"Block": nodes.Bool(true),
+		}
+	}
+	ret := nodes.Object{
+		"@type":         nodes.String("csharp:ReturnStatement"),
+		"ReturnKeyword": nodes.Object{"@type": nodes.String("csharp:ReturnKeyword")},
+	}
+	ast := funcGroup(nil, "F", nil, nil, block(nodes.Object{
+		"@type": nodes.String("uast:Group"),
+		"Nodes": nodes.Array{comment("a\r\n\r\nb */"), ret},
+	}))
+	const exp = `void F()
+{
+    // a
+    //
+    // b */
+    return;
+}
+`
+	got, err := Sprint(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != exp {
+		t.Errorf("unexpected code:\n%s", got)
+	}
+}
+
+// stripBodies returns a copy of the node without statements in blocks, except for nested
+// functions and accessors. Only a subset of statements is supported by the generator, thus
+// the bodies are removed to test function declarations produced by the normalizer.
+func stripBodies(n nodes.Node) nodes.Node {
+	switch n := n.(type) {
+	case nodes.Object:
+		obj := make(nodes.Object, len(n))
+		for k, v := range n {
+			obj[k] = stripBodies(v)
+		}
+		if typeOf(obj) == uast.TypeOf(uast.Block{}) {
+			arr, _ := obj["Statements"].(nodes.Array)
+			stmts := nodes.Array{}
+			for _, st := range arr {
+				switch typeOf(st) {
+				case uast.TypeOf(uast.FunctionGroup{}), "AccessorDeclaration":
+					stmts = append(stmts, st)
+				}
+			}
+			obj["Statements"] = stmts
+		}
+		return obj
+	case nodes.Array:
+		arr := make(nodes.Array, 0, len(n))
+		for _, v := range n {
+			arr = append(arr, stripBodies(v))
+		}
+		return arr
+	}
+	return n
+}
+
+// funcGroups calls fn for each uast:FunctionGroup in the semantic UAST of a fixture.
+func funcGroups(t testing.TB, path string, fn func(group nodes.Object)) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, err := uastyaml.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes.WalkPreOrder(ast, func(n nodes.Node) bool {
+		if obj, ok := n.(nodes.Object); ok && uast.TypeOf(obj) == uast.TypeOf(uast.FunctionGroup{}) {
+			fn(obj)
+		}
+		return true
+	})
+}
+
+// aliasName returns the name of the function in the group, or an empty string for anonymous functions.
+func aliasName(group nodes.Object) string {
+	arr, _ := group["Nodes"].(nodes.Array)
+	for _, sub := range arr {
+		if alias, ok := sub.(nodes.Object); ok && typeOf(alias) == uast.TypeOf(uast.Alias{}) {
+			id, _ := alias["Name"].(nodes.Object)
+			name, _ := id["Name"].(nodes.String)
+			return string(name)
+		}
+	}
+	return ""
+}
+
+var fixtureCases = []struct {
+	file string
+	name string
+	exp  string
+}{
+	{
+		file: "u2_func_return_type.cs",
+		name: "returnType",
+		exp:  "MyType returnType(MyType someArg)\n{\n}\n",
+	},
+	{
+		file: "attributes.cs",
+		name: "Get",
+		exp: `[Route("api/items", Name = "items")]
+[HttpGet]
+[return: MarshalAs(UnmanagedType.Bool)]
+public bool Get([FromQuery] int id, [System.Runtime.InteropServices.Optional] string name)
+{
+}
+`,
+	},
+	{
+		file: "doc_comments.cs",
+		name: "Broken",
+		exp: `/// <summary>Broken <b>xml</summary>
+void Broken()
+{
+}
+`,
+	},
+	{
+		file: "explicit_interface.cs",
+		name: "CompareTo",
+		exp: `int IComparable<Resource>.CompareTo(Resource other)
+{
+}
+`,
+	},
+	{
+		file: "generic_constraints.cs",
+		name: "Put",
+		exp:  "public void Put<T>(T item) where T : class?, IDisposable\n{\n}\n",
+	},
+	{
+		file: "generic_methods.cs",
+		name: "Copy",
+		exp: `public void Copy<TSource, TTarget>(TSource source, TTarget target) where TSource : struct where TTarget : IList<TSource>
+{
+}
+`,
+	},
+	{
+		file: "indexer_accessors.cs",
+		name: "this[]",
+		exp: `string this[string key]
+{
+    get;
+    set;
+}
+`,
+	},
+	{
+		file: "n_queens.cs",
+		name: "Allowed",
+		exp: `static bool Allowed(bool[,] board, int x, int y)
+{
+}
+`,
+	},
+	{
+		file: "parameters.cs",
+		name: "Update",
+		exp: `static void Update(this ref Vector v, string? name = null)
+{
+}
+`,
+	},
+	{
+		file: "top_level_program.cs",
+		name: "<Main>$",
+		// statements of the entry point are written at the top level
+		exp: "void Greet(string name)\n{\n}\n",
+	},
+	{
+		file: "tuple.cs",
+		name: "Returntuple",
+		exp: `public static (int Count, double Sum) Returntuple()
+{
+}
+`,
+	},
+}
+
+// TestSprintFixture checks that function groups in the semantic UAST of fixtures are printed
+// as methods. Only the first group with a given name is checked.
+func TestSprintFixture(t *testing.T) {
+	for _, c := range fixtureCases {
+		c := c
+		t.Run(c.file+"/"+c.name, func(t *testing.T) {
+			var group nodes.Object
+			funcGroups(t, "../../fixtures/"+c.file+".sem.uast", func(g nodes.Object) {
+				if group == nil && aliasName(g) == c.name {
+					group = g
+				}
+			})
+			if group == nil {
+				t.Fatal("function group not found")
+			}
+			got, err := Sprint(stripBodies(group))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.exp {
+				t.Errorf("unexpected code:\n%s", got)
+			}
+		})
+	}
+}
+
+// TestSprintCorpus checks that all function groups in the semantic UAST of fixtures can be printed,
+// except for anonymous functions that have no name.
+func TestSprintCorpus(t *testing.T) {
+	files, err := filepath.Glob("../../fixtures/*.sem.uast")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, path := range files {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".sem.uast"), func(t *testing.T) {
+			funcGroups(t, path, func(group nodes.Object) {
+				if aliasName(group) == "" {
+					return
+				}
+				if _, err := Sprint(stripBodies(group)); err != nil {
+					t.Errorf("%s: %v", aliasName(group), err)
+				}
+			})
+		})
+	}
+}
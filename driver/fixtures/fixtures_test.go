@@ -1,13 +1,16 @@
 package fixtures
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
+	"github.com/bblfsh/csharp-driver/driver/impl"
 	"github.com/bblfsh/csharp-driver/driver/normalizer"
 	"github.com/bblfsh/sdk/v3/driver"
 	"github.com/bblfsh/sdk/v3/driver/fixtures"
 	"github.com/bblfsh/sdk/v3/driver/native"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
 	"github.com/bblfsh/sdk/v3/uast/transformer/positioner"
 )
 
@@ -24,21 +27,56 @@ var Suite = &fixtures.Suite{
 	BenchName:  "parser_context",
 	Semantic: fixtures.SemanticConfig{
 		BlacklistTypes: []string{
+			"AccessorList",
+			"AddAccessorDeclaration",
+			"AnonymousMethodExpression",
 			"ArgListKeyword",
+			"AttributeArgumentList",
+			"AttributeList",
+			"AttributeTargetSpecifier",
 			"Block",
+			"BracketedParameterList",
+			"ClassDeclaration",
+			"ClassOrStructConstraint_ClassConstraint",
+			"ClassOrStructConstraint_StructConstraint",
+			"ConstructorConstraint",
 			"ConstructorDeclaration",
+			"ConversionOperatorDeclaration",
 			"DestructorDeclaration",
+			"EventDeclaration",
+			"ExplicitInterfaceSpecifier",
 			"FalseLiteralExpression",
+			"FileScopedNamespaceDeclaration",
+			"GetAccessorDeclaration",
 			"IdentifierName",
 			"IdentifierToken",
+			"IndexerDeclaration",
+			"InitAccessorDeclaration",
+			"InterfaceDeclaration",
+			"LocalFunctionStatement",
 			"MethodDeclaration",
 			"MultiLineCommentTrivia",
+			"NamespaceDeclaration",
+			"OperatorDeclaration",
 			"Parameter",
+			"ParenthesizedLambdaExpression",
+			"PositionalPatternClause",
+			"PropertyDeclaration",
+			"PropertyPatternClause",
 			"QualifiedName",
+			"RecordDeclaration",
+			"RecordDeclaration_RecordStructDeclaration",
+			"RemoveAccessorDeclaration",
+			"SetAccessorDeclaration",
+			"SimpleLambdaExpression",
 			"SingleLineCommentTrivia",
 			"SingleLineDocumentationCommentTrivia",
 			"StringLiteralExpression",
+			"StructDeclaration",
 			"TrueLiteralExpression",
+			"TypeConstraint",
+			"TypeParameter",
+			"TypeParameterList",
 			"UsingDirective",
 		},
 	},
@@ -47,6 +85,7 @@ var Suite = &fixtures.Suite{
 			"IdentifierToken",
 			"ClassKeyword",
 			"FalseLiteralExpression",
+			"FileScopedNamespaceDeclaration",
 			"MultiLineCommentTrivia",
 			"QualifiedName",
 			"SingleLineCommentTrivia",
@@ -58,10 +97,53 @@ var Suite = &fixtures.Suite{
 	},
 }
 
+// scriptNative parses all files as C# scripts.
+type scriptNative struct {
+	*impl.Native
+}
+
+func (d scriptNative) Parse(ctx context.Context, src string) (nodes.Node, error) {
+	return d.ParseWithOptions(ctx, src, impl.Options{Kind: impl.KindScript})
+}
+
+// ScriptSuite runs the tests for C# scripts. It shares the fixtures directory with Suite,
+// but uses a different extension.
+var ScriptSuite = &fixtures.Suite{
+	Lang: "csharp",
+	Ext:  impl.ScriptExt,
+	Path: Suite.Path,
+	NewDriver: func() driver.Native {
+		return scriptNative{impl.NewNative(filepath.Join(projectRoot, "build/bin/native"))}
+	},
+	Transforms:   normalizer.Transforms,
+	Semantic:     Suite.Semantic,
+	VerifyTokens: Suite.VerifyTokens,
+}
+
+// RegionSuite runs the tests for the optional transformation that groups members by #region
+// directives. Fixtures are stored in a separate directory, since the UAST differs from Suite.
+var RegionSuite = &fixtures.Suite{
+	Lang:         "csharp",
+	Ext:          ".cs",
+	Path:         filepath.Join(Suite.Path, "regions"),
+	NewDriver:    Suite.NewDriver,
+	Transforms:   normalizer.TransformsWithRegions,
+	Semantic:     Suite.Semantic,
+	VerifyTokens: Suite.VerifyTokens,
+}
+
 func TestCsharpDriver(t *testing.T) {
 	Suite.RunTests(t)
 }
 
+func TestCsharpScripts(t *testing.T) {
+	ScriptSuite.RunTests(t)
+}
+
+func TestCsharpRegions(t *testing.T) {
+	RegionSuite.RunTests(t)
+}
+
 func BenchmarkCsharpDriver(b *testing.B) {
 	Suite.RunBenchmarks(b)
 }
@@ -0,0 +1,50 @@
+package fixtures
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bblfsh/csharp-driver/driver/impl"
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+	"github.com/bblfsh/csharp-driver/driver/printer"
+	"github.com/bblfsh/sdk/v3/driver"
+	"github.com/bblfsh/sdk/v3/driver/manifest"
+)
+
+// TestPrintNative checks that the native AST returned by the driver with the Trivia option
+// is printed back to the same source, byte for byte.
+func TestPrintNative(t *testing.T) {
+	d := impl.NewDriver(impl.NewNative(filepath.Join(projectRoot, "build/bin/native")), &manifest.Manifest{
+		Language: Suite.Lang,
+	}, normalizer.Transforms, impl.Options{})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	ctx := impl.WithOptions(context.Background(), impl.Options{Trivia: true})
+	for _, name := range []string{"hello.cs", "build.csx", "preprocessor.cs", "unicode.cs"} {
+		t.Run(name, func(t *testing.T) {
+			src, err := ioutil.ReadFile(filepath.Join(Suite.Path, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast, err := d.Parse(ctx, string(src), &driver.ParseOptions{
+				Mode:     driver.ModeNative,
+				Filename: name,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := printer.Sprint(ast)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(src) {
+				t.Errorf("printed source differs:\n%s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package fixtures
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bblfsh/csharp-driver/driver/impl"
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+)
+
+func TestConditionalRegions(t *testing.T) {
+	const src = `#define TRACE
+using System;
+#if NET48 // full framework
+class A {}
+#elif NETCOREAPP && !DEBUG
+class B {}
+#else
+#if TRACE
+class C {}
+#endif
+#endif
+`
+	d := impl.NewDriver(impl.NewNative(filepath.Join(projectRoot, "build/bin/native")), nil, normalizer.Transforms, impl.Options{
+		Defines: []string{"NETCOREAPP", "DEBUG"},
+	})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	regions, err := d.ConditionalRegions(context.Background(), src, "regions.cs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type region struct {
+		Directive, Condition string
+		Depth                int
+		Active               bool
+		Start, End           int
+		Defines              []string
+	}
+	exp := []region{
+		{Directive: "if", Condition: "NET48", Active: false, Start: 3, End: 5, Defines: []string{"NETCOREAPP", "DEBUG", "NET48"}},
+		{Directive: "elif", Condition: "NETCOREAPP && !DEBUG", Active: false, Start: 5, End: 7, Defines: []string{"NETCOREAPP"}},
+		{Directive: "else", Active: true, Start: 7, End: 11, Defines: []string{"NETCOREAPP", "DEBUG"}},
+		{Directive: "if", Condition: "TRACE", Depth: 1, Active: true, Start: 8, End: 10, Defines: []string{"NETCOREAPP", "DEBUG"}},
+	}
+	got := make([]region, 0, len(regions))
+	for _, r := range regions {
+		got = append(got, region{
+			Directive: r.Directive, Condition: r.Condition,
+			Depth: r.Depth, Active: r.Active,
+			Start: int(r.Start.Line), End: int(r.End.Line),
+			Defines: r.Defines,
+		})
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected regions:\n%+v\nvs\n%+v", got, exp)
+	}
+}
@@ -0,0 +1,303 @@
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bblfsh/csharp-driver/driver/impl"
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+	"github.com/bblfsh/sdk/v3/driver"
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	"github.com/bblfsh/sdk/v3/uast/uastyaml"
+)
+
+// TestReverseNormalize checks that the semantic UAST of each fixture can be converted back to
+// the native AST, and that the result matches the preprocessed native AST.
+//
+// The preprocessed tree is the contract of the reverse transformation: Normalize consumes the
+// output of Preprocess, and Denormalize returns a tree in the same form. Preprocess erases
+// whitespace trivia and replaces text spans with positions, which cannot be done in reverse
+// without the source code.
+//
+// Fields listed in droppedFields are allowed to be missing. All other fields and the structure
+// of the tree must be the same, and no semantic UAST nodes must be left.
+func TestReverseNormalize(t *testing.T) {
+	list, err := ioutil.ReadDir(Suite.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, ent := range list {
+		name := ent.Name()
+		if ext := filepath.Ext(name); ext != Suite.Ext && ext != impl.ScriptExt {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(Suite.Path, name+".native"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(strings.TrimSuffix(name, Suite.Ext), func(t *testing.T) {
+			code, err := ioutil.ReadFile(filepath.Join(Suite.Path, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast, err := uastyaml.Unmarshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := normalizer.Transforms
+			exp, err := tr.Do(ctx, driver.ModePreprocessed, string(code), ast)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sem, err := tr.Do(ctx, driver.ModeSemantic, string(code), ast)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := normalizer.ToNative(sem)
+			if err != nil {
+				t.Fatal("cannot convert to native AST:", err)
+			}
+			if got == nil {
+				t.Fatal("empty native AST")
+			}
+			if typ := semanticType(got); typ != "" {
+				t.Fatalf("%s node is left in the native AST", typ)
+			}
+			if path := diffNative("", exp, got); path != "" {
+				t.Errorf("native AST differs after the round trip at %s", path)
+			}
+		})
+	}
+}
+
+// semanticType returns the type of the first semantic UAST node found in the tree,
+// or an empty string if there are none. Positions are the only UAST nodes in the native AST.
+func semanticType(n nodes.Node) string {
+	switch n := n.(type) {
+	case nodes.Object:
+		typ := uast.TypeOf(n)
+		if strings.HasPrefix(typ, uast.NS+":") && typ != uast.TypeOf(uast.Positions{}) && typ != uast.TypeOf(uast.Position{}) {
+			return typ
+		}
+		for _, k := range n.Keys() {
+			if typ := semanticType(n[k]); typ != "" {
+				return typ
+			}
+		}
+	case nodes.Array:
+		for _, v := range n {
+			if typ := semanticType(v); typ != "" {
+				return typ
+			}
+		}
+	}
+	return ""
+}
+
+// droppedFields lists fields of native nodes that are dropped by the normalizer and are not
+// restored by Denormalize, indexed by the node type.
+//
+// Most of them are punctuation, keywords and positions of nodes that have no counterpart in
+// the semantic UAST. Tokens that are restored from a field of the semantic node (modifiers,
+// operators, etc) have no text and positions. Trivia of dropped keywords, the NameColon field
+// of sub-patterns (a duplicate of ExpressionColon) and fields that are missing in older versions
+// of Roslyn (attributes and modifiers of namespaces) are lost as well.
+var droppedFields = map[string][]string{
+	"AccessorList":              {uast.KeyPos, "CloseBraceToken", "OpenBraceToken"},
+	"AddAccessorDeclaration":    {"SemicolonToken"},
+	"AllowsConstraintClause":    {"AllowsKeyword"},
+	"AndKeyword":                {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"AnonymousMethodExpression": {"Block"},
+	"AssemblyKeyword":           {uast.KeyPos},
+	"AttributeArgumentList":     {uast.KeyPos, "CloseParenToken", "OpenParenToken"},
+	"AttributeList":             {uast.KeyPos, "CloseBracketToken", "OpenBracketToken"},
+	"AttributeTargetSpecifier":  {uast.KeyPos, "ColonToken"},
+	"AwaitKeyword":              {uast.KeyPos},
+	"BaseList":                  {uast.KeyPos, "ColonToken"},
+	"Block":                     {"CloseBraceToken", "OpenBraceToken"},
+	"BracketedParameterList":    {uast.KeyPos, "CloseBracketToken", "OpenBracketToken"},
+	"ClassDeclaration":          {"Arity", "CloseBraceToken", "Keyword", "OpenBraceToken", "SemicolonToken"},
+	"ClassKeyword":              {uast.KeyPos, "TrailingTrivia"},
+	"ClassOrStructConstraint_ClassConstraint":  {"ClassOrStructKeyword"},
+	"ClassOrStructConstraint_StructConstraint": {"ClassOrStructKeyword"},
+	"CloseBraceToken":                          {uast.KeyPos, "TrailingTrivia"},
+	"CloseParenToken":                          {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"ConstructorConstraint":                    {"CloseParenToken", "NewKeyword", "OpenParenToken"},
+	"ConstructorDeclaration":                   {"SemicolonToken"},
+	"ConversionOperatorDeclaration":            {"OperatorKeyword", "SemicolonToken"},
+	"DefaultConstraint":                        {"DefaultKeyword"},
+	"DelegateKeyword": {
+		uast.KeyPos + "." + uast.KeyEnd,
+		uast.KeyPos + "." + normalizer.KeyFullStart,
+		uast.KeyPos + "." + normalizer.KeyFullEnd,
+	},
+	"DestructorDeclaration":          {"SemicolonToken", "TildeToken"},
+	"EqualsEqualsToken":              {"IsMissing", "Text", "Value", "ValueText"},
+	"EqualsGreaterThanToken":         {uast.KeyPos, "Text", "Value", "ValueText"},
+	"EqualsValueClause":              {uast.KeyPos, "EqualsToken"},
+	"EventDeclaration":               {"EventKeyword", "SemicolonToken"},
+	"ExclamationEqualsToken":         {"IsMissing", "Text", "Value", "ValueText"},
+	"ExplicitInterfaceSpecifier":     {"DotToken"},
+	"ExplicitKeyword":                {"IsMissing", "Text", "Value", "ValueText"},
+	"ExpressionColon":                {uast.KeyPos, "ColonToken"},
+	"FalseKeyword":                   {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"FieldKeyword":                   {uast.KeyPos},
+	"FileScopedNamespaceDeclaration": {"SemicolonToken"},
+	"GetAccessorDeclaration":         {"SemicolonToken"},
+	"GetKeyword":                     {uast.KeyPos},
+	"GlobalStatement":                {uast.KeyPos},
+	"GreaterThanEqualsToken":         {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"GreaterThanToken":               {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"IdentifierName":                 {uast.KeyPos},
+	"IdentifierToken":                {uast.KeyPos, "Text"},
+	"ImplicitKeyword":                {"IsMissing", "Text", "Value", "ValueText"},
+	"InKeyword":                      {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"IndexerDeclaration":             {"Semicolon", "SemicolonToken"},
+	"InitAccessorDeclaration":        {"SemicolonToken"},
+	"InitKeyword":                    {uast.KeyPos},
+	"InterfaceDeclaration":           {"Arity", "CloseBraceToken", "Keyword", "OpenBraceToken", "SemicolonToken"},
+	"InterfaceKeyword":               {uast.KeyPos, "TrailingTrivia"},
+	"LessThanEqualsToken":            {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"LessThanToken":                  {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"ListPattern":                    {"CloseBracketToken", "OpenBracketToken"},
+	"LocalDeclarationStatement":      {"SemicolonToken"},
+	"LocalFunctionStatement":         {"AttributeLists", "SemicolonToken"},
+	"MethodDeclaration":              {"Arity", "SemicolonToken"},
+	"MinusToken":                     {"IsMissing", "Text", "Value", "ValueText"},
+	"NameColon":                      {uast.KeyPos, "ColonToken", "Expression"},
+	"NameEquals":                     {uast.KeyPos, "EqualsToken"},
+	"NamespaceDeclaration":           {"AttributeLists", "CloseBraceToken", "Modifiers", "NamespaceKeyword", "OpenBraceToken", "SemicolonToken"},
+	"NamespaceKeyword":               {uast.KeyPos, "TrailingTrivia"},
+	"None":                           {uast.KeyPos},
+	"NotKeyword":                     {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"OpenBracketToken":               {uast.KeyPos, "TrailingTrivia"},
+	"OpenParenToken":                 {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"OperatorDeclaration":            {"OperatorKeyword", "SemicolonToken"},
+	"OrKeyword":                      {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"OutKeyword":                     {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"ParameterList":                  {uast.KeyPos, "CloseParenToken", "OpenParenToken"},
+	"ParamsKeyword":                  {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"ParenthesizedLambdaExpression":  {"Block", "ExpressionBody"},
+	"PlusToken":                      {"IsMissing", "Text", "Value", "ValueText"},
+	"PositionalPatternClause":        {uast.KeyPos, "CloseParenToken", "OpenParenToken"},
+	"PropertyDeclaration":            {"Semicolon", "SemicolonToken"},
+	"PropertyPatternClause":          {uast.KeyPos, "CloseBraceToken", "OpenBraceToken"},
+	"QualifiedName":                  {uast.KeyPos, "DotToken"},
+	"QuestionToken":                  {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"RecordDeclaration":              {"Arity", "ClassOrStructKeyword", "CloseBraceToken", "Keyword", "OpenBraceToken", "SemicolonToken"},
+	"RecordDeclaration_RecordStructDeclaration": {"Arity", "ClassOrStructKeyword", "CloseBraceToken", "Keyword", "OpenBraceToken", "SemicolonToken"},
+	"RefKeyword":                    {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"RefStructConstraint":           {uast.KeyPos, "RefKeyword", "StructKeyword"},
+	"RemoveAccessorDeclaration":     {"SemicolonToken"},
+	"ReturnKeyword":                 {uast.KeyPos},
+	"SemicolonToken":                {uast.KeyPos, "LeadingTrivia"},
+	"SetAccessorDeclaration":        {"SemicolonToken"},
+	"SetKeyword":                    {uast.KeyPos},
+	"SimpleBaseType":                {uast.KeyPos},
+	"SimpleLambdaExpression":        {"Block", "ExpressionBody"},
+	"SlicePattern":                  {"DotDotToken"},
+	"StaticKeyword":                 {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"StringLiteralToken":            {uast.KeyPos, "Text"},
+	"StructDeclaration":             {"Arity", "CloseBraceToken", "Keyword", "OpenBraceToken", "SemicolonToken"},
+	"StructKeyword":                 {uast.KeyPos, "TrailingTrivia"},
+	"Subpattern":                    {"NameColon"},
+	"SwitchExpression":              {"CloseBraceToken", "OpenBraceToken", "SwitchKeyword"},
+	"SwitchExpressionArm":           {"EqualsGreaterThanToken"},
+	"ThisKeyword":                   {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"TrueKeyword":                   {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"TypeParameterConstraintClause": {uast.KeyPos, "ColonToken", "WhereKeyword"},
+	"TypeParameterList":             {uast.KeyPos, "GreaterThanToken", "LessThanToken"},
+	"UnderscoreToken":               {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"UsingDirective":                {"SemicolonToken", "UsingKeyword"},
+	"UsingKeyword":                  {uast.KeyPos, "TrailingTrivia"},
+	"UsingStatement":                {"AwaitKeyword", "CloseParenToken", "OpenParenToken", "UsingKeyword"},
+	"VarKeyword":                    {uast.KeyPos, "IsMissing", "Text", "Value", "ValueText"},
+	"WhenClause":                    {uast.KeyPos, "WhenKeyword"},
+}
+
+// isDropped checks if the field of the native node is listed in droppedFields.
+func isDropped(typ, key string) bool {
+	for _, k := range droppedFields[typ] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// dropNested removes fields of the nested object that are missing in the restored tree, if
+// droppedFields lists them as "field.key" for the parent type.
+func dropNested(typ, field string, exp, got nodes.Object) nodes.Object {
+	out := exp
+	for k := range exp {
+		if got[k] == nil && isDropped(typ, field+"."+k) {
+			if len(out) == len(exp) {
+				out = exp.CloneObject()
+			}
+			delete(out, k)
+		}
+	}
+	return out
+}
+
+// diffNative compares the native AST restored from the semantic UAST with the original one.
+// It returns the path to the first node that differs, or an empty string if there are none.
+//
+// Fields listed in droppedFields may be nil or missing in the restored tree.
+func diffNative(path string, exp, got nodes.Node) string {
+	switch exp := exp.(type) {
+	case nodes.Object:
+		obj, ok := got.(nodes.Object)
+		if !ok {
+			return path
+		}
+		typ := uast.TypeOf(exp)
+		if typ != uast.TypeOf(obj) {
+			return path + fmt.Sprintf("[%s != %s]", typ, uast.TypeOf(obj))
+		}
+		for _, k := range obj.Keys() {
+			if _, ok := exp[k]; !ok && obj[k] != nil {
+				return path + "." + k
+			}
+		}
+		for _, k := range exp.Keys() {
+			if obj[k] == nil && isDropped(typ, k) {
+				continue
+			}
+			v := exp[k]
+			if e, ok := v.(nodes.Object); ok {
+				if g, ok := obj[k].(nodes.Object); ok {
+					v = dropNested(typ, k, e, g)
+				}
+			}
+			if p := diffNative(path+"."+k, v, obj[k]); p != "" {
+				return p
+			}
+		}
+		return ""
+	case nodes.Array:
+		arr, ok := got.(nodes.Array)
+		if !ok || len(arr) != len(exp) {
+			return path
+		}
+		for i := range exp {
+			if p := diffNative(fmt.Sprintf("%s[%d]", path, i), exp[i], arr[i]); p != "" {
+				return p
+			}
+		}
+		return ""
+	}
+	if !nodes.Equal(exp, got) {
+		return path
+	}
+	return ""
+}
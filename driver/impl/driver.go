@@ -0,0 +1,141 @@
+package impl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+	"github.com/bblfsh/sdk/v3/driver"
+	"github.com/bblfsh/sdk/v3/driver/manifest"
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+)
+
+// Driver is a C# driver that supports parse options and partial parsing.
+//
+// Parse options are configured for the driver, and may be overridden for a specific
+// request by WithOptions. Files with ScriptExt extension are parsed as C# scripts.
+//
+// Roslyn always returns a tree, even if the file has syntax errors. In this case the native
+// driver replies with an error status, the tree and a list of diagnostics. Driver transforms
+// the tree anyway, and returns it together with driver.ErrSyntax that contains diagnostics
+// with line and column.
+type Driver struct {
+	native *Native
+	m      *manifest.Manifest
+	tr     driver.Transforms
+	opts   Options
+}
+
+var _ driver.DriverModule = (*Driver)(nil)
+
+// NewDriver creates a driver that uses the native driver client d, manifest m and
+// transforms tr. Options are used by default for all requests.
+func NewDriver(d *Native, m *manifest.Manifest, tr driver.Transforms, opts Options) *Driver {
+	return &Driver{native: d, m: m, tr: tr, opts: opts}
+}
+
+// Start implements driver.Module.
+func (d *Driver) Start() error {
+	return d.native.Start()
+}
+
+// Close implements driver.Module.
+func (d *Driver) Close() error {
+	return d.native.Close()
+}
+
+// Parse implements driver.Driver.
+func (d *Driver) Parse(ctx context.Context, src string, opts *driver.ParseOptions) (nodes.Node, error) {
+	if opts == nil {
+		opts = &driver.ParseOptions{}
+	}
+	if opts.Language == "" {
+		opts.Language = d.m.Language
+	}
+	popts := d.opts
+	if isScript(opts.Filename) {
+		popts.Kind = KindScript
+	}
+	if o, ok := OptionsFrom(ctx); ok {
+		popts = popts.Merge(o)
+	}
+	if opts.Mode != driver.ModeNative {
+		// the text of trivia is not used by transforms
+		popts.Trivia = false
+	}
+	ast, err := d.native.ParseWithOptions(ctx, src, popts)
+	if driver.ErrDriverFailure.Is(err) {
+		return nil, err
+	}
+	var serr error
+	if err != nil {
+		serr = driver.ErrSyntax.Wrap(diagnostics(src, err))
+		if ast == nil {
+			return nil, serr
+		}
+	}
+	ast, err = d.tr.Do(ctx, opts.Mode, src, ast)
+	if err != nil {
+		if serr != nil {
+			// the tree was recovered by the parser and might not be supported by
+			// transforms, report syntax errors anyway
+			return nil, serr
+		}
+		return nil, driver.ErrTransformFailure.Wrap(err)
+	}
+	return ast, serr
+}
+
+// Version implements driver.Driver.
+func (d *Driver) Version(ctx context.Context) (driver.Version, error) {
+	return driver.Version{
+		Version: d.m.Version,
+		Build:   d.m.Build,
+	}, nil
+}
+
+// Languages implements driver.Driver.
+func (d *Driver) Languages(ctx context.Context) ([]manifest.Manifest, error) {
+	return []manifest.Manifest{*d.m}, nil
+}
+
+// diagnostics converts errors returned by the native driver to errors with line and column.
+func diagnostics(src string, err error) error {
+	var errs []error
+	if e, ok := err.(*driver.ErrMulti); ok {
+		errs = e.Errors
+	} else {
+		errs = []error{err}
+	}
+	out := make([]error, 0, len(errs))
+	for _, e := range errs {
+		out = append(out, diagnostic(src, e))
+	}
+	return driver.JoinErrors(out)
+}
+
+// diagnostic converts a single native error. The native driver formats errors as
+// "offset:id: message", where offset is a UTF-16 offset of the error in the source.
+// The error is returned as "line:col: id: message", or unchanged if it has a different format.
+func diagnostic(src string, err error) error {
+	parts := strings.SplitN(err.Error(), ":", 3)
+	if len(parts) != 3 {
+		return err
+	}
+	off, perr := strconv.ParseUint(parts[0], 10, 32)
+	if perr != nil {
+		return err
+	}
+	pos := uast.Position{Offset: uint32(off)}
+	n, perr := normalizer.FromUTF16Offset{}.OnCode(src).Do(pos.ToObject())
+	if perr != nil {
+		return err
+	}
+	if p := uast.AsPosition(n.(nodes.Object)); p != nil {
+		pos = *p
+	}
+	return fmt.Errorf("%d:%d: %s: %s", pos.Line, pos.Col, parts[1], strings.TrimSpace(parts[2]))
+}
@@ -0,0 +1,55 @@
+package impl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bblfsh/sdk/v3/driver"
+)
+
+func TestDiagnostics(t *testing.T) {
+	const src = "class A\n{\n    int x = ;\n}\n// \U0001F600 ;"
+	cases := []struct {
+		name string
+		err  string
+		exp  string
+	}{
+		{name: "line col", err: "22:CS1525: Invalid expression term ';'", exp: "3:13: CS1525: Invalid expression term ';'"},
+		{name: "surrogate pair", err: "32:CS1002: ; expected", exp: "5:9: CS1002: ; expected"},
+		{name: "end of file", err: "33:CS1513: } expected", exp: "5:10: CS1513: } expected"},
+		{name: "unknown format", err: "parser crashed", exp: "parser crashed"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			err := diagnostics(src, errors.New(c.err))
+			if err.Error() != c.exp {
+				t.Errorf("unexpected error:\n%q\nvs\n%q", err.Error(), c.exp)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsMulti(t *testing.T) {
+	const src = "class A { int x = ; }"
+	err := diagnostics(src, driver.JoinErrors([]error{
+		errors.New("18:CS1525: Invalid expression term ';'"),
+		errors.New("21:CS1513: } expected"),
+	}))
+	multi, ok := err.(*driver.ErrMulti)
+	if !ok {
+		t.Fatalf("expected multiple errors, got: %v", err)
+	}
+	exp := []string{
+		"1:19: CS1525: Invalid expression term ';'",
+		"1:22: CS1513: } expected",
+	}
+	if len(multi.Errors) != len(exp) {
+		t.Fatalf("unexpected number of errors: %d", len(multi.Errors))
+	}
+	for i, e := range multi.Errors {
+		if e.Error() != exp[i] {
+			t.Errorf("unexpected error: %q vs %q", e.Error(), exp[i])
+		}
+	}
+}
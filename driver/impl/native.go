@@ -0,0 +1,189 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/bblfsh/sdk/v3/driver"
+	"github.com/bblfsh/sdk/v3/driver/native"
+	"github.com/bblfsh/sdk/v3/driver/native/jsonlines"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+)
+
+// Native is a client for the C# native driver.
+//
+// It uses the same protocol as the native driver client from the SDK, but in addition
+// sends parse options with each request, see Options. The native driver uses default
+// options if none are set, thus both clients can be used interchangeably.
+type Native struct {
+	bin string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	enc    jsonlines.Encoder
+	dec    jsonlines.Decoder
+}
+
+var _ driver.Native = (*Native)(nil)
+
+// NewNative creates a client for the native driver binary. If the path is empty,
+// the default location of the binary is used.
+func NewNative(bin string) *Native {
+	if bin == "" {
+		bin = native.Binary
+	}
+	return &Native{bin: bin}
+}
+
+// nativeRequest is a request sent to the native driver.
+type nativeRequest struct {
+	Content string   `json:"content"`
+	Options *Options `json:"options,omitempty"`
+}
+
+// nativeResponse is a reply from the native driver.
+type nativeResponse struct {
+	Status string      `json:"status"`
+	Errors []string    `json:"errors"`
+	AST    interface{} `json:"ast"`
+}
+
+// Start executes the native driver and prepares it to parse code.
+func (d *Native) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.start()
+}
+
+func (d *Native) start() error {
+	stdin, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	r, stdout, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		w.Close()
+		return err
+	}
+	cmd := exec.Command(d.bin)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	// pipe ends of the child process are not needed anymore
+	stdin.Close()
+	stdout.Close()
+	if err != nil {
+		w.Close()
+		r.Close()
+		return err
+	}
+	d.cmd = cmd
+	d.stdin, d.stdout = w, r
+	d.enc = jsonlines.NewEncoder(w)
+	d.dec = jsonlines.NewDecoder(r)
+	return nil
+}
+
+// Close stops the native driver.
+func (d *Native) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.close()
+}
+
+func (d *Native) close() error {
+	if d.cmd == nil {
+		return nil
+	}
+	cmd := d.cmd
+	d.cmd = nil
+	// the native driver exits when stdin is closed
+	d.stdin.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		err = <-done
+	}
+	d.stdout.Close()
+	return err
+}
+
+// Parse implements driver.Native. It uses parse options from the context, if any.
+func (d *Native) Parse(ctx context.Context, src string) (nodes.Node, error) {
+	opts, _ := OptionsFrom(ctx)
+	return d.ParseWithOptions(ctx, src, opts)
+}
+
+// ParseWithOptions sends a request with specified parse options to the native driver.
+//
+// Syntax errors are returned together with the tree recovered by the parser. All other
+// errors are wrapped into driver.ErrDriverFailure.
+func (d *Native) ParseWithOptions(ctx context.Context, src string, opts Options) (nodes.Node, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cmd == nil {
+		// not started, or was stopped after a failure
+		if err := d.start(); err != nil {
+			return nil, driver.ErrDriverFailure.Wrap(err, "cannot start the native driver")
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = d.stdin.SetWriteDeadline(deadline)
+		_ = d.stdout.SetReadDeadline(deadline)
+		defer func() {
+			_ = d.stdin.SetWriteDeadline(time.Time{})
+			_ = d.stdout.SetReadDeadline(time.Time{})
+		}()
+	}
+	req := &nativeRequest{Content: src}
+	if !opts.IsZero() {
+		req.Options = &opts
+	}
+	var resp nativeResponse
+	err := d.enc.Encode(req)
+	if err == nil {
+		err = d.dec.Decode(&resp)
+	}
+	if err != nil {
+		// the driver crashed or timed out, and the protocol state is unknown;
+		// stop it now, it will be restarted on the next request
+		_ = d.close()
+		return nil, driver.ErrDriverFailure.Wrap(err)
+	}
+	var ast nodes.Node
+	if resp.AST != nil {
+		ast, err = nodes.ToNode(resp.AST, nil)
+		if err != nil {
+			return nil, driver.ErrDriverFailure.Wrap(err)
+		}
+	}
+	errs := make([]error, 0, len(resp.Errors))
+	for _, s := range resp.Errors {
+		errs = append(errs, errors.New(s))
+	}
+	switch resp.Status {
+	case "ok":
+		return ast, nil
+	case "error":
+		return ast, driver.JoinErrors(errs)
+	case "fatal":
+		return nil, driver.ErrDriverFailure.Wrap(driver.JoinErrors(errs))
+	}
+	return nil, driver.ErrDriverFailure.Wrap(fmt.Errorf("unsupported status: %q", resp.Status))
+}
@@ -0,0 +1,130 @@
+package impl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Source kinds supported by the parser.
+const (
+	KindRegular = "regular"
+	KindScript  = "script"
+)
+
+// ScriptExt is the file extension of C# scripts. Such files are parsed with KindScript,
+// unless the source kind is set explicitly for the request.
+const ScriptExt = ".csx"
+
+// Documentation modes supported by the parser.
+const (
+	DocNone     = "none"
+	DocParse    = "parse"
+	DocDiagnose = "diagnose"
+)
+
+// Environment variables used to configure default parse options of the driver.
+const (
+	EnvLanguageVersion   = "CSHARP_LANGUAGE_VERSION"
+	EnvDefines           = "CSHARP_DEFINES"
+	EnvKind              = "CSHARP_SOURCE_KIND"
+	EnvDocumentationMode = "CSHARP_DOCUMENTATION_MODE"
+	EnvTrivia            = "CSHARP_TRIVIA"
+)
+
+// Options are parse options passed to the native driver.
+// Empty fields mean that the default value of the parser should be used.
+type Options struct {
+	// LanguageVersion is a C# language version, for example "7.3", "latest" or "preview".
+	LanguageVersion string `json:"languageVersion,omitempty"`
+	// Defines is a list of preprocessor symbols to treat as defined, for example "DEBUG".
+	Defines []string `json:"defines,omitempty"`
+	// Kind is a kind of the source file: KindRegular or KindScript.
+	Kind string `json:"kind,omitempty"`
+	// DocumentationMode controls how documentation comments are parsed: DocNone, DocParse
+	// or DocDiagnose.
+	DocumentationMode string `json:"documentationMode,omitempty"`
+	// Trivia adds the text of all trivia to the native AST, including whitespaces and
+	// new lines. It allows to print the tree back to the source, see the printer package.
+	// The option is only used in the native mode.
+	Trivia bool `json:"trivia,omitempty"`
+}
+
+// IsZero checks if all options are set to default values.
+func (o Options) IsZero() bool {
+	return o.LanguageVersion == "" && o.Defines == nil &&
+		o.Kind == "" && o.DocumentationMode == "" && !o.Trivia
+}
+
+// Merge returns options with fields from o2 overriding the corresponding fields of o.
+// Only non-empty fields of o2 are used.
+func (o Options) Merge(o2 Options) Options {
+	if o2.LanguageVersion != "" {
+		o.LanguageVersion = o2.LanguageVersion
+	}
+	if o2.Defines != nil {
+		o.Defines = o2.Defines
+	}
+	if o2.Kind != "" {
+		o.Kind = o2.Kind
+	}
+	if o2.DocumentationMode != "" {
+		o.DocumentationMode = o2.DocumentationMode
+	}
+	if o2.Trivia {
+		o.Trivia = true
+	}
+	return o
+}
+
+// OptionsFromEnv reads default parse options from environment variables.
+//
+// Preprocessor symbols in CSHARP_DEFINES are separated by semicolons or commas,
+// the same way as in DefineConstants of the project file.
+func OptionsFromEnv() Options {
+	opts := Options{
+		LanguageVersion:   os.Getenv(EnvLanguageVersion),
+		Kind:              os.Getenv(EnvKind),
+		DocumentationMode: os.Getenv(EnvDocumentationMode),
+	}
+	if s := os.Getenv(EnvDefines); s != "" {
+		opts.Defines = splitDefines(s)
+	}
+	opts.Trivia, _ = strconv.ParseBool(os.Getenv(EnvTrivia))
+	return opts
+}
+
+// splitDefines splits a list of preprocessor symbols separated by semicolons or commas.
+func splitDefines(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ','
+	})
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// isScript checks if the file name has the extension of C# scripts.
+func isScript(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ScriptExt)
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a context with parse options for a specific request.
+// Non-empty fields override options configured for the driver.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// OptionsFrom returns parse options stored in the context by WithOptions.
+func OptionsFrom(ctx context.Context) (Options, bool) {
+	opts, ok := ctx.Value(optionsKey{}).(Options)
+	return opts, ok
+}
@@ -0,0 +1,53 @@
+package impl
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSplitDefines(t *testing.T) {
+	got := splitDefines("DEBUG;TRACE, NETCOREAPP ;;")
+	exp := []string{"DEBUG", "TRACE", "NETCOREAPP"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected defines: %q", got)
+	}
+}
+
+func TestOptionsMerge(t *testing.T) {
+	def := Options{
+		LanguageVersion: "7.3",
+		Defines:         []string{"DEBUG"},
+	}
+	ctx := WithOptions(context.Background(), Options{
+		Defines: []string{"RELEASE"},
+		Kind:    KindScript,
+	})
+	req, ok := OptionsFrom(ctx)
+	if !ok {
+		t.Fatal("expected options in the context")
+	}
+	got := def.Merge(req)
+	exp := Options{
+		LanguageVersion: "7.3",
+		Defines:         []string{"RELEASE"},
+		Kind:            KindScript,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected options: %+v", got)
+	}
+}
+
+func TestIsScript(t *testing.T) {
+	for name, exp := range map[string]bool{
+		"build.csx":   true,
+		"BUILD.CSX":   true,
+		"Program.cs":  false,
+		"csx/main.cs": false,
+		"":            false,
+	} {
+		if got := isScript(name); got != exp {
+			t.Errorf("unexpected result for %q: %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package impl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+	"github.com/bblfsh/sdk/v3/driver"
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+)
+
+// maxRegionParses is the maximal number of additional parses of a file with different
+// symbols that are used to compute Region.Defines.
+const maxRegionParses = 32
+
+// Region is a branch of a conditional compilation directive: #if, #elif or #else.
+type Region struct {
+	// Directive is a name of the directive that starts the region: "if", "elif" or "else".
+	Directive string
+	// Condition is the condition expression of the directive. It is empty for #else.
+	Condition string
+	// Depth is a nesting level of the directive, starting from zero.
+	Depth int
+	// Active is set if the code in the region is compiled with the given symbols.
+	Active bool
+	// Start is a position of the directive, and End is a position of the next directive
+	// of the same level (#elif, #else or #endif) or the end of the file.
+	Start, End uast.Position
+	// Defines is a list of symbols that makes the region active, or nil if no such list
+	// was found. It can be passed to Options to parse the code of a disabled region.
+	//
+	// Symbols are the same as the given ones, except for symbols used in conditions
+	// of the file. Only the smallest number of such symbols are changed.
+	Defines []string
+}
+
+// ConditionalRegions parses the source and returns all branches of conditional compilation
+// directives in the order of the source. Symbols defined by the parse options of the driver
+// and by the options from the context are used to check which regions are active.
+//
+// Conditions are evaluated by the native parser. To find Defines of disabled regions,
+// the file is parsed again with different sets of symbols.
+//
+// The file is parsed the same way as by Parse, thus syntax errors are not reported,
+// unless the parser failed to produce a tree.
+func (d *Driver) ConditionalRegions(ctx context.Context, src string, filename string) ([]Region, error) {
+	popts := d.opts
+	if isScript(filename) {
+		popts.Kind = KindScript
+	}
+	if o, ok := OptionsFrom(ctx); ok {
+		popts = popts.Merge(o)
+	}
+	// the text of trivia is not used
+	popts.Trivia = false
+	parse := func(defines []string) (nodes.Node, error) {
+		opts := popts
+		opts.Defines = defines
+		ast, err := d.native.ParseWithOptions(ctx, src, opts)
+		if driver.ErrDriverFailure.Is(err) {
+			return nil, err
+		} else if ast == nil {
+			return nil, driver.ErrSyntax.Wrap(diagnostics(src, err))
+		}
+		return ast, nil
+	}
+	return conditionalRegions(src, popts.Defines, parse)
+}
+
+// directiveNames maps native types of conditional compilation directives to their names.
+var directiveNames = map[string]string{
+	"IfDirectiveTrivia":    "if",
+	"ElifDirectiveTrivia":  "elif",
+	"ElseDirectiveTrivia":  "else",
+	"EndIfDirectiveTrivia": "endif",
+}
+
+// directive is a conditional compilation directive found in the native AST.
+type directive struct {
+	// Name is a directive name without the "#", for example "if" or "endif".
+	Name string
+	// Condition is the condition expression of #if and #elif.
+	Condition string
+	// Symbols is a list of symbols used in the condition.
+	Symbols []string
+	// Taken is set if the directive is active and the code after it is compiled.
+	Taken bool
+	// Offset is an UTF-16 offset of the directive.
+	Offset uint32
+}
+
+// conditionalRegions parses the file with the given symbols and returns its regions. Disabled
+// regions are activated by parsing the file with a different set of symbols.
+func conditionalRegions(src string, defines []string, parse func(defines []string) (nodes.Node, error)) ([]Region, error) {
+	ast, err := parse(defines)
+	if err != nil {
+		return nil, err
+	}
+	dirs := directives(ast)
+	regions, err := regionsOf(src, dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// find symbols that activate disabled regions
+	var syms []string
+	seen := make(map[string]bool)
+	disabled := 0
+	for i, r := range regions {
+		if r.Active {
+			regions[i].Defines = append([]string{}, defines...)
+		} else {
+			disabled++
+		}
+	}
+	for _, d := range dirs {
+		for _, s := range d.Symbols {
+			if !seen[s] {
+				seen[s] = true
+				syms = append(syms, s)
+			}
+		}
+	}
+	sort.Strings(syms)
+	base := symbolSet(defines)
+	parses := 0
+	// check all combinations of changed symbols, starting from the smallest one
+	for k := 1; k <= len(syms) && disabled > 0 && parses < maxRegionParses && err == nil; k++ {
+		subsets(len(syms), k, func(idx []int) bool {
+			set := make(map[string]bool, len(base)+len(idx))
+			for s := range base {
+				set[s] = true
+			}
+			for _, i := range idx {
+				if s := syms[i]; set[s] {
+					delete(set, s)
+				} else {
+					set[s] = true
+				}
+			}
+			alt := changeSymbols(defines, syms, set)
+			parses++
+			var ast nodes.Node
+			ast, err = parse(alt)
+			if err != nil {
+				return false
+			}
+			var altRegions []Region
+			altRegions, err = regionsOf(src, directives(ast))
+			if err != nil {
+				return false
+			}
+			for i, r := range altRegions {
+				if i < len(regions) && r.Active && regions[i].Defines == nil {
+					regions[i].Defines = alt
+					disabled--
+				}
+			}
+			return disabled > 0 && parses < maxRegionParses
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// subsets calls fn for all subsets of k indexes from the range [0, n), until fn returns false.
+func subsets(n, k int, fn func(idx []int) bool) {
+	idx := make([]int, k)
+	var next func(i, from int) bool
+	next = func(i, from int) bool {
+		if i == k {
+			return fn(idx)
+		}
+		for j := from; j <= n-(k-i); j++ {
+			idx[i] = j
+			if !next(i+1, j+1) {
+				return false
+			}
+		}
+		return true
+	}
+	next(0, 0)
+}
+
+// changeSymbols returns a copy of defines with symbols from syms set according to the set.
+func changeSymbols(defines, syms []string, set map[string]bool) []string {
+	out := make([]string, 0, len(defines))
+	changed := make(map[string]bool, len(syms))
+	for _, s := range syms {
+		changed[s] = true
+	}
+	for _, s := range defines {
+		if !changed[s] || set[s] {
+			out = append(out, s)
+		}
+	}
+	cur := symbolSet(out)
+	for _, s := range syms {
+		if set[s] && !cur[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// symbolSet converts a list of symbols to a set.
+func symbolSet(defines []string) map[string]bool {
+	m := make(map[string]bool, len(defines))
+	for _, s := range defines {
+		m[s] = true
+	}
+	return m
+}
+
+// directives returns all conditional compilation directives of the native AST in the order
+// of the source. The native driver evaluates conditions and sets IsActive and BranchTaken
+// fields of #if, #elif and #else directives.
+func directives(ast nodes.Node) []directive {
+	var dirs []directive
+	nodes.WalkPreOrder(ast, func(n nodes.Node) bool {
+		obj, ok := n.(nodes.Object)
+		if !ok {
+			return true
+		}
+		if obj["IsDirective"] != nodes.Bool(true) {
+			return true
+		}
+		name, ok := directiveNames[uast.TypeOf(obj)]
+		if !ok {
+			return false
+		}
+		span, _ := obj["Span"].(nodes.Object)
+		start, ok := span["Start"].(nodes.Int)
+		if !ok {
+			return false
+		}
+		d := directive{
+			Name:   name,
+			Taken:  obj["IsActive"] == nodes.Bool(true) && obj["BranchTaken"] == nodes.Bool(true),
+			Offset: uint32(start),
+		}
+		if cond, ok := obj["Condition"].(nodes.String); ok {
+			d.Condition = string(cond)
+		}
+		syms, _ := obj["Symbols"].(nodes.Array)
+		for _, s := range syms {
+			if s, ok := s.(nodes.String); ok {
+				d.Symbols = append(d.Symbols, string(s))
+			}
+		}
+		dirs = append(dirs, d)
+		return false
+	})
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return dirs[i].Offset < dirs[j].Offset
+	})
+	return dirs
+}
+
+// regionsOf converts directives to regions.
+func regionsOf(src string, dirs []directive) ([]Region, error) {
+	// native positions are UTF-16 offsets, convert all of them at once
+	arr := make(nodes.Array, 0, len(dirs)+1)
+	for _, d := range dirs {
+		arr = append(arr, uast.Position{Offset: d.Offset}.ToObject())
+	}
+	arr = append(arr, uast.Position{Offset: uint32(utf16Len(src))}.ToObject())
+	n, err := normalizer.FromUTF16Offset{}.OnCode(src).Do(arr)
+	if err != nil {
+		return nil, err
+	}
+	arr = n.(nodes.Array)
+	pos := make([]uast.Position, 0, len(arr))
+	for _, sub := range arr {
+		p := uast.AsPosition(sub.(nodes.Object))
+		if p == nil {
+			return nil, fmt.Errorf("cannot convert directive position")
+		}
+		pos = append(pos, *p)
+	}
+	end := pos[len(pos)-1]
+
+	var (
+		regions []Region
+		// indexes of the current region of each level
+		stack []int
+	)
+	for i, d := range dirs {
+		if d.Name != "if" && len(stack) == 0 {
+			// unexpected directive; reported as syntax error by the parser
+			continue
+		}
+		switch d.Name {
+		case "if":
+			stack = append(stack, -1)
+		default:
+			regions[stack[len(stack)-1]].End = pos[i]
+		}
+		if d.Name == "endif" {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		stack[len(stack)-1] = len(regions)
+		regions = append(regions, Region{
+			Directive: d.Name,
+			Condition: d.Condition,
+			Depth:     len(stack) - 1,
+			Active:    d.Taken,
+			Start:     pos[i],
+			End:       end,
+		})
+	}
+	return regions, nil
+}
+
+// utf16Len returns the length of the string in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
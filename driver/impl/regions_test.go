@@ -0,0 +1,66 @@
+package impl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubsets(t *testing.T) {
+	var got [][]int
+	subsets(4, 2, func(idx []int) bool {
+		got = append(got, append([]int{}, idx...))
+		return len(got) < 5
+	})
+	exp := [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected subsets: %v", got)
+	}
+}
+
+func TestChangeSymbols(t *testing.T) {
+	set := symbolSet([]string{"NETCOREAPP", "NET48", "TRACE"})
+	got := changeSymbols([]string{"NETCOREAPP", "DEBUG", "TRACE"}, []string{"DEBUG", "NET48"}, set)
+	exp := []string{"NETCOREAPP", "TRACE", "NET48"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected symbols: %v", got)
+	}
+}
+
+func TestRegionsOf(t *testing.T) {
+	const src = "#if A\n#if B\n#endif\n#else\n#endif\n#else\n"
+	dirs := []directive{
+		{Name: "if", Condition: "A", Taken: true, Offset: 0},
+		{Name: "if", Condition: "B", Offset: 6},
+		{Name: "endif", Offset: 12},
+		{Name: "else", Offset: 19},
+		{Name: "endif", Offset: 25},
+		// unexpected directive
+		{Name: "else", Offset: 32},
+	}
+	regions, err := regionsOf(src, dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type region struct {
+		Directive, Condition string
+		Depth                int
+		Active               bool
+		Start, End           int
+	}
+	exp := []region{
+		{Directive: "if", Condition: "A", Active: true, Start: 1, End: 4},
+		{Directive: "if", Condition: "B", Depth: 1, Start: 2, End: 3},
+		{Directive: "else", Start: 4, End: 5},
+	}
+	got := make([]region, 0, len(regions))
+	for _, r := range regions {
+		got = append(got, region{
+			Directive: r.Directive, Condition: r.Condition,
+			Depth: r.Depth, Active: r.Active,
+			Start: int(r.Start.Line), End: int(r.End.Line),
+		})
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected regions:\n%+v\nvs\n%+v", got, exp)
+	}
+}
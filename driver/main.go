@@ -1,12 +1,29 @@
 package main
 
 import (
-	_ "github.com/bblfsh/csharp-driver/driver/impl"
+	"os"
+	"strconv"
+
+	"github.com/bblfsh/csharp-driver/driver/impl"
 	"github.com/bblfsh/csharp-driver/driver/normalizer"
 
+	"github.com/bblfsh/sdk/v3/driver/manifest"
 	"github.com/bblfsh/sdk/v3/driver/server"
 )
 
 func main() {
-	server.Run(normalizer.Transforms)
+	m, err := manifest.Load(server.ManifestLocation)
+	if err != nil {
+		panic(err)
+	}
+	tr := normalizer.Transforms
+	if ok, _ := strconv.ParseBool(os.Getenv("CSHARP_REGIONS")); ok {
+		tr = normalizer.TransformsWithRegions
+	}
+	// default parse options are configured with environment variables
+	d := impl.NewDriver(impl.NewNative(""), m, tr, impl.OptionsFromEnv())
+	s := server.NewServer(d)
+	if err := s.Start(); err != nil {
+		panic(err)
+	}
 }
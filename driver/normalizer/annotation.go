@@ -27,16 +27,21 @@ var Native = Transformers([][]Transformer{
 //
 // https://godoc.org/github.com/bblfsh/sdk/uast/transformer/positioner
 var PreprocessCode = []CodeTransformer{
-	positioner.FromUTF16Offset(),
+	FromUTF16Offset{},
 	positioner.TokenFromSource{
-		Types: []string{
-			"SingleLineCommentTrivia",
-			"SingleLineDocumentationCommentTrivia",
-			"MultiLineCommentTrivia",
-		},
+		Types: sourceTokenTypes,
 	},
 }
 
+// sourceTokenTypes is a list of native node types that get a token from the source code.
+var sourceTokenTypes = []string{
+	"SingleLineCommentTrivia",
+	"SingleLineDocumentationCommentTrivia",
+	"MultiLineCommentTrivia",
+	"MultiLineDocumentationCommentTrivia",
+	"RegionDirectiveTrivia",
+}
+
 // Annotations is a list of individual transformations to annotate a native AST with roles.
 var Annotations = []Mapping{
 
@@ -44,11 +49,16 @@ var Annotations = []Mapping{
 	AnnotateType("CompilationUnit", nil, role.File, role.Module),
 	AnnotateType("Block", nil, role.Block),
 	AnnotateType("LockStatement", nil, role.Statement, role.Block, role.Incomplete),
+	// using statements and declarations (using var x = ...;) are resource scopes, not imports
+	AnnotateType("UsingStatement", nil, role.Statement, role.Block, role.Scope),
 	AnnotateType("CheckedStatement_UncheckedStatement", nil, role.Block, role.Statement, role.Incomplete),
 	AnnotateType("CheckedExpression_UncheckedExpression", nil, role.Block, role.Expression, role.Incomplete),
 	AnnotateType("UnsafeStatement", nil, role.Block, role.Statement, role.Incomplete),
 	AnnotateType("FixedStatement", nil, role.Declaration, role.Incomplete),
 	AnnotateType("NamespaceDeclaration", nil, role.Block, role.Scope),
+	AnnotateType("FileScopedNamespaceDeclaration", nil, role.Block, role.Scope),
+	// produced by the normalizer for block and file-scoped namespace declarations
+	AnnotateType("Namespace", nil, role.Block, role.Scope),
 	AnnotateType("EventFieldDeclaration", nil, role.Declaration, role.Variable),
 	AnnotateType("EventDeclaration", nil, role.Declaration, role.Variable),
 	AnnotateType("ArrayType", nil, role.List, role.Type, role.Incomplete),
@@ -76,11 +86,12 @@ var Annotations = []Mapping{
 	AnnotateType("MemberBindingExpression", nil, role.Expression, role.Qualified),
 	AnnotateType("IncompleteMember", nil, role.Function, role.Incomplete),
 	AnnotateType("SkippedTokensTrivia", nil, role.Incomplete),
-	AnnotateType("AttributeList", nil, role.List, role.Incomplete),
-	AnnotateType("AttributeArgumentList", nil, role.List, role.Argument, role.Incomplete),
-	AnnotateType("Attribute", nil, role.Incomplete),
-	AnnotateType("AttributeArgument", nil, role.Argument, role.Incomplete),
-	AnnotateType("AttributeTargetSpecifier", nil, role.Argument, role.Incomplete),
+	AnnotateType("AttributeList", nil, role.Annotation, role.List),
+	AnnotateType("AttributeArgumentList", nil, role.Annotation, role.List, role.Argument),
+	// the normalizer also sets a Target and structured Arguments
+	AnnotateType("Attribute", nil, role.Annotation),
+	AnnotateType("AttributeArgument", nil, role.Annotation, role.Argument),
+	AnnotateType("AttributeTargetSpecifier", nil, role.Annotation, role.Incomplete),
 	AnnotateType("PointerType", nil, role.Type, role.Incomplete),
 
 	// Literals and Literal tokens
@@ -140,6 +151,7 @@ var Annotations = []Mapping{
 	AnnotateType("CloseParenToken", nil, role.Incomplete),
 	AnnotateType("ColonToken", nil, role.Incomplete),
 	AnnotateType("CommaToken", nil, role.Incomplete),
+	AnnotateType("DotDotToken", nil, role.Incomplete),
 	AnnotateType("DotToken", nil, role.Incomplete),
 	AnnotateType("EndOfFileToken", nil, role.Noop, role.Incomplete),
 	AnnotateType("EqualsEqualsToken", nil, role.Operator, role.Relational, role.Equal),
@@ -178,11 +190,12 @@ var Annotations = []Mapping{
 	AnnotateType("SlashEqualsToken", nil, role.Operator, role.Arithmetic, role.Divide, role.Equal),
 	AnnotateType("SlashToken", nil, role.Operator, role.Arithmetic, role.Divide),
 	AnnotateType("TildeToken", nil, role.Operator, role.Unary, role.Bitwise, role.Not),
+	AnnotateType("UnderscoreToken", nil, role.Incomplete),
 
 	// Keywords: we probably need a role.Keyword for languages like this that add a specific node for them
 	AnnotateType("None", nil, role.Incomplete), // e.g. SemiColonField or lines not ended in ;
-	AnnotateType("UsingKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Import, role.Incomplete),
 	AnnotateType("AbstractKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
+	AnnotateType("AndKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.And),
 	AnnotateType("AddKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("AsKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("AscendingKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
@@ -217,6 +230,7 @@ var Annotations = []Mapping{
 	AnnotateType("GotoKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Goto),
 	AnnotateType("IfKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.If),
 	AnnotateType("ImplicitKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
+	AnnotateType("InitKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("InKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("IntKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Number, role.Declaration),
 	AnnotateType("InterfaceKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
@@ -226,9 +240,11 @@ var Annotations = []Mapping{
 	AnnotateType("LongKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Number, role.Declaration),
 	AnnotateType("NamespaceKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Block),
 	AnnotateType("NewKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Instance),
+	AnnotateType("NotKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Not),
 	AnnotateType("NullKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Null, role.Literal),
 	AnnotateType("ObjectKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Type, role.Incomplete),
 	AnnotateType("OperatorKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
+	AnnotateType("OrKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Or),
 	AnnotateType("OrderByKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("OverrideKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("ParamsKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
@@ -259,12 +275,15 @@ var Annotations = []Mapping{
 	AnnotateType("UncheckedKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("UnsafeKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("UsingKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
+	AnnotateType("VarKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("VirtualKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("VoidKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("VolatileKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("WhereKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("WhileKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.While),
 	AnnotateType("YieldKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Return, role.Incomplete),
+	AnnotateType("RecordKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Type, role.Declaration),
+	AnnotateType("WithKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("RefKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
 	AnnotateType("CatchKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Catch, role.Incomplete),
 	AnnotateType("WhenKeyword", FieldRoles{"Value": {Rename: uast.KeyToken}}, role.Incomplete),
@@ -362,6 +381,21 @@ var Annotations = []Mapping{
 	AnnotateType("IsPatternExpression", nil, role.Expression, role.Condition, role.Equal),
 	AnnotateType("ConstantPattern", nil, role.Value, role.Incomplete),
 	AnnotateType("DeclarationPattern", nil, role.Expression, role.Incomplete),
+	AnnotateType("TypePattern", nil, role.Type, role.Condition, role.Incomplete),
+	AnnotateType("VarPattern", nil, role.Declaration, role.Variable, role.Incomplete),
+	AnnotateType("DiscardPattern", nil, role.Default, role.Incomplete),
+	AnnotateType("ParenthesizedPattern", nil, role.Expression, role.Incomplete),
+	AnnotateType("RelationalPattern", nil, role.Expression, role.Relational, role.Condition),
+	AnnotateType("BinaryPattern_AndPattern", nil, role.Expression, role.Binary, role.Relational, role.And, role.Condition),
+	AnnotateType("BinaryPattern_OrPattern", nil, role.Expression, role.Binary, role.Relational, role.Or, role.Condition),
+	AnnotateType("UnaryPattern_NotPattern", nil, role.Expression, role.Unary, role.Relational, role.Not, role.Condition),
+	AnnotateType("RecursivePattern", nil, role.Expression, role.Condition, role.Incomplete),
+	AnnotateType("PositionalPatternClause", nil, role.List, role.Incomplete),
+	AnnotateType("PropertyPatternClause", nil, role.List, role.Incomplete),
+	AnnotateType("Subpattern", nil, role.Expression, role.Condition, role.Incomplete),
+	AnnotateType("ExpressionColon", nil, role.Name, role.Incomplete),
+	AnnotateType("ListPattern", nil, role.List, role.Expression, role.Condition, role.Incomplete),
+	AnnotateType("SlicePattern", nil, role.List, role.Incomplete),
 	AnnotateType("TypeOfExpression", nil, role.Expression, role.Incomplete),
 	AnnotateType("DefaultExpression", nil, role.Expression, role.Value, role.Default),
 	AnnotateType("DefaultLiteralExpression", nil, role.Expression, role.Value, role.Literal, role.Default),
@@ -380,13 +414,19 @@ var Annotations = []Mapping{
 	// Other expressions
 	AnnotateType("DeclarationExpression", nil, role.Declaration, role.Expression),
 	AnnotateType("SingleVariableDesignation", nil, role.Declaration, role.Name, role.Variable),
+	AnnotateType("DiscardDesignation", nil, role.Declaration, role.Incomplete),
+	AnnotateType("ParenthesizedVariableDesignation", nil, role.Declaration, role.List, role.Variable),
 	AnnotateType("ParenthesizedExpression", nil, role.Expression),
+	// copy of a record with modified properties: p with { X = 1 }
+	AnnotateType("WithExpression", nil, role.Expression, role.Instance, role.Assignment, role.Incomplete),
+	AnnotateType("WithInitializerExpression", nil, role.Instance, role.Assignment, role.Block, role.Incomplete),
 	AnnotateType("LocalDeclarationStatement", nil, role.Declaration, role.Expression),
 	AnnotateType("VariableDeclaration", nil, role.Declaration, role.Variable, role.Expression),
 	AnnotateType("VariableDeclarator", nil, role.Declaration, role.Variable, role.Right),
 	AnnotateType("NameEquals", nil, role.Assignment, role.Right),
 	AnnotateType("EqualsValueClause", nil, role.Assignment, role.Right),
 	AnnotateType("ExpressionStatement", nil, role.Expression, role.Statement),
+	AnnotateType("GlobalStatement", nil, role.Statement),
 	AnnotateType("ThrowStatement", nil, role.Statement, role.Throw),
 	AnnotateType("ThrowExpression", nil, role.Expression, role.Throw),
 	AnnotateType("AddAssignmentExpression", nil, role.Assignment, role.Expression, role.Add),
@@ -404,13 +444,21 @@ var Annotations = []Mapping{
 	AnnotateType("ClassDeclaration", nil, role.Type, role.Declaration),
 	AnnotateType("InterfaceDeclaration", nil, role.Type, role.Declaration),
 	AnnotateType("ExplicitInterfaceSpecifier", nil, role.Type, role.Name),
+	// produced by the normalizer for ExplicitInterfaceSpecifier
+	AnnotateType("ExplicitInterface", nil, role.Type, role.Name),
 	AnnotateType("StructDeclaration", nil, role.Type, role.Declaration),
+	AnnotateType("RecordDeclaration", nil, role.Type, role.Declaration),
+	AnnotateType("RecordDeclaration_RecordStructDeclaration", nil, role.Type, role.Declaration),
+	// produced by the normalizer for class, struct, interface and record declarations
+	AnnotateType("TypeDeclaration", nil, role.Type, role.Declaration),
 	AnnotateType("EnumDeclaration", nil, role.Type, role.Declaration, role.Enumeration),
 	AnnotateType("EnumMemberDeclaration", nil, role.Type, role.Declaration, role.Enumeration, role.Value),
 	AnnotateType("TupleExpression", nil, role.Value, role.List, role.Expression),
 	AnnotateType("TupleType", nil, role.Declaration, role.List, role.Expression),
 	AnnotateType("TupleElement", nil, role.List, role.Value),
 	AnnotateType("BaseConstructorInitializer", nil, role.Function, role.Declaration, role.Argument, role.Base, role.Initialization, role.Incomplete),
+	// record B(int X) : A(X)
+	AnnotateType("PrimaryConstructorBaseType", nil, role.Function, role.Call, role.Argument, role.Base, role.Initialization, role.Incomplete),
 	AnnotateType("BaseList", nil, role.Base, role.List),
 	AnnotateType("SimpleBaseType", nil, role.Base, role.Type),
 	AnnotateType("ConstructorDeclaration", nil, role.Type, role.Function, role.Declaration, role.This),
@@ -418,9 +466,14 @@ var Annotations = []Mapping{
 	AnnotateType("FieldDeclaration", nil, role.Type, role.Declaration, role.Variable),
 	AnnotateType("MethodDeclaration", nil, role.Type, role.Function, role.Declaration),
 	AnnotateType("UsingDirective", nil, role.Import, role.Statement),
+	// #r and #load directives of C# scripts
+	AnnotateType("ReferenceDirectiveTrivia", nil, role.Import, role.Incomplete),
+	AnnotateType("LoadDirectiveTrivia", nil, role.Import, role.Incomplete),
 	AnnotateType("IdentifierName", nil, role.Identifier),
 	AnnotateType("ParameterList", nil, role.Function, role.Declaration, role.Argument, role.List),
 	AnnotateType("Parameter", nil, role.Function, role.Declaration, role.Argument),
+	// produced by the normalizer for parameters passed by reference (ref, out, in)
+	AnnotateType("ByRefType", nil, role.Type, role.Incomplete),
 	AnnotateType("ReturnStatement", nil, role.Statement, role.Return),
 	AnnotateType("YieldStatement_YieldReturnStatement", nil, role.Statement, role.Return, role.Incomplete),
 	AnnotateType("YieldStatement_YieldBreakStatement", nil, role.Statement, role.Break, role.Incomplete),
@@ -430,6 +483,9 @@ var Annotations = []Mapping{
 	AnnotateType("ThisExpression", nil, role.Expression, role.This),
 	AnnotateType("TypeParameterConstraintClause", nil, role.Function, role.Declaration, role.Argument, role.Condition, role.Incomplete),
 	AnnotateType("TypeConstraint", nil, role.Function, role.Declaration, role.Argument, role.Condition, role.Type, role.Name, role.Incomplete),
+	// produced by the normalizer for type parameters and their constraints
+	AnnotateType("GenericParameter", nil, role.Type, role.Declaration, role.Argument),
+	AnnotateType("GenericConstraint", nil, role.Type, role.Condition, role.Incomplete),
 	AnnotateType("ObjectInitializerExpression", nil, role.Type, role.Instance, role.Call, role.Block),
 	AnnotateType("PropertyDeclaration", nil, role.Function, role.Value, role.Declaration, role.Incomplete),
 	AnnotateType("AccessorList", nil, role.List, role.Function, role.Declaration, role.Incomplete),
@@ -437,6 +493,11 @@ var Annotations = []Mapping{
 	AnnotateType("RemoveAccessorDeclaration", nil, role.Function, role.Declaration, role.Value, role.Incomplete),
 	AnnotateType("GetAccessorDeclaration", nil, role.Function, role.Declaration, role.Value, role.Incomplete),
 	AnnotateType("SetAccessorDeclaration", nil, role.Function, role.Declaration, role.Value, role.Incomplete),
+	AnnotateType("InitAccessorDeclaration", nil, role.Function, role.Declaration, role.Value, role.Initialization, role.Incomplete),
+	// produced by the normalizer for property and event declarations
+	AnnotateType("BasePropertyDeclaration", nil, role.Declaration, role.Variable),
+	// produced by the normalizer for accessors without a body
+	AnnotateType("AccessorDeclaration", nil, role.Declaration, role.Incomplete),
 	AnnotateType("ArrowExpressionClause", nil, role.Function, role.Body, role.Block),
 	// inner function
 	AnnotateType("LocalFunctionStatement", nil, role.Function, role.Declaration, role.Scope, role.Incomplete),
@@ -445,6 +506,7 @@ var Annotations = []Mapping{
 	// indexer declaration [arguments]
 	AnnotateType("BracketedParameterList", nil, role.Function, role.Declaration, role.List, role.Argument),
 	AnnotateType("ConversionOperatorDeclaration", nil, role.Function, role.Declaration, role.Operator),
+	AnnotateType("OperatorDeclaration", nil, role.Function, role.Declaration, role.Operator),
 	AnnotateType("DelegateDeclaration", nil, role.Function, role.Declaration, role.Incomplete),
 	AnnotateType("RefType", nil, role.Argument, role.Incomplete),
 	AnnotateType("LiteralExpression_ArgListExpression", nil, role.ArgsList),
@@ -453,6 +515,8 @@ var Annotations = []Mapping{
 	AnnotateType("WhileStatement", nil, role.While, role.Statement),
 	AnnotateType("DoStatement", nil, role.DoWhile, role.Statement),
 	AnnotateType("SwitchStatement", nil, role.Switch, role.Statement),
+	AnnotateType("SwitchExpression", nil, role.Switch, role.Expression),
+	AnnotateType("SwitchExpressionArm", nil, role.Switch, role.Case, role.Condition),
 	AnnotateType("WhenClause", nil, role.Expression, role.Case, role.Condition),
 	AnnotateType("SwitchSection", nil, role.Switch, role.Block),
 	AnnotateType("CaseSwitchLabel", nil, role.Switch, role.Case, role.Name),
@@ -484,6 +548,8 @@ var Annotations = []Mapping{
 	AnnotateType("PragmaChecksumDirectiveTrivia", nil, role.Noop, role.Incomplete),
 	AnnotateType("RegionDirectiveTrivia", nil, role.Block, role.Incomplete),
 	AnnotateType("EndRegionDirectiveTrivia", nil, role.Block, role.Noop, role.Incomplete),
+	// produced by RegionGroups for members between #region and #endregion
+	AnnotateType("Region", nil, role.Block, role.Incomplete),
 	AnnotateType("IfDirectiveTrivia", nil, role.If, role.Block, role.Incomplete),
 	AnnotateType("ElifDirectiveTrivia", nil, role.Else, role.If, role.Block, role.Incomplete),
 	AnnotateType("ElseDirectiveTrivia", nil, role.Else, role.Block, role.Incomplete),
@@ -496,4 +562,10 @@ var Annotations = []Mapping{
 	AnnotateType("SingleLineCommentTrivia", nil, role.Comment, role.Noop),
 	AnnotateType("SingleLineDocumentationCommentTrivia", nil, role.Comment, role.Noop, role.Documentation),
 	AnnotateType("MultiLineCommentTrivia", nil, role.Comment, role.Noop),
+	AnnotateType("MultiLineDocumentationCommentTrivia", nil, role.Comment, role.Noop, role.Documentation),
+	// produced by the normalizer for documentation comments, see opDocumentation
+	AnnotateType("DocumentationComment", nil, role.Comment, role.Noop, role.Documentation),
+	AnnotateType("DocumentationParam", nil, role.Documentation, role.Argument),
+	AnnotateType("DocumentationException", nil, role.Documentation, role.Throw),
+	AnnotateType("DocumentationReference", nil, role.Documentation, role.Incomplete),
 }
@@ -0,0 +1,295 @@
+package normalizer
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	. "github.com/bblfsh/sdk/v3/uast/transformer"
+)
+
+// docMapping converts a documentation comment trivia to a DocumentationComment node.
+//
+// The node holds the raw text as a uast:Comment, and the content of well-known XML tags
+// of the comment, see opDocumentation.
+func docMapping(typ string, tokens [2]string, block bool) Mapping {
+	return Map(
+		Obj{
+			uast.KeyType:  String(typ),
+			uast.KeyPos:   Var("pos"),
+			uast.KeyToken: commentText(tokens, "text"),
+			"IsDirective": Bool(false),
+		},
+		opDocumentation{
+			text: Var("text_text"),
+			sub: Obj{
+				uast.KeyType: String("DocumentationComment"),
+				uast.KeyPos:  Var("pos"),
+				"Comment":    CommentNode(block, "text", Var("pos")),
+			},
+		},
+	)
+}
+
+var _ Op = opDocumentation{}
+
+// opDocumentation parses the text of the documentation comment and adds the following
+// fields to the node constructed by the sub-operation:
+//
+//	Summary, Remarks, Returns, Value - text of the corresponding tags, or nil
+//	Params, TypeParams - DocumentationParam nodes for param and typeparam tags
+//	Exceptions - DocumentationException nodes for exception tags
+//	References - DocumentationReference nodes for see and seealso tags on any level
+//
+// Inline tags like <c> or <paramref> are replaced with their text or name, and whitespaces
+// are collapsed. If the comment has no summary tag, the text outside of tags is used instead.
+// If the comment is not a valid XML, only the raw text is available.
+//
+// In the reverse direction these fields are ignored, and the comment is restored from
+// the raw text only.
+type opDocumentation struct {
+	text Op
+	sub  Op
+}
+
+func (op opDocumentation) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+func (op opDocumentation) Check(st *State, n nodes.Node) (bool, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	// all fields are derived from the raw text of the comment; drop them
+	obj = obj.CloneObject()
+	for k := range docFields(nil) {
+		delete(obj, k)
+	}
+	return op.sub.Check(st, obj)
+}
+
+func (op opDocumentation) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return nil, ErrExpectedObject.New(n)
+	}
+	tn, err := op.text.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	text, ok := tn.(nodes.String)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.String(""), tn)
+	}
+	obj = obj.CloneObject()
+	for k, v := range docFields(parseDoc(string(text))) {
+		obj[k] = v
+	}
+	return obj, nil
+}
+
+// docElem is an XML element of the documentation comment.
+type docElem struct {
+	name  string
+	attrs map[string]string
+	// nodes are either strings or *docElem
+	nodes []interface{}
+}
+
+// parseDoc parses the text of the documentation comment. It returns nil if the text
+// is not a valid XML.
+func parseDoc(text string) *docElem {
+	dec := xml.NewDecoder(strings.NewReader("<doc>" + text + "</doc>"))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	var (
+		root  *docElem
+		stack []*docElem
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			e := &docElem{name: strings.ToLower(tok.Name.Local), attrs: make(map[string]string)}
+			for _, a := range tok.Attr {
+				e.attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			if root == nil {
+				root = e
+			} else {
+				cur := stack[len(stack)-1]
+				cur.nodes = append(cur.nodes, e)
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				return nil
+			}
+			cur := stack[len(stack)-1]
+			cur.nodes = append(cur.nodes, string(tok))
+		}
+	}
+	if len(stack) != 0 {
+		return nil
+	}
+	return root
+}
+
+// text returns the text of the element with inline tags replaced by their text,
+// and all whitespaces collapsed.
+func (e *docElem) text() string {
+	var buf strings.Builder
+	e.writeText(&buf)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func (e *docElem) writeText(buf *strings.Builder) {
+	for _, sub := range e.nodes {
+		switch sub := sub.(type) {
+		case string:
+			buf.WriteString(sub)
+		case *docElem:
+			if len(sub.nodes) == 0 {
+				// <see cref="T"/>, <paramref name="a"/>, etc
+				for _, k := range []string{"cref", "href", "langword", "name"} {
+					if v, ok := sub.attrs[k]; ok {
+						buf.WriteString(v)
+						break
+					}
+				}
+				continue
+			}
+			buf.WriteByte(' ')
+			sub.writeText(buf)
+			buf.WriteByte(' ')
+		}
+	}
+}
+
+// docTextFields maps tags that contain only text to fields of DocumentationComment.
+var docTextFields = map[string]string{
+	"summary": "Summary",
+	"remarks": "Remarks",
+	"returns": "Returns",
+	"value":   "Value",
+}
+
+// docFields converts the root element of the documentation comment to node fields.
+func docFields(root *docElem) nodes.Object {
+	obj := nodes.Object{
+		"Summary":    nil,
+		"Remarks":    nil,
+		"Returns":    nil,
+		"Value":      nil,
+		"Params":     nodes.Array{},
+		"TypeParams": nodes.Array{},
+		"Exceptions": nodes.Array{},
+		"References": nodes.Array{},
+	}
+	if root == nil {
+		return obj
+	}
+	var (
+		params, typeParams, excs, refs nodes.Array
+		// text outside of tags
+		free strings.Builder
+	)
+	for _, sub := range root.nodes {
+		e, ok := sub.(*docElem)
+		if !ok {
+			free.WriteString(sub.(string))
+			continue
+		}
+		switch e.name {
+		case "summary", "remarks", "returns", "value":
+			key := docTextFields[e.name]
+			if obj[key] == nil {
+				obj[key] = nodes.String(e.text())
+			}
+		case "param", "typeparam":
+			p := nodes.Object{
+				uast.KeyType: nodes.String("DocumentationParam"),
+				"Name":       nodes.String(e.attrs["name"]),
+				"Text":       nodes.String(e.text()),
+			}
+			if e.name == "param" {
+				params = append(params, p)
+			} else {
+				typeParams = append(typeParams, p)
+			}
+		case "exception":
+			excs = append(excs, nodes.Object{
+				uast.KeyType: nodes.String("DocumentationException"),
+				"Cref":       nodes.String(e.attrs["cref"]),
+				"Text":       nodes.String(e.text()),
+			})
+		}
+	}
+	root.walk(func(e *docElem) {
+		if e.name != "see" && e.name != "seealso" {
+			return
+		}
+		cref, ok1 := e.attrs["cref"]
+		href, ok2 := e.attrs["href"]
+		if !ok1 && !ok2 {
+			// <see langword="null"/>
+			return
+		}
+		ref := nodes.Object{
+			uast.KeyType: nodes.String("DocumentationReference"),
+			"Kind":       nodes.String(e.name),
+			"Cref":       nil,
+			"Href":       nil,
+			"Text":       nodes.String(e.text()),
+		}
+		if ok1 {
+			ref["Cref"] = nodes.String(cref)
+		}
+		if ok2 {
+			ref["Href"] = nodes.String(href)
+		}
+		refs = append(refs, ref)
+	})
+	if obj["Summary"] == nil {
+		if s := strings.Join(strings.Fields(free.String()), " "); s != "" {
+			obj["Summary"] = nodes.String(s)
+		}
+	}
+	for k, arr := range map[string]nodes.Array{
+		"Params": params, "TypeParams": typeParams,
+		"Exceptions": excs, "References": refs,
+	} {
+		if len(arr) != 0 {
+			obj[k] = arr
+		}
+	}
+	return obj
+}
+
+// walk calls the function for all elements in the tree in the document order.
+func (e *docElem) walk(fnc func(e *docElem)) {
+	for _, sub := range e.nodes {
+		if sub, ok := sub.(*docElem); ok {
+			fnc(sub)
+			sub.walk(fnc)
+		}
+	}
+}
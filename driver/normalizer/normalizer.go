@@ -3,7 +3,9 @@ package normalizer
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/bblfsh/sdk/v3/uast"
 	"github.com/bblfsh/sdk/v3/uast/nodes"
@@ -15,19 +17,21 @@ var Preprocess = Transformers([][]Transformer{
 }...)
 
 var Normalize = Transformers([][]Transformer{
-	{Mappings(
-		// Move the Leading/TrailingTrivia outside of nodes.
-		//
-		// This cannot be inside Normalizers because it should precede any
-		// other transformation.
-		Map(
-			opMoveTrivias{Var("group")},
-			Check(Has{uast.KeyType: String(typeGroup)}, Var("group")),
-		),
-	)},
+	{Mappings(triviaMappings...)},
 	{Mappings(Normalizers...)},
 }...)
 
+// triviaMappings move the Leading/TrailingTrivia outside of nodes.
+//
+// This cannot be inside Normalizers because it should precede any
+// other transformation.
+var triviaMappings = []Mapping{
+	Map(
+		opMoveTrivias{Var("group")},
+		Check(Has{uast.KeyType: String(typeGroup)}, Var("group")),
+	),
+}
+
 var _ Op = opArrHasKeyword{}
 
 type opArrHasKeyword struct {
@@ -80,7 +84,7 @@ func (op opArrHasKeyword) Check(st *State, n nodes.Node) (bool, error) {
 func (op opArrHasKeyword) Construct(st *State, n nodes.Node) (nodes.Node, error) {
 	// first, we will need to read the flag from sub-op
 	// if it's false, we will just pass and array as-is
-	// if it's true, we will synthesize and append a node to it
+	// if it's true, we will synthesize and prepend a node to it
 
 	v, err := op.opHas.Construct(st, nil)
 	if err != nil {
@@ -98,84 +102,382 @@ func (op opArrHasKeyword) Construct(st *State, n nodes.Node) (nodes.Node, error)
 		return n, nil
 	}
 	// synthesize the node
-
-	// TODO(dennwc): synthesize the node once we care about reverse transform
-	//				 see https://github.com/bblfsh/sdk/issues/355
-	return n, nil
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, n)
+	}
+	// keywords are usually declared first, as in "this ref"
+	out := make(nodes.Array, 0, len(arr)+1)
+	out = append(out, nodes.Object{uast.KeyType: nodes.String(op.keyword)})
+	out = append(out, arr...)
+	return out, nil
 }
 
-var _ Op = opArrToChain{}
+var _ Op = opByRef{}
 
-type opArrToChain struct {
-	opMods Op
-	opType Op
-	// TODO(dennwc): maybe whitelist only known modifiers? seen so far:
-	//  			 - RefKeyword
-	//				 - OutKeyword (we should move it to Returns)
+// byRefKeywords maps by-reference parameter modifiers to the kind of a reference.
+var byRefKeywords = map[string]string{
+	"RefKeyword": "ref",
+	"OutKeyword": "out",
+	"InKeyword":  "in",
 }
 
-func (op opArrToChain) Kinds() nodes.Kind {
-	return nodes.KindObject
+// opByRef finds a by-reference modifier (ref, out or in) in an array of parameter modifiers.
+// The kind of the reference (or an empty string) is passed to opKind sub-operation, and
+// the rest of modifiers is passed to opRest.
+type opByRef struct {
+	opKind Op
+	opRest Op
 }
 
-func (op opArrToChain) Check(st *State, n nodes.Node) (bool, error) {
-	// we assert that the passed node is an object and start
-	// checking the Type field recursively
-	// if there is one, we will remove it from the "Type" field
-	// from current node and append it to an array
-	// and we repeat it recursively on the value of the "Type" field
-	var mods nodes.Array
+func (op opByRef) Kinds() nodes.Kind {
+	return nodes.KindArray
+}
 
-	// TODO(dennwc): implement when we will need a reversal
-	//				 see https://github.com/bblfsh/sdk/issues/355
-	if ok, err := op.opType.Check(st, n); err != nil || !ok {
+func (op opByRef) Check(st *State, n nodes.Node) (bool, error) {
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return false, nil
+	}
+	for i, sub := range arr {
+		kind, ok := byRefKeywords[uast.TypeOf(sub)]
+		if !ok {
+			continue
+		}
+		if ok, err := op.opKind.Check(st, nodes.String(kind)); err != nil || !ok {
+			return ok, err
+		}
+		rest := make(nodes.Array, 0, len(arr)-1)
+		rest = append(rest, arr[:i]...)
+		rest = append(rest, arr[i+1:]...)
+		return op.opRest.Check(st, rest)
+	}
+	if ok, err := op.opKind.Check(st, nodes.String("")); err != nil || !ok {
 		return ok, err
 	}
-	return op.opMods.Check(st, mods)
+	return op.opRest.Check(st, n)
 }
 
-func (op opArrToChain) Construct(st *State, n nodes.Node) (nodes.Node, error) {
-	// load two nodes:
-	// - the first one is an array of modifiers (objects)
-	// - the second one is a type node
-	nd, err := op.opMods.Construct(st, nil)
+func (op opByRef) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	nd, err := op.opKind.Construct(st, nil)
 	if err != nil {
 		return nil, err
 	}
-	mods, ok := nd.(nodes.Array)
+	kind, ok := nd.(nodes.String)
 	if !ok {
-		return nil, ErrUnexpectedType.New(nodes.Array{}, nd)
+		return nil, ErrUnexpectedType.New(nodes.String(""), nd)
+	}
+	n, err = op.opRest.Construct(st, n)
+	if err != nil || kind == "" {
+		return n, err
+	}
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, n)
+	}
+	for kw, k := range byRefKeywords {
+		if k != string(kind) {
+			continue
+		}
+		// the reference kind follows "scoped", but precedes other modifiers ("ref readonly")
+		i := 0
+		if len(arr) != 0 && uast.TypeOf(arr[0]) == "ScopedKeyword" {
+			i = 1
+		}
+		out := make(nodes.Array, 0, len(arr)+1)
+		out = append(out, arr[:i]...)
+		out = append(out, nodes.Object{uast.KeyType: nodes.String(kw)})
+		out = append(out, arr[i:]...)
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown kind of reference: %q", kind)
+}
+
+var _ Op = opParamType{}
+
+// opParamType constructs a type of the parameter from the type itself and the kind of
+// a reference.
+//
+// If the parameter is passed by reference, the type is wrapped into a ByRefType node
+// with the Kind field set to "ref", "out" or "in".
+type opParamType struct {
+	opKind Op
+	opType Op
+}
+
+func (op opParamType) Kinds() nodes.Kind {
+	return nodes.KindObject | nodes.KindNil
+}
+
+func (op opParamType) Check(st *State, n nodes.Node) (bool, error) {
+	var kind nodes.Node = nodes.String("")
+	if obj, ok := n.(nodes.Object); ok && uast.TypeOf(obj) == "ByRefType" {
+		kind, n = obj["Kind"], obj["Type"]
 	}
+	if ok, err := op.opKind.Check(st, kind); err != nil || !ok {
+		return ok, err
+	}
+	return op.opType.Check(st, n)
+}
+
+func (op opParamType) Construct(st *State, n nodes.Node) (nodes.Node, error) {
 	typ, err := op.opType.Construct(st, n)
 	if err != nil {
 		return nil, err
 	}
-	// we will now use each modifier to construct a chain or a linked list of nodes
-	// by adding a "Type" field to each modifier, that will point to the current node
-	for _, nd := range mods {
-		mod, ok := nd.(nodes.Object)
-		if !ok {
-			return nil, ErrUnexpectedType.New(nodes.Object{}, nd)
-		}
-		mod = mod.CloneObject()
-		if _, ok := mod["Type"]; ok {
-			return nil, errors.New("unexpected field in modifier: Type")
+	nd, err := op.opKind.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	kind, ok := nd.(nodes.String)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.String(""), nd)
+	}
+	if kind != "" {
+		typ = nodes.Object{
+			uast.KeyType: nodes.String("ByRefType"),
+			"Kind":       kind,
+			"Type":       typ,
 		}
-		mod["Type"] = typ
-		typ = mod
 	}
 	return typ, nil
 }
 
+var _ Op = opToken("")
+
+// opToken matches a node of a given type and drops it. Unlike Check(HasType(typ), Any()),
+// it constructs an empty node of the same type, so the mapping can be reversed.
+type opToken string
+
+func (op opToken) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+func (op opToken) Check(st *State, n nodes.Node) (bool, error) {
+	return uast.TypeOf(n) == string(op), nil
+}
+
+func (op opToken) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	if op == "None" {
+		return noneToken(), nil
+	}
+	return nodes.Object{uast.KeyType: nodes.String(op)}, nil
+}
+
+// noneToken returns a placeholder for an optional token that is not present in the source.
+func noneToken() nodes.Object {
+	return nodes.Object{
+		uast.KeyType: nodes.String("None"),
+		"IsMissing":  nodes.Bool(false),
+		"Text":       nodes.String(""),
+		"ValueText":  nodes.String(""),
+	}
+}
+
+var _ Op = opAsyncKeyword{}
+
+// opAsyncKeyword matches the AsyncKeyword field of a lambda. The field refers to the same token
+// as the async modifier, thus it is dropped, and the reverse transformation takes the token
+// from the variable with modifiers.
+type opAsyncKeyword struct {
+	modifiers string
+}
+
+func (op opAsyncKeyword) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+func (op opAsyncKeyword) Check(st *State, n nodes.Node) (bool, error) {
+	typ := uast.TypeOf(n)
+	return typ == "None" || typ == "AsyncKeyword", nil
+}
+
+func (op opAsyncKeyword) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	mods, _ := st.GetVar(op.modifiers)
+	arr, _ := mods.(nodes.Array)
+	for _, m := range arr {
+		if uast.TypeOf(m) == "AsyncKeyword" {
+			return m, nil
+		}
+	}
+	return noneToken(), nil
+}
+
+// arrowClause matches an ArrowExpressionClause node and stores its expression and positions
+// to variables that are used by arrowBlock.
+func arrowClause() Op {
+	return Obj{
+		uast.KeyType: String("ArrowExpressionClause"),
+		// will use this positions for Block in Body
+		uast.KeyPos: Var("arrow_pos"),
+		"ArrowToken": Obj{
+			uast.KeyType: String("EqualsGreaterThanToken"),
+			// will use this position for Return in Body
+			uast.KeyPos: Var("arrow_pos_tok"),
+			"IsMissing": Bool(false),
+			"Text":      Any(),
+			"Value":     Any(),
+			"ValueText": Any(),
+		},
+		"IsMissing":          Bool(false),
+		"IsStructuredTrivia": Bool(false),
+		"Expression":         Var("arrow"),
+	}
+}
+
+// arrowBlock generates a uast:Block with a csharp:Return node containing the expression
+// matched by arrowClause.
+func arrowBlock() Op {
+	return UASTType(uast.Block{}, Obj{
+		uast.KeyPos:  Var("arrow_pos"),
+		"Statements": Arr(arrowReturn()),
+	})
+}
+
+// arrowReturn generates a csharp:Return node for the expression matched by arrowClause.
+//
+// The node has no keyword, thus it's possible to distinguish it from a return statement
+// of a full body when reversing the transformation.
+func arrowReturn() Op {
+	return Check(
+		HasFields{"ReturnKeyword": false},
+		Obj{
+			uast.KeyType: String("ReturnStatement"),
+			uast.KeyPos:  Var("arrow_pos_tok"),
+			"Expression": Var("arrow"),
+		},
+	)
+}
+
+// arrowGetter generates a getter accessor for an expression-bodied property or indexer. The body
+// of the getter is generated by arrowBlock. The getter is temporary named "get", see opAccessors.
+func arrowGetter() Op {
+	return JoinObj(UASTType(uast.FunctionGroup{}, Obj{
+		"Nodes": Arr(UASTType(uast.Alias{}, Obj{
+			"Name": UASTType(uast.Identifier{}, Obj{
+				"Name": String("get"),
+			}),
+			"Node": UASTType(uast.Function{}, Obj{
+				"Type": UASTType(uast.FunctionType{}, nil),
+				"Body": arrowBlock(),
+			}),
+		})),
+	}), Obj{
+		"Attributes": Arr(),
+	})
+}
+
+// isArrowGetter selects an array of accessors with a getter generated by arrowGetter. Unlike
+// the getter from an accessor list, the name of this getter has no positions.
+func isArrowGetter() Sel {
+	return AnyElem(Has{
+		"Nodes": AnyElem(Has{
+			"Name": HasFields{uast.KeyPos: false},
+		}),
+	})
+}
+
+// typeParamList matches an optional TypeParameterList node and stores type parameters to
+// the "typeParams" variable. The "caseTypeParams" variable is set if the list is missing.
+func typeParamList() Op {
+	return Cases("caseTypeParams",
+		Is(nil),
+		Obj{
+			uast.KeyType:         String("TypeParameterList"),
+			uast.KeyPos:          Any(),
+			"LessThanToken":      Any(),
+			"GreaterThanToken":   Any(),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"Parameters":         Var("typeParams"),
+		},
+	)
+}
+
+// paramDefMap creates a normalization for parameters of methods, lambdas and indexers.
+//
+// Parameter is converted to a uast:Argument. Multiple args are expressed by "params" in
+// modifiers, and the "this" modifier of extension methods marks the argument as a receiver.
+// By-reference modifiers (ref, out, in) are stored in the argument type, see opParamType.
+// Attributes are stored in the Attributes field of the argument.
+//
+// The mods operation is called for all other modifiers of the parameter. Those may be stored
+// to a variable and restored in named fields of the argument using ext.
+func paramDefMap(mods Op, ext Obj) Mapping {
+	fields := Obj{
+		"Attributes": Var("attrs"),
+	}
+	for k, v := range ext {
+		fields[k] = v
+	}
+	return mapSemanticExt("Parameter", uast.Argument{}, fields, MapObj(
+		Obj{
+			"Identifier": Check(Has{
+				uast.KeyType: String(uast.TypeOf(uast.Identifier{})),
+			}, Var("name")),
+			"AttributeLists": Var("attrs"),
+			"Default": Cases("caseDefault",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("EqualsValueClause"),
+					uast.KeyPos:          Any(),
+					"EqualsToken":        Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Value":              Var("def_init"),
+				},
+			),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"Modifiers": opArrHasKeyword{
+				keyword: "ParamsKeyword",
+				opHas:   Var("variadic"),
+				opRest: opArrHasKeyword{
+					keyword: "ThisKeyword",
+					opHas:   Var("this"),
+					opRest: opByRef{
+						opKind: Var("byref"),
+						opRest: mods,
+					},
+				},
+			},
+			"Type": Var("type"),
+		},
+		Obj{
+			// see the mapping for __arglist
+			"Name": Check(Not(Has{"Name": String("__arglist")}), Var("name")),
+			"Type": opParamType{
+				opKind: Var("byref"),
+				opType: Var("type"),
+			},
+			"Init":        Cases("caseDefault", Is(nil), Var("def_init")),
+			"Variadic":    Var("variadic"),
+			"MapVariadic": Bool(false),
+			"Receiver":    Var("this"),
+		},
+	))
+}
+
 // funcDefMap creates a common annotation structure for methods with a specified AST type.
 //
 // If returns flag is set, it will also convert the return value of the method, in other
 // cases it will assume that there should be no ReturnType in the native AST node.
 //
+// The name operation stores the name of the method from the "name" variable to the alias.
+// Different declarations may be normalized to the same FunctionGroup, thus it may restrict
+// the name to allow the reverse transformation to tell them apart.
+//
 // Other object allows to remap custom fields from the native AST. Other fields can be
-// either asserted to a specific value, or stored to a variable and restored in the
-// FunctionGroup array using toGroup.
-func funcDefMap(typ string, returns bool, other Obj, toGroup ...Op) Mapping {
+// either asserted to a specific value, or stored to a variable and restored in named
+// fields of the FunctionGroup using ext.
+//
+// Attributes of the method are stored in the Attributes field of the FunctionGroup, the same
+// way as for type declarations and parameters.
+//
+// If other object maps the TypeParameterList field with typeParamList and ConstraintClauses
+// to a "constraints" variable, the type parameters will be stored in the TypeParameters field
+// of the FunctionGroup. See opGenericParams for details.
+func funcDefMap(typ string, returns bool, name Op, other, ext Obj) Mapping {
 	src := Obj{
 		"Identifier": Var("name"),
 		"ParameterList": Obj{
@@ -190,11 +492,7 @@ func funcDefMap(typ string, returns bool, other Obj, toGroup ...Op) Mapping {
 		"IsMissing":          Bool(false),
 		"IsStructuredTrivia": Bool(false),
 		"SemicolonToken":     Any(),
-		"AttributeLists": Cases("caseAttrs",
-			Arr(),
-			Check(OfKind(nodes.KindArray), Var("attr")),
-			Check(OfKind(nodes.KindObject), Var("attr")),
-		),
+		"AttributeLists":     Var("attrs"),
 		"Modifiers": Cases("caseMods",
 			Arr(),
 			NotEmpty(Var("modifiers")),
@@ -214,69 +512,43 @@ func funcDefMap(typ string, returns bool, other Obj, toGroup ...Op) Mapping {
 			}),
 		)
 	}
-	funcGroup := []Op{
-		Cases("caseAttrs",
-			Is(nil),
-			Var("attr"),
-			Arr(Var("attr")),
-		),
-		Cases("caseMods",
-			Is(nil),
-			NotEmpty(Var("modifiers")),
-		),
-	}
-	funcGroup = append(funcGroup, toGroup...)
-	funcGroup = append(funcGroup, UASTType(uast.Alias{}, Obj{
-		"Name": Var("name"),
+	alias := UASTType(uast.Alias{}, Obj{
+		"Name": name,
 		"Node": UASTType(uast.Function{}, Obj{
 			"Type": UASTType(uast.FunctionType{}, dstType),
 			// If the function was defined with an arrow expression, we will generate
 			// a uast:Block with a csharp:Return node containing the expression.
 			"Body": Cases("isArrow",
 				// case 1: arrow expression
-				UASTType(uast.Block{}, Obj{
-					uast.KeyPos: Var("arrow_pos"),
-					"Statements": Arr(
-						Obj{
-							uast.KeyType: String("ReturnStatement"),
-							uast.KeyPos:  Var("arrow_pos_tok"),
-							"Expression": Var("arrow"),
-						},
-					),
-				}),
+				arrowBlock(),
 				// case 2: full body
-				// TODO(dennwc): this will definitely fail the reverse transform
-				//               make a more specific node check when we need it
-				//               see https://github.com/bblfsh/sdk/issues/355
+				// The reverse transform picks the first case, and arrowBlock only matches
+				// a block that has no ReturnKeyword, thus a full body is never confused with it.
 				Var("body"),
 			),
 		}),
-	}))
-	return MapSemantic(typ, uast.FunctionGroup{}, MapObj(
+	})
+	fields := Obj{
+		"Attributes": Var("attrs"),
+	}
+	if _, ok := other["TypeParameterList"]; ok {
+		fields["TypeParameters"] = opGenericParams{
+			params:      Cases("caseTypeParams", Is(nil), Var("typeParams")),
+			constraints: Var("constraints"),
+		}
+	}
+	for k, v := range ext {
+		fields[k] = v
+	}
+	return mapSemanticExt(typ, uast.FunctionGroup{}, fields, MapObj(
 		// Either Body or ExpressionBody will be set.
 		CasesObj("isArrow",
 			src,
 			Objs{
 				// case 1: arrow expression
 				{
-					"Body": Is(nil),
-					"ExpressionBody": Obj{
-						uast.KeyType: String("ArrowExpressionClause"),
-						// will use this positions for Block in Body
-						uast.KeyPos: Var("arrow_pos"),
-						"ArrowToken": Obj{
-							uast.KeyType: String("EqualsGreaterThanToken"),
-							// will use this position for Return in Body
-							uast.KeyPos: Var("arrow_pos_tok"),
-							"IsMissing": Bool(false),
-							"Text":      Any(),
-							"Value":     Any(),
-							"ValueText": Any(),
-						},
-						"IsMissing":          Bool(false),
-						"IsStructuredTrivia": Bool(false),
-						"Expression":         Var("arrow"),
-					},
+					"Body":           Is(nil),
+					"ExpressionBody": arrowClause(),
 				},
 				// case 2: full body
 				{
@@ -287,1027 +559,4788 @@ func funcDefMap(typ string, returns bool, other Obj, toGroup ...Op) Mapping {
 		),
 
 		Obj{
-			"Nodes": Arr(funcGroup...),
+			"Nodes": modsAndAlias(alias),
 		},
 	))
 }
 
-// useFullSpan is a set of node types that use FullSpan for positions instead of Span
-var useFullSpan = []nodes.Value{
-	nodes.String("SingleLineDocumentationCommentTrivia"),
+// modsAndAlias stores an optional list of modifiers and an alias in the Nodes field of
+// the FunctionGroup.
+//
+// The array has no placeholder for missing modifiers, since opMergeGroups drops nil
+// values from it anyway, and the reverse transform should accept the same array.
+func modsAndAlias(alias Op) Op {
+	return Cases("caseMods",
+		Arr(alias),
+		Arr(NotEmpty(Var("modifiers")), alias),
+	)
 }
 
-// Preprocessors is a block of AST preprocessing rules rules.
-var Preprocessors = []Mapping{
-	// Erase Whitespace, EndOfLine and SkippedToken trivias.
-	Map(
-		Obj{
-			uast.KeyType: Check(
-				In(
-					nodes.String("WhitespaceTrivia"),
-					nodes.String("EndOfLineTrivia"),
-					nodes.String("SkippedTokensTrivia"),
+// accessorDefMap creates a normalization for property and event accessors with a specified AST type
+// and keyword.
+//
+// Accessors with a body or an arrow expression are converted to a uast:FunctionGroup, similar
+// to funcDefMap. Accessor has no name on its own, thus the alias is temporary named after the
+// accessor keyword (get, set, add or remove). The name is later joined with the name of the
+// property by opAccessors.
+//
+// Accessors without a body (auto-properties) are handled by a separate mapping in Normalizers.
+func accessorDefMap(typ, kw string) Mapping {
+	return mapSemanticExt(typ, uast.FunctionGroup{}, Obj{
+		"Attributes": Var("attrs"),
+	}, MapObj(
+		CasesObj("isArrow",
+			Obj{
+				"Keyword": Obj{
+					uast.KeyType: String(strings.ToUpper(kw[:1]) + kw[1:] + "Keyword"),
+					uast.KeyPos:  Var("kw_pos"),
+					"IsMissing":  Bool(false),
+					// all values are the same
+					"Text":      String(kw),
+					"Value":     String(kw),
+					"ValueText": String(kw),
+				},
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"SemicolonToken":     Any(),
+				"AttributeLists":     Var("attrs"),
+				"Modifiers": Cases("caseMods",
+					Arr(),
+					NotEmpty(Var("modifiers")),
 				),
-				Any(),
+			},
+			Objs{
+				// case 1: arrow expression
+				{
+					"Body":           Is(nil),
+					"ExpressionBody": arrowClause(),
+				},
+				// case 2: full body
+				{
+					"ExpressionBody": Is(nil),
+					"Body":           Check(Not(Is(nil)), Var("body")),
+				},
+			},
+		),
+		Obj{
+			"Nodes": modsAndAlias(
+				UASTType(uast.Alias{}, Obj{
+					// temporary name, see opAccessors
+					"Name": UASTType(uast.Identifier{}, Obj{
+						uast.KeyPos: Var("kw_pos"),
+						"Name":      String(kw),
+					}),
+					"Node": UASTType(uast.Function{}, Obj{
+						"Type": UASTType(uast.FunctionType{}, nil),
+						"Body": Cases("isArrow",
+							// case 1: arrow expression
+							arrowBlock(),
+							// case 2: full body
+							Var("body"),
+						),
+					}),
+				}),
 			),
-			"FullSpan":    Any(),
-			"Span":        Any(),
-			"SpanStart":   Any(),
-			"IsDirective": Bool(false),
 		},
-		// cannot delete directly, so set to nil
-		Is(nil),
-	),
+	))
+}
 
-	// Now all whitespace "SyntaxTrivia" nodes are nil, we need
-	// to cleanup arrays that were hosting those nodes.
-	//
-	// Find "LeadingTrivia" and "TrailingTrivia" and drop nil
-	// elements in those arrays.
-	Map(
-		Part("_", Obj{
-			"LeadingTrivia": dropNils{Var("arr")},
-		}),
-		Part("_", Obj{
-			"LeadingTrivia": Var("arr"),
-		}),
-	),
-	Map(
-		Part("_", Obj{
-			"TrailingTrivia": dropNils{Var("arr")},
-		}),
-		Part("_", Obj{
-			"TrailingTrivia": Var("arr"),
-		}),
-	),
+// accessorKind matches the keyword of an accessor. The case is the same as the case of
+// the accessor type, thus the type can be restored from the keyword.
+func accessorKind() Op {
+	return Cases("caseAccessor",
+		String("get"),
+		String("set"),
+		String("init"),
+		String("add"),
+		String("remove"),
+	)
+}
 
-	// Drop "IsEmpty" field from TextSpan.
-	// We can detect it with "Length == 0", if necessary.
-	Map(
-		Part("_", Obj{
-			uast.KeyType: String("TextSpan"),
-			"IsEmpty":    Any(),
-		}),
-		Part("_", Obj{
-			uast.KeyType: String("TextSpan"),
-		}),
-	),
+// propDefMap creates a common normalization for property and event declarations.
+//
+// Declaration is converted to a uast:Alias that names the property. The node of this alias
+// is a BasePropertyDeclaration that has the kind of declaration (property or event), the
+// type, an optional initializer and a list of accessors.
+//
+// Accessors are normalized by accessorDefMap. If arrow flag is set, the declaration may be
+// expression-bodied (int X => 1). It has no accessor list, thus a getter is generated from
+// the arrow expression.
+//
+// Other object allows to remap custom fields from the native AST, and init is used to
+// restore an initializer of the property, if any.
+//
+// If none of the accessors have a body, the property is marked as Auto, see opAccessors.
+func propDefMap(typ, kind string, arrow bool, other Obj, init Op) Mapping {
+	src := Obj{
+		"Identifier": Var("name"),
+		"Type":       Var("type"),
 
-	// Remove SpanStart from nodes. It duplicates positional info.
-	// TODO(dennwc): add it as a custom position field?
-	Map(
-		Part("_", Obj{
-			"SpanStart": Any(),
-		}),
-		Part("_", Obj{}),
-	),
+		"IsMissing":          Bool(false),
+		"IsStructuredTrivia": Bool(false),
 
-	// Positional info is stored in a child node in Span field.
-	//
-	// This is not supported by ObjectToNode helper, and we are
-	// too lazy to create positional node by hand.
-	//
-	// Instead, we will temporary remap positional info to
-	// "spanStart" and "spanEnd" fields of the root node, and
-	// ObjectToNode will pick them up later to build a proper
-	// positional node.
-	//
-	// There is also a FullSpan field that includes leading/trailing
-	// whitespaces and sometimes node tokens. We ignore this second
-	// position for most nodes, but there are few exceptions where
-	// we use FullSpan and ignore Span.
-	Map(
-		Part("_", CasesObj("case", Obj{}, Objs{
-			// exceptions - use FullSpan
-			{
-				uast.KeyType: Check(
-					In(useFullSpan...),
-					Var("typ"),
-				),
-				"FullSpan": Obj{
-					uast.KeyType: String("TextSpan"),
-					"Length":     Any(),
-					"Start":      Var("start"),
-					"End":        Var("end"),
-				},
-				// TODO(dennwc): add it as a custom position field?
-				"Span": Any(),
+		"AttributeLists": Var("attrs"),
+		"Modifiers":      Var("modifiers"),
+		// already converted to ExplicitInterface, or nil
+		"ExplicitInterfaceSpecifier": Var("iface"),
+	}
+	for k, v := range other {
+		src[k] = v
+	}
+	cases := Objs{
+		// case 1: accessor list
+		{
+			"AccessorList": Obj{
+				uast.KeyType:         String("AccessorList"),
+				uast.KeyPos:          Any(),
+				"OpenBraceToken":     Any(),
+				"CloseBraceToken":    Any(),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"Accessors":          Var("accessors"),
 			},
-			// other nodes - use Span
-			{
-				uast.KeyType: Check(
-					Not(In(useFullSpan...)),
-					Var("typ"),
+		},
+	}
+	if arrow {
+		cases[0]["ExpressionBody"] = Is(nil)
+		cases = append(cases, Obj{
+			// case 2: arrow expression
+			"AccessorList":   Is(nil),
+			"ExpressionBody": arrowClause(),
+		})
+	}
+	return Map(
+		CasesObj("isArrow",
+			// common
+			JoinObj(Obj{
+				uast.KeyType: String(typ),
+				uast.KeyPos:  Var("pos"),
+			}, src),
+			cases,
+		),
+		opAccessors{UASTType(uast.Alias{}, Obj{
+			uast.KeyPos: Var("pos"),
+			"Name":      Var("name"),
+			"Node": Obj{
+				uast.KeyType:        String("BasePropertyDeclaration"),
+				"Kind":              String(kind),
+				"Attributes":        Var("attrs"),
+				"Modifiers":         Var("modifiers"),
+				"Type":              Var("type"),
+				"ExplicitInterface": Var("iface"),
+				"Init":              init,
+				"Accessors": Cases("isArrow",
+					// case 1: accessor list
+					Check(Not(isArrowGetter()), Var("accessors")),
+					// case 2: arrow expression
+					Arr(arrowGetter()),
 				),
-				"Span": Obj{
-					uast.KeyType: String("TextSpan"),
-					"Length":     Any(),
-					"Start":      Var("start"),
-					"End":        Var("end"),
-				},
-				// TODO(dennwc): add it as a custom position field?
-				"FullSpan": Any(),
 			},
-		})),
-		Part("_", CasesObj("case", Obj{
-			// remap to temporary keys and let ObjectToNode to pick them up
-			"spanStart": Var("start"),
-			"spanEnd":   Var("end"),
-		}, Objs{
-			// exceptions
+		})},
+	)
+}
+
+// lambdaMap creates a common normalization for lambdas and anonymous methods with a specified
+// AST type.
+//
+// Anonymous function is converted to a uast:Function without an alias. The src object should
+// match the parameters of the function and sig should restore them as uast:FunctionType.
+// Position of the parameter list, if any, is kept as the position of the function type.
+// It allows to tell lambdas with and without parentheses apart.
+//
+// The pos operation restores the position of the function from the native node. Position
+// of the native node is stored to the "pos" variable, unless src matches it differently.
+//
+// If arrow flag is set, the body of the function may be an expression. In this case we will
+// generate a uast:Block with a csharp:Return node containing the expression, similar to
+// funcDefMap.
+//
+// Functions with modifiers (async, static) or attributes are additionally wrapped into
+// a uast:FunctionGroup, the same way as methods in funcDefMap. Only lambdas with an arrow
+// may have attributes, the group of anonymous methods has an empty list of attributes.
+func lambdaMap(typ string, arrow bool, src Obj, pos, sig Op) Mapping {
+	obj := Obj{
+		uast.KeyType:         String(typ),
+		uast.KeyPos:          Var("pos"),
+		"IsMissing":          Bool(false),
+		"IsStructuredTrivia": Bool(false),
+		// the same as the async modifier
+		"AsyncKeyword": opAsyncKeyword{modifiers: "modifiers"},
+		"Modifiers": Cases("caseMods",
+			Arr(),
+			NotEmpty(Var("modifiers")),
+		),
+	}
+	for k, v := range src {
+		obj[k] = v
+	}
+	var native ObjectOp = obj
+	body := Op(Var("body"))
+	attrs := Op(Arr())
+	if arrow {
+		// the same as Body
+		obj["Block"] = Any()
+		obj["ExpressionBody"] = Any()
+		attrs = Cases("caseAttrs",
+			Arr(),
+			NotEmpty(Var("attrs")),
+		)
+		obj["AttributeLists"] = attrs
+		arrowToken := func(pos Op) Op {
+			return Obj{
+				uast.KeyType: String("EqualsGreaterThanToken"),
+				uast.KeyPos:  pos,
+				"IsMissing":  Bool(false),
+				"Text":       Any(),
+				"Value":      Any(),
+				"ValueText":  Any(),
+			}
+		}
+		native = CasesObj("isArrow", obj, Objs{
+			// case 1: arrow expression
 			{
-				uast.KeyType: Check(
-					In(useFullSpan...),
-					Var("typ"),
-				),
+				// will use this position for Return in Body
+				"ArrowToken": arrowToken(Var("arrow_pos_tok")),
+				"Body":       Check(Not(HasType(uast.Block{})), Var("arrow")),
 			},
-			// other nodes
+			// case 2: full body
 			{
-				uast.KeyType: Check(
-					Not(In(useFullSpan...)),
-					Var("typ"),
-				),
+				"ArrowToken": arrowToken(Any()),
+				"Body":       Check(HasType(uast.Block{}), Var("body")),
 			},
-		})),
-	),
-
-	// Use temporary fields from the previous transform to create positional node.
-	ObjectToNode{
-		OffsetKey:    "spanStart",
-		EndOffsetKey: "spanEnd",
-	}.Mapping(),
-
-	// Add an empty @token field to comment nodes. It's necessary to pass the check
-	// in the comment extractor.
-	Map(
-		Part("_", Obj{
-			uast.KeyType: String("SingleLineCommentTrivia"),
-		}),
-		Part("_", Obj{
-			uast.KeyType:  String("SingleLineCommentTrivia"),
-			uast.KeyToken: String(""),
-		}),
-	),
-	Map(
-		Part("_", Obj{
-			uast.KeyType: String("SingleLineDocumentationCommentTrivia"),
-		}),
-		Part("_", Obj{
-			uast.KeyType:  String("SingleLineDocumentationCommentTrivia"),
-			uast.KeyToken: String(""),
-		}),
-	),
-	Map(
-		Part("_", Obj{
-			uast.KeyType: String("MultiLineCommentTrivia"),
-		}),
-		Part("_", Obj{
-			uast.KeyType:  String("MultiLineCommentTrivia"),
-			uast.KeyToken: String(""),
-		}),
-	),
+		})
+		body = Cases("isArrow",
+			// case 1: arrow expression
+			UASTType(uast.Block{}, Obj{
+				"Statements": Arr(arrowReturn()),
+			}),
+			// case 2: full body
+			Var("body"),
+		)
+	}
+	fnc := func(pos Op) Op {
+		return UASTType(uast.Function{}, Obj{
+			uast.KeyPos: pos,
+			"Type":      sig,
+			"Body":      body,
+		})
+	}
+	group := func(attrs, list Op) Op {
+		return JoinObj(UASTType(uast.FunctionGroup{}, Obj{
+			uast.KeyPos: pos,
+			"Nodes":     list,
+		}), Obj{
+			"Attributes": attrs,
+		})
+	}
+	// function without modifiers
+	plain := fnc(pos)
+	if arrow {
+		plain = Cases("caseAttrs",
+			fnc(pos),
+			group(NotEmpty(Var("attrs")), Arr(fnc(Is(nil)))),
+		)
+	}
+	return Map(
+		native,
+		Cases("caseMods",
+			plain,
+			group(attrs, Arr(
+				NotEmpty(Var("modifiers")),
+				fnc(Is(nil)),
+			)),
+		),
+	)
 }
 
-// Normalizers is the main block of normalization rules to convert native AST to semantic UAST.
-var Normalizers = []Mapping{
+// indexerDefMap creates a normalization for indexer declarations.
+//
+// Indexer is converted to a uast:FunctionGroup with a function named "this[]". The function
+// accepts parameters of the indexer and returns the indexer type. The body of the function
+// contains accessors of the indexer, normalized by accessorDefMap and named after the CLR
+// property name of the indexer (get_Item, set_Item). Accessors accept the parameters of the
+// indexer, see opIndexerAccessors. Expression-bodied indexer has a single getter generated
+// from the arrow expression.
+func indexerDefMap() Mapping {
+	return mapSemanticExt("IndexerDeclaration", uast.FunctionGroup{}, Obj{
+		"Attributes":        Var("attrs"),
+		"ExplicitInterface": Var("iface"),
+	}, MapObj(
+		CasesObj("isArrow",
+			Obj{
+				"ThisKeyword": Obj{
+					uast.KeyType: String("ThisKeyword"),
+					uast.KeyPos:  Var("this_pos"),
+					"IsMissing":  Bool(false),
+					"Text":       Any(),
+					"Value":      Any(),
+					"ValueText":  Any(),
+				},
+				"ParameterList": Obj{
+					uast.KeyType:         String("BracketedParameterList"),
+					uast.KeyPos:          Any(),
+					"OpenBracketToken":   Any(),
+					"CloseBracketToken":  Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Parameters":         Var("params"),
+				},
+				"Type": Var("type"),
 
-	// remove empty identifier tokens
-	Map(
-		Check(
-			Has{
-				uast.KeyType: String("IdentifierToken"),
-				// make sure it's empty, we don't want to wipe something useful
-				"Text":      String(""),
-				"Value":     String(""),
-				"ValueText": String(""),
+				// TODO: remap to custom positional fields
+				"Semicolon":      Any(),
+				"SemicolonToken": Any(),
+
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"AttributeLists":     Var("attrs"),
+				"Modifiers": Cases("caseMods",
+					Arr(),
+					NotEmpty(Var("modifiers")),
+				),
+				// already converted to ExplicitInterface, or nil
+				"ExplicitInterfaceSpecifier": Var("iface"),
+			},
+			Objs{
+				// case 1: accessor list
+				{
+					"ExpressionBody": Is(nil),
+					"AccessorList": Obj{
+						uast.KeyType:         String("AccessorList"),
+						uast.KeyPos:          Var("list_pos"),
+						"OpenBraceToken":     Any(),
+						"CloseBraceToken":    Any(),
+						"IsMissing":          Bool(false),
+						"IsStructuredTrivia": Bool(false),
+						"Accessors":          Var("accessors"),
+					},
+				},
+				// case 2: arrow expression
+				{
+					"AccessorList":   Is(nil),
+					"ExpressionBody": arrowClause(),
+				},
 			},
-			Any(),
 		),
-		Is(nil),
-	),
-
-	MapSemantic("IdentifierToken", uast.Identifier{}, MapObj(
 		Obj{
-			"IsMissing": Bool(false),
-
-			// we drop this one, because C# allows to declare
-			// a "for" identifier by using "@for" notation
-			// and we don't need that token in Semantic mode
-			"Text": Any(),
-			// all other token values are the same
-			"Value":     Var("name"),
-			"ValueText": Var("name"),
-		}, Obj{
-			"Name": Var("name"),
+			"Nodes": modsAndAlias(
+				UASTType(uast.Alias{}, Obj{
+					"Name": UASTType(uast.Identifier{}, Obj{
+						uast.KeyPos: Var("this_pos"),
+						"Name":      String("this[]"),
+					}),
+					"Node": UASTType(uast.Function{}, Obj{
+						"Type": UASTType(uast.FunctionType{}, Obj{
+							"Arguments": Var("params"),
+							"Returns": One(
+								UASTType(uast.Argument{}, Obj{
+									"Type": Var("type"),
+								}),
+							),
+						}),
+						"Body": Cases("isArrow",
+							// case 1: accessor list
+							UASTType(uast.Block{}, Obj{
+								uast.KeyPos: Var("list_pos"),
+								"Statements": opIndexerAccessors{
+									typ:    Var("type"),
+									params: Var("params"),
+									sub:    Check(Not(isArrowGetter()), Var("accessors")),
+								},
+							}),
+							// case 2: arrow expression
+							UASTType(uast.Block{}, Obj{
+								uast.KeyPos: Var("arrow_pos"),
+								"Statements": opIndexerAccessors{
+									typ:    Var("type"),
+									params: Var("params"),
+									sub:    Arr(arrowGetter()),
+								},
+							}),
+						),
+					}),
+				}),
+			),
 		},
-	)),
-
-	// remove empty identifiers
-	Map(
-		Check(
-			Has{
-				uast.KeyType: String("IdentifierName"),
-				"Identifier": Is(nil),
-			},
-			Any(),
-		),
-		Is(nil),
-	),
+	))
+}
 
-	Map(
+// typeDefMap creates a common normalization for class, struct and interface declarations.
+//
+// Type declaration is converted to a uast:Alias that names the type. The node of this
+// alias is a TypeDeclaration that has the kind of declaration (class, struct or interface)
+// and structured fields for attributes, modifiers, type parameters, base types and members
+// of the type. Constraints are attached to type parameters, see opGenericParams.
+func typeDefMap(typ, kind string) Mapping {
+	return mapSemantic(typ, uast.Alias{}, MapObj(
 		Obj{
-			uast.KeyType: String("IdentifierName"),
-			uast.KeyPos:  Any(), // TODO(dennwc): assert that it's the same
-
-			"Identifier": Var("ident"),
+			"Identifier": Var("name"),
+			// number of type parameters - safe to ignore
+			"Arity": Any(),
 
-			"Arity": Int(0),
+			// TODO: remap to custom positional fields
+			"Keyword":         Any(),
+			"OpenBraceToken":  Any(),
+			"CloseBraceToken": Any(),
+			"SemicolonToken":  Any(),
 
-			// TODO(dennwc): these assertions might not be valid for all cases
-			//               and will break this annotation, but at least it will
-			//               help us detect the case when it's not valid
 			"IsMissing":          Bool(false),
 			"IsStructuredTrivia": Bool(false),
 
-			// TODO(dennwc): this is true for Value == "unmanaged" and it looks
-			//				 more like a keyword, probably unrecognized one
-			"IsUnmanaged": Any(),
-
-			// TODO(dennwc): might be useful later; drop it for now
-			"IsVar": Any(),
+			"AttributeLists":    Var("attrs"),
+			"Modifiers":         Var("modifiers"),
+			"TypeParameterList": typeParamList(),
+			"ConstraintClauses": Var("constraints"),
+			// TODO: primary constructors of classes and structs are not supported yet
+			"ParameterList": Is(nil),
+			// BaseList contains both the base class and the implemented interfaces.
+			// We cannot distinguish them without the type information, so all of them
+			// are stored in the same list.
+			"BaseList": Cases("caseBase",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("BaseList"),
+					uast.KeyPos:          Any(),
+					"ColonToken":         Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Types": Each("bases", Obj{
+						uast.KeyType:         String("SimpleBaseType"),
+						uast.KeyPos:          Any(),
+						"IsMissing":          Bool(false),
+						"IsStructuredTrivia": Bool(false),
+						"Type":               Var("base"),
+					}),
+				},
+			),
+			"Members": Var("members"),
 		},
-		Var("ident"),
-	),
-
-	// Special: is a keyword, but used as an identifier (Parameter name)
-	MapSemantic("ArgListKeyword", uast.Identifier{}, MapObj(
 		Obj{
-			"IsMissing": Bool(false),
-
-			// all token values are the same
-			"Text":      String("__arglist"),
-			"Value":     String("__arglist"),
-			"ValueText": String("__arglist"),
-		}, Obj{
-			"Name": String("__arglist"),
+			"Name": Var("name"),
+			"Node": Obj{
+				uast.KeyType: String("TypeDeclaration"),
+				"Kind":       String(kind),
+				"Attributes": Var("attrs"),
+				"Modifiers":  Var("modifiers"),
+				"TypeParameters": opGenericParams{
+					params:      Cases("caseTypeParams", Is(nil), Var("typeParams")),
+					constraints: Var("constraints"),
+				},
+				"Bases":   Cases("caseBase", Arr(), Each("bases", Var("base"))),
+				"Members": Var("members"),
+			},
 		},
-	)),
+	))
+}
 
-	MapSemantic("StringLiteralExpression", uast.String{}, MapObj(
+// recordDefMap creates a normalization for record and record struct declarations.
+//
+// Records are converted to the same TypeDeclaration as classes and structs. Record may have
+// a parameter list (primary constructor) and pass arguments to the constructor of the base
+// record. Both are normalized by opRecord: the constructor and the properties for each of
+// the parameters are generated the same way as the compiler does it.
+func recordDefMap(typ, kind string) Mapping {
+	return mapSemantic(typ, uast.Alias{}, MapObj(
 		Obj{
-			"Token": Obj{
-				uast.KeyType: String("StringLiteralToken"),
-				uast.KeyPos:  Any(),
-
-				"IsMissing": Bool(false),
+			"Identifier": Var("name"),
+			// number of type parameters - safe to ignore
+			"Arity": Any(),
 
-				// contains escaped value, we don't need it in canonical UAST
-				"Text": Any(),
+			// TODO: remap to custom positional fields
+			"Keyword":              Any(),
+			"ClassOrStructKeyword": Any(),
+			"OpenBraceToken":       Any(),
+			"CloseBraceToken":      Any(),
+			"SemicolonToken":       Any(),
 
-				// both values are the same
-				"Value":     Var("val"),
-				"ValueText": Var("val"),
-			},
 			"IsMissing":          Bool(false),
 			"IsStructuredTrivia": Bool(false),
+
+			"AttributeLists":    Var("attrs"),
+			"Modifiers":         Var("modifiers"),
+			"TypeParameterList": typeParamList(),
+			"ConstraintClauses": Var("constraints"),
+			"ParameterList": Cases("caseParams",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("ParameterList"),
+					uast.KeyPos:          Var("params_pos"),
+					"OpenParenToken":     Any(),
+					"CloseParenToken":    Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Parameters":         Var("params"),
+				},
+			),
+			// base types are either SimpleBaseType or PrimaryConstructorBaseType,
+			// see opRecord
+			"BaseList": Cases("caseBase",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("BaseList"),
+					uast.KeyPos:          Any(),
+					"ColonToken":         Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Types":              Var("bases"),
+				},
+			),
+			"Members": Var("members"),
 		},
 		Obj{
-			"Value": Var("val"),
-		},
-	)),
+			"Name": Var("name"),
+			"Node": opRecord{
+				name:      Var("name"),
+				params:    Cases("caseParams", Is(nil), Var("params")),
+				paramsPos: Cases("caseParams", Is(nil), Var("params_pos")),
+				bases:     Cases("caseBase", Arr(), Var("bases")),
+				sub: Obj{
+					uast.KeyType: String("TypeDeclaration"),
+					"Kind":       String(kind),
+					"Attributes": Var("attrs"),
+					"Modifiers":  Var("modifiers"),
+					"TypeParameters": opGenericParams{
+						params:      Cases("caseTypeParams", Is(nil), Var("typeParams")),
+						constraints: Var("constraints"),
+					},
+					"Members": Var("members"),
+				},
+			},
+		},
+	))
+}
 
-	// A string literal part of the interpolation expression.
-	MapSemantic("InterpolatedStringTextToken", uast.String{}, MapObj(
-		Obj{
-			// trivia == whitespace; can safely drop it
-			"LeadingTrivia":  Arr(),
-			"TrailingTrivia": Arr(),
+// patternMap creates a normalization for a pattern. Given token fields are dropped, if they
+// contain a token of a specified type, and given fields are kept as is.
+func patternMap(typ string, tokens map[string]string, fields ...string) Mapping {
+	src := Obj{
+		uast.KeyType:         String(typ),
+		uast.KeyPos:          Var("pos"),
+		"IsMissing":          Bool(false),
+		"IsStructuredTrivia": Bool(false),
+	}
+	dst := Obj{
+		uast.KeyType: String(typ),
+		uast.KeyPos:  Var("pos"),
+	}
+	for field, tok := range tokens {
+		src[field] = opToken(tok)
+	}
+	for _, field := range fields {
+		v := strings.ToLower(field)
+		src[field] = Var(v)
+		dst[field] = Var(v)
+	}
+	return Map(src, dst)
+}
 
-			"IsMissing": Bool(false),
+// namespaceDefMap creates a common normalization for block and file-scoped namespace declarations.
+//
+// Both forms are converted to a Namespace node with the same set of fields. The name of the
+// namespace is always a uast:QualifiedIdentifier, and the FullName field contains the name
+// prefixed with names of all enclosing namespaces, see opNamespace.
+func namespaceDefMap(typ string, fileScoped bool, other Obj) Mapping {
+	src := Obj{
+		uast.KeyType: String(typ),
+		uast.KeyPos:  Var("pos"),
 
-			// contains escaped value, we don't need it in canonical UAST
-			"Text": Any(),
+		// TODO: remap to custom positional fields
+		"NamespaceKeyword": Any(),
+		"SemicolonToken":   Any(),
 
-			// both values are the same
-			"Value":     Var("val"),
-			"ValueText": Var("val"),
-		},
-		Obj{
-			"Value": Var("val"),
-		},
-	)),
+		"IsMissing":          Bool(false),
+		"IsStructuredTrivia": Bool(false),
 
-	// Collapse one more AST level if the string token is inside InterpolatedStringText.
-	MapSemantic("InterpolatedStringText", uast.String{}, MapObj(
-		Obj{
-			"TextToken": Obj{
-				uast.KeyType: String(uast.TypeOf(uast.String{})),
-				uast.KeyPos:  Any(),
-				"Format":     String(""),
-				"Value":      Var("val"),
-			},
-			"IsMissing":          Bool(false),
-			"IsStructuredTrivia": Bool(false),
-		},
-		Obj{
-			"Value": Var("val"),
-		},
-	)),
+		// attributes and modifiers are not allowed on namespaces
+		"AttributeLists": Arr(),
+		"Modifiers":      Arr(),
 
-	MapSemantic("TrueLiteralExpression", uast.Bool{}, MapObj(
-		Obj{
-			"Token": Obj{
-				uast.KeyType: String("TrueKeyword"),
-				uast.KeyPos:  Any(),
+		"Name": Cases("caseName",
+			Check(HasType(uast.Identifier{}), Var("name")),
+			Check(HasType(uast.QualifiedIdentifier{}), Var("name")),
+		),
+		"Externs": Var("externs"),
+		"Usings":  Var("usings"),
+		"Members": Var("members"),
+	}
+	for k, v := range other {
+		src[k] = v
+	}
+	return Map(
+		src,
+		opNamespace{Obj{
+			uast.KeyType: String("Namespace"),
+			uast.KeyPos:  Var("pos"),
+			"Name": Cases("caseName",
+				UASTType(uast.QualifiedIdentifier{}, Obj{
+					"Names": Arr(Var("name")),
+				}),
+				Var("name"),
+			),
+			"FileScoped": Bool(fileScoped),
+			"Externs":    Var("externs"),
+			"Usings":     Var("usings"),
+			"Members":    Var("members"),
+		}},
+	)
+}
 
-				"Text":      String("true"),
-				"Value":     Bool(true),
-				"ValueText": String("true"),
+const (
+	// KeyFullStart is a name of an additional position of the node that corresponds to the
+	// start of the FullSpan in Roslyn. It includes the leading trivia of the node.
+	KeyFullStart = "full_start"
+	// KeyFullEnd is a name of an additional position of the node that corresponds to the
+	// end of the FullSpan in Roslyn. It includes the trailing trivia of the node.
+	KeyFullEnd = "full_end"
+	// KeyDelegate is a name of an additional position of an anonymous method that corresponds
+	// to the start of the delegate keyword. It allows to tell anonymous methods and lambdas apart.
+	KeyDelegate = "delegate"
+	// KeyAttributeList is a name of an additional position of an attribute that corresponds
+	// to the start of the attribute list. It is set only for the first attribute of the list,
+	// and allows to tell adjacent lists apart.
+	KeyAttributeList = "list"
+)
 
-				"IsMissing": Bool(false),
-			},
-			"IsMissing":          Bool(false),
-			"IsStructuredTrivia": Bool(false),
-		},
-		Obj{
-			"Value": Bool(true),
-		},
-	)),
+// fullSpanPositions matches uast:Positions of the node, including optional KeyFullStart and KeyFullEnd.
+var fullSpanPositions = UASTType(uast.Positions{}, Fields{
+	{Name: uast.KeyStart, Op: Var(uast.KeyStart), Optional: uast.KeyStart + "_exists"},
+	{Name: uast.KeyEnd, Op: Var(uast.KeyEnd), Optional: uast.KeyEnd + "_exists"},
+	{Name: KeyFullStart, Op: Var(KeyFullStart), Optional: KeyFullStart + "_exists"},
+	{Name: KeyFullEnd, Op: Var(KeyFullEnd), Optional: KeyFullEnd + "_exists"},
+})
 
-	MapSemantic("FalseLiteralExpression", uast.Bool{}, MapObj(
-		Obj{
-			"Token": Obj{
-				uast.KeyType: String("FalseKeyword"),
-				uast.KeyPos:  Any(),
+// optFullSpanPositions is the same as fullSpanPositions, but also accepts nil positions.
+// The reverse transformation restores such nodes from children that were collapsed into
+// the parent by the normalizer (see QualifiedName).
+var optFullSpanPositions = Opt("pos_exists", fullSpanPositions)
 
-				"Text":      String("false"),
-				"Value":     Bool(false),
-				"ValueText": String("false"),
+// mapSemantic is the same as MapSemantic, but it keeps the full span positions of the node.
+func mapSemantic(nativeType string, semType interface{}, m ObjMapping) ObjMapping {
+	so, do := m.ObjMapping()
+	so = JoinObj(Obj{uast.KeyType: String(nativeType)}, so)
+	return MapObj(
+		JoinObj(so, Obj{uast.KeyPos: optFullSpanPositions}),
+		UASTType(semType, JoinObj(do, Obj{uast.KeyPos: optFullSpanPositions})),
+	)
+}
 
-				"IsMissing": Bool(false),
-			},
-			"IsMissing":          Bool(false),
-			"IsStructuredTrivia": Bool(false),
-		},
-		Obj{
-			"Value": Bool(false),
-		},
-	)),
+// mapSemanticExt is similar to mapSemantic, but also sets driver-specific fields of the semantic
+// node. The UAST schema has no place for C# attributes, type parameters or explicit interfaces
+// of methods, thus they are stored in named fields next to the fields defined by the schema.
+func mapSemanticExt(nativeType string, semType interface{}, ext Obj, m ObjMapping) ObjMapping {
+	so, do := m.ObjMapping()
+	so = JoinObj(Obj{uast.KeyType: String(nativeType)}, so)
+	return MapObj(
+		JoinObj(so, Obj{uast.KeyPos: optFullSpanPositions}),
+		JoinObj(UASTType(semType, JoinObj(do, Obj{uast.KeyPos: optFullSpanPositions})), ext),
+	)
+}
 
-	MapSemantic("Block", uast.Block{}, MapObj(
-		Obj{
-			"Statements": Var("stmts"),
-			// TODO(dennwc): remap to custom positional fields
-			"OpenBraceToken":     Any(),
-			"CloseBraceToken":    Any(),
-			"IsMissing":          Bool(false),
-			"IsStructuredTrivia": Bool(false),
-		},
-		Obj{
-			"Statements": Var("stmts"),
-		},
-	)),
+// fullSpanOf returns the full span of the node as start and end positions, or nil if the node
+// has no full span positions.
+func fullSpanOf(obj nodes.Object) uast.Positions {
+	pos := uast.PositionsOf(obj)
+	start, ok1 := pos[KeyFullStart]
+	end, ok2 := pos[KeyFullEnd]
+	if !ok1 || !ok2 {
+		return nil
+	}
+	return uast.Positions{
+		uast.KeyStart: start,
+		uast.KeyEnd:   end,
+		KeyFullStart:  start,
+		KeyFullEnd:    end,
+	}
+}
 
-	MapSemantic("SingleLineCommentTrivia", uast.Comment{}, MapObj(
-		Obj{
-			uast.KeyToken: CommentText([2]string{"//", ""}, "text"),
-			"IsDirective": Bool(false),
-		},
-		CommentNode(false, "text", nil),
-	)),
+// textSpan matches a TextSpan node and stores its start and end offsets to given variables.
+func textSpan(start, end string) Op {
+	return Obj{
+		uast.KeyType: String("TextSpan"),
+		"Length":     Any(),
+		"Start":      Var(start),
+		"End":        Var(end),
+	}
+}
 
-	MapSemantic("MultiLineCommentTrivia", uast.Comment{}, MapObj(
-		Obj{
-			uast.KeyToken: CommentText([2]string{"/*", "*/"}, uast.KeyToken),
-			"IsDirective": Bool(false),
-		},
-		CommentNode(true, uast.KeyToken, nil),
-	)),
+var _ Op = opCommentText{}
 
-	// TODO(dennwc): differentiate from regular comments
-	MapSemantic("SingleLineDocumentationCommentTrivia", uast.Comment{}, MapObj(
-		Obj{
-			uast.KeyToken: CommentText([2]string{"///", ""}, "text"),
-			"IsDirective": Bool(false),
-		},
-		CommentNode(false, "text", nil),
-	)),
+// commentText is the same as CommentText, but it keeps the last character of the comment
+// text intact when it takes more than one byte (non-ASCII letters, emoji, etc). CommentText
+// splits such character between the text and the suffix of the comment.
+func commentText(tokens [2]string, vr string) Op {
+	return opCommentText{tokens: tokens, vr: vr}
+}
 
-	// Import (aka UsingDirectiveSyntax) is more or less trivial.
-	//
-	// "Name" field is QualifiedIdentifier or Identifier and we remap to
-	// "Path" in Import.
-	//
-	// StaticKeyword indicates if the "using" directive is static.
-	// In this case we Set a import target scope to an object with static = true.
-	//
-	// Alias field may be set as well - we will as usual remap it to
-	// an uast:Alias object in the Import's Path field.
-	//
-	// Also, C# assumes that "using" statement imports all the symbols
-	// from that package, so we also set an "All" field on Import.
-	MapSemantic("UsingDirective", uast.Import{}, MapObj(
-		Obj{
-			"Name": Var("path"),
+type opCommentText struct {
+	tokens [2]string
+	vr     string
+}
 
-			// TODO(dennwc): remap to custom positional fields
-			"SemicolonToken": Any(),
-			"UsingKeyword":   Any(),
+func (op opCommentText) Kinds() nodes.Kind {
+	return nodes.KindString
+}
 
-			"IsMissing":          Bool(false),
-			"IsStructuredTrivia": Bool(false),
-			"StaticKeyword": If("isStatic",
-				Check(HasType("StaticKeyword"), Any()),
-				Check(HasType("None"), Any()),
-			),
-			"Alias": If("isAlias",
-				Obj{
-					uast.KeyType:         String("NameEquals"),
-					uast.KeyPos:          Any(),
-					"EqualsToken":        Any(),
-					"IsMissing":          Bool(false),
-					"IsStructuredTrivia": Bool(false),
-					"Name":               Var("alias"),
-				},
-				Is(nil),
-			),
-		},
+func (op opCommentText) Check(st *State, n nodes.Node) (bool, error) {
+	sub := NewState()
+	if ok, err := CommentText(op.tokens, op.vr).Check(sub, n); err != nil || !ok {
+		return ok, err
+	}
+	vars := make(Vars)
+	for _, name := range []string{op.vr + "_text", op.vr + "_pref", op.vr + "_suff", op.vr + "_tab"} {
+		v, err := sub.MustGetVar(name)
+		if err != nil {
+			return false, err
+		}
+		vars[name] = v
+	}
+	text, _ := vars[op.vr+"_text"].(nodes.String)
+	suff, _ := vars[op.vr+"_suff"].(nodes.String)
+	if i := len(text) - 1; i >= 0 && text[i] >= utf8.RuneSelf && utf8.RuneStart(text[i]) {
+		// the text ends with the first byte of a character, move the rest of it from the suffix
+		full := string(text + suff)
+		_, size := utf8.DecodeRuneInString(full[i:])
+		vars[op.vr+"_text"] = nodes.String(full[:i+size])
+		vars[op.vr+"_suff"] = nodes.String(full[i+size:])
+	}
+	err := st.SetVars(vars)
+	return err == nil, err
+}
+
+func (op opCommentText) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	return CommentText(op.tokens, op.vr).Construct(st, n)
+}
+
+// useFullSpan is a set of node types that use FullSpan for positions instead of Span
+var useFullSpan = []nodes.Value{
+	nodes.String("SingleLineDocumentationCommentTrivia"),
+	nodes.String("MultiLineDocumentationCommentTrivia"),
+}
+
+// Preprocessors is a block of AST preprocessing rules rules.
+var Preprocessors = []Mapping{
+	// Erase Whitespace, EndOfLine and SkippedToken trivias.
+	Map(
 		Obj{
-			"Path": If("isAlias",
-				UASTType(uast.Alias{}, Obj{
-					"Name": Var("alias"),
-					"Node": Var("path"),
-				}),
-				Var("path"),
-			),
-			"All": Bool(true),
-			"Target": If("isStatic",
-				Obj{"static": Bool(true)},
-				Is(nil),
+			uast.KeyType: Check(
+				In(
+					nodes.String("WhitespaceTrivia"),
+					nodes.String("EndOfLineTrivia"),
+					nodes.String("SkippedTokensTrivia"),
+				),
+				Any(),
 			),
+			"FullSpan":    Any(),
+			"Span":        Any(),
+			"SpanStart":   Any(),
+			"IsDirective": Bool(false),
 		},
-	)),
+		// cannot delete directly, so set to nil
+		Is(nil),
+	),
 
-	// QualifiedIdentifier case is interesting in the sense that AST nodes
-	// are organized as a linked list.
+	// Now all whitespace "SyntaxTrivia" nodes are nil, we need
+	// to cleanup arrays that were hosting those nodes.
 	//
-	// The root QualifiedNameSyntax node will have the "Right" field pointing
-	// to an Identifier (it was already converted from IdentifierNameSyntax)
-	// and the "Left" field may either point to another Identifier or
-	// to the next QualifiedNameSyntax (down to root of the package hierarchy).
+	// Find "LeadingTrivia" and "TrailingTrivia" and drop nil
+	// elements in those arrays.
+	Map(
+		Part("_", Obj{
+			"LeadingTrivia": dropNils{Var("arr")},
+		}),
+		Part("_", Obj{
+			"LeadingTrivia": Var("arr"),
+		}),
+	),
+	Map(
+		Part("_", Obj{
+			"TrailingTrivia": dropNils{Var("arr")},
+		}),
+		Part("_", Obj{
+			"TrailingTrivia": Var("arr"),
+		}),
+	),
+
+	// Drop "IsEmpty" field from TextSpan.
+	// We can detect it with "Length == 0", if necessary.
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("TextSpan"),
+			"IsEmpty":    Any(),
+		}),
+		Part("_", Obj{
+			uast.KeyType: String("TextSpan"),
+		}),
+	),
+
+	// Remove SpanStart from nodes. It duplicates the start of the Span.
+	Map(
+		Part("_", Obj{
+			"SpanStart": Any(),
+		}),
+		Part("_", Obj{}),
+	),
+
+	// Positional info is stored in a child node in Span field.
 	//
-	// For the first case, we create a single QualifiedIdentifier node
-	// by making a "Names" array from "Left" and "Right" Identifiers.
+	// There is also a FullSpan field that includes leading/trailing
+	// trivia and sometimes node tokens. It is stored as additional
+	// positions of the node, see KeyFullStart and KeyFullEnd.
 	//
-	// For the second case, we rely on the fact that transforms are
-	// using the DFS order. We assert that "Left" is already a
-	// QualifiedIdentifier (all children were converted by DFS) and
-	// save its "Names". Then we can simply create a new QualifiedIdentifier
-	// and append "Right" (Identifier) to the end of the saved "Names" array.
-	MapSemantic("QualifiedName", uast.QualifiedIdentifier{}, MapObj(
-		CasesObj("case",
+	// Span is used for start and end positions for most nodes, but
+	// there are few exceptions where we use FullSpan instead.
+	Map(
+		Part("_", CasesObj("case",
 			// common
 			Obj{
-				"Right":              Var("right"),
-				"Arity":              Int(0),
-				"DotToken":           Any(),
-				"IsMissing":          Bool(false),
-				"IsStructuredTrivia": Bool(false),
-				"IsUnmanaged":        Bool(false),
-				"IsVar":              Bool(false),
+				"FullSpan": textSpan("full_start", "full_end"),
 			},
-			// cases
 			Objs{
-				// the last name = identifier
+				// exceptions - use FullSpan
 				{
-					"Left": Check(HasType(uast.Identifier{}), Var("left")),
+					uast.KeyType: Check(
+						In(useFullSpan...),
+						Var("typ"),
+					),
+					"Span": Any(),
 				},
-				// linked list
+				// other nodes - use Span
 				{
-					"Left": UASTType(uast.QualifiedIdentifier{}, Obj{
-						// FIXME: start position
-						uast.KeyPos: Any(),
-						"Names":     Var("names"),
-					}),
+					uast.KeyType: Check(
+						Not(In(useFullSpan...)),
+						Var("typ"),
+					),
+					"Span": textSpan("start", "end"),
 				},
 			},
-		),
-		CasesObj("case", nil,
+		)),
+		Part("_", CasesObj("case",
+			// common
+			Obj{
+				uast.KeyPos: UASTType(uast.Positions{}, Obj{
+					uast.KeyStart: Cases("case", SavePosOffset("full_start"), SavePosOffset("start")),
+					uast.KeyEnd:   Cases("case", SavePosOffset("full_end"), SavePosOffset("end")),
+					KeyFullStart:  SavePosOffset("full_start"),
+					KeyFullEnd:    SavePosOffset("full_end"),
+				}),
+			},
 			Objs{
-				// the last name = identifier
+				// exceptions
 				{
-					"Names": Arr(Var("left"), Var("right")),
+					uast.KeyType: Check(
+						In(useFullSpan...),
+						Var("typ"),
+					),
 				},
-				// linked list
+				// other nodes
 				{
-					"Names": Append(Var("names"), Arr(Var("right"))),
+					uast.KeyType: Check(
+						Not(In(useFullSpan...)),
+						Var("typ"),
+					),
 				},
 			},
+		)),
+	),
+
+	// Add an empty @token field to comment nodes. It's necessary to pass the check
+	// in the comment extractor.
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("SingleLineCommentTrivia"),
+		}),
+		Part("_", Obj{
+			uast.KeyType:  String("SingleLineCommentTrivia"),
+			uast.KeyToken: String(""),
+		}),
+	),
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("SingleLineDocumentationCommentTrivia"),
+		}),
+		Part("_", Obj{
+			uast.KeyType:  String("SingleLineDocumentationCommentTrivia"),
+			uast.KeyToken: String(""),
+		}),
+	),
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("MultiLineDocumentationCommentTrivia"),
+		}),
+		Part("_", Obj{
+			uast.KeyType:  String("MultiLineDocumentationCommentTrivia"),
+			uast.KeyToken: String(""),
+		}),
+	),
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("MultiLineCommentTrivia"),
+		}),
+		Part("_", Obj{
+			uast.KeyType:  String("MultiLineCommentTrivia"),
+			uast.KeyToken: String(""),
+		}),
+	),
+	// The name of the region is only available in the source as well.
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("RegionDirectiveTrivia"),
+		}),
+		Part("_", Obj{
+			uast.KeyType:  String("RegionDirectiveTrivia"),
+			uast.KeyToken: String(""),
+		}),
+	),
+}
+
+// importPath matches the path of the using directive. The case tells if the native node
+// duplicates it in the Name field, which is only set for names, and not for other types.
+func importPath() Op {
+	return Cases("caseName",
+		Check(Has{uast.KeyType: In(
+			nodes.String(uast.TypeOf(uast.Identifier{})),
+			nodes.String(uast.TypeOf(uast.QualifiedIdentifier{})),
+			nodes.String("QualifiedName"),
+			nodes.String("GenericName"),
+			nodes.String("AliasQualifiedName"),
+		)}, Var("path")),
+		Var("path"),
+	)
+}
+
+// Normalizers is the main block of normalization rules to convert native AST to semantic UAST.
+var Normalizers = []Mapping{
+
+	// Flatten attribute lists of all declarations into arrays of Attribute nodes.
+	//
+	// This must precede all other mappings that use AttributeLists.
+	Map(
+		Part("_", Obj{"AttributeLists": Var("attrs")}),
+		Part("_", Obj{"AttributeLists": opAttributes{Var("attrs")}}),
+	),
+
+	// remove empty identifier tokens
+	Map(
+		Check(
+			Has{
+				uast.KeyType: String("IdentifierToken"),
+				// make sure it's empty, we don't want to wipe something useful
+				"Text":      String(""),
+				"Value":     String(""),
+				"ValueText": String(""),
+			},
+			Any(),
 		),
+		Is(nil),
+	),
+
+	mapSemantic("IdentifierToken", uast.Identifier{}, MapObj(
+		Obj{
+			"IsMissing": Bool(false),
+
+			// we drop this one, because C# allows to declare
+			// a "for" identifier by using "@for" notation
+			// and we don't need that token in Semantic mode
+			"Text": Any(),
+			// all other token values are the same
+			"Value":     Var("name"),
+			"ValueText": Var("name"),
+		}, Obj{
+			"Name": Var("name"),
+		},
 	)),
 
-	// Old style multiple arguments: argument with the magic name "__arglist"
-	MapSemantic("Parameter", uast.Argument{}, MapObj(
+	// remove empty identifiers
+	Map(
+		Check(
+			Has{
+				uast.KeyType: String("IdentifierName"),
+				"Identifier": Is(nil),
+			},
+			Any(),
+		),
+		Is(nil),
+	),
+
+	Map(
 		Obj{
-			"Identifier": Check(
-				Has{
-					uast.KeyType: String(uast.TypeOf(uast.Identifier{})),
-					"Name":       String("__arglist"),
-				}, Var("name")),
-			"AttributeLists":     Arr(), // TODO(dennwc): any cases when it's not empty?
-			"Default":            Var("def_init"),
+			uast.KeyType: String("IdentifierName"),
+			uast.KeyPos:  Any(), // TODO(dennwc): assert that it's the same
+
+			"Identifier": Var("ident"),
+
+			"Arity": Int(0),
+
+			// TODO(dennwc): these assertions might not be valid for all cases
+			//               and will break this annotation, but at least it will
+			//               help us detect the case when it's not valid
 			"IsMissing":          Bool(false),
 			"IsStructuredTrivia": Bool(false),
-			"Modifiers":          Arr(), // TODO(dennwc): any cases when it's not empty?
-			"Type":               Var("type"),
+
+			// TODO(dennwc): this is true for Value == "unmanaged" and it looks
+			//				 more like a keyword, probably unrecognized one
+			"IsUnmanaged": Any(),
+
+			// TODO(dennwc): might be useful later; drop it for now
+			"IsVar": Any(),
+
+			// these are true for contextual keywords "nint", "nuint" and "notnull"
+			"IsNint":    Any(),
+			"IsNuint":   Any(),
+			"IsNotNull": Any(),
 		},
+		// In the reverse direction, only identifiers with trivia are wrapped into
+		// IdentifierName. The node prevents moving the trivia out of the type.
+		Check(
+			Has{
+				uast.KeyType: String(typeGroup),
+				"Nodes":      AnyElem(HasType(uast.Identifier{})),
+			},
+			Var("ident"),
+		),
+	),
+
+	// Special: is a keyword, but used as an identifier (Parameter name)
+	mapSemantic("ArgListKeyword", uast.Identifier{}, MapObj(
 		Obj{
-			"Name":        Var("name"),
-			"Type":        Var("type"),
-			"Init":        Var("def_init"),
-			"Variadic":    Bool(true),
-			"MapVariadic": Bool(false),
-			"Receiver":    Bool(false),
+			"IsMissing": Bool(false),
+
+			// all token values are the same
+			"Text":      String("__arglist"),
+			"Value":     String("__arglist"),
+			"ValueText": String("__arglist"),
+		}, Obj{
+			"Name": String("__arglist"),
 		},
 	)),
 
-	// Normal parameter, potential multiple args expressed by "params" in modifiers
-	MapSemantic("Parameter", uast.Argument{}, MapObj(
+	mapSemantic("StringLiteralExpression", uast.String{}, MapObj(
 		Obj{
-			"Identifier": Check(Has{
-				uast.KeyType: String(uast.TypeOf(uast.Identifier{})),
-			}, Var("name")),
-			"AttributeLists":     Arr(), // TODO(dennwc): any cases when it's not empty?
-			"Default":            Var("def_init"),
-			"IsMissing":          Bool(false),
-			"IsStructuredTrivia": Any(),
-			"Modifiers": opArrHasKeyword{
-				keyword: "ParamsKeyword",
-				opHas:   Var("variadic"),
-				opRest: opArrHasKeyword{
-					keyword: "ThisKeyword",
-					opHas:   Var("this"),
-					opRest:  Var("rest"),
-				},
+			"Token": Obj{
+				uast.KeyType: String("StringLiteralToken"),
+				uast.KeyPos:  Any(),
+
+				"IsMissing": Bool(false),
+
+				// contains escaped value, we don't need it in canonical UAST
+				"Text": Any(),
+
+				// both values are the same
+				"Value":     Var("val"),
+				"ValueText": Var("val"),
 			},
-			"Type": Var("type"),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
 		},
 		Obj{
-			"Name": Var("name"),
-			"Type": opArrToChain{
-				opMods: Var("rest"),
-				opType: Var("type"),
-			},
-			"Init":        Var("def_init"),
-			"Variadic":    Var("variadic"),
-			"MapVariadic": Bool(false),
-			"Receiver":    Var("this"),
+			"Value": Var("val"),
 		},
 	)),
 
-	funcDefMap("MethodDeclaration", true,
-		Obj{
-			// number of parameters - safe to ignore
-			"Arity":                      Any(),
-			"ExplicitInterfaceSpecifier": Is(nil),
-			"ConstraintClauses": Cases("caseConstraint",
-				Arr(),
-				NotEmpty(Var("constraints")),
-			),
-			"TypeParameterList": Cases("caseTypeParams",
-				Is(nil),
-				Arr(),
-				NotEmpty(Var("typeParams")),
-			),
-		},
-		Cases("caseTypeParams",
-			Is(nil),
-			Is(nil),
-			NotEmpty(Var("typeParams")),
-		),
-		Cases("caseConstraint",
-			Is(nil),
-			NotEmpty(Var("constraints")),
-		),
+	// String literal parts of the interpolation expression are converted to uast:String.
+	//
+	// Parts are converted by the parent node, since the same uast:String node is produced for
+	// string literals, and the reverse transform can only tell them apart by the parent.
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("InterpolatedStringExpression"),
+			"Contents": Each("contents", Cases("isText",
+				// case 1: string literal part
+				Obj{
+					uast.KeyType:         String("InterpolatedStringText"),
+					uast.KeyPos:          Var("pos"),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"TextToken": Obj{
+						uast.KeyType: String("InterpolatedStringTextToken"),
+						uast.KeyPos:  Any(),
+
+						// trivia == whitespace; can safely drop it
+						"LeadingTrivia":  Arr(),
+						"TrailingTrivia": Arr(),
+
+						"IsMissing": Bool(false),
+
+						// contains escaped value, we don't need it in canonical UAST
+						"Text": Any(),
+
+						// both values are the same
+						"Value":     Var("val"),
+						"ValueText": Var("val"),
+					},
+				},
+				// case 2: interpolation
+				Var("part"),
+			)),
+		}),
+		Part("_", Obj{
+			uast.KeyType: String("InterpolatedStringExpression"),
+			"Contents": Each("contents", Cases("isText",
+				// case 1: string literal part
+				UASTType(uast.String{}, Obj{
+					uast.KeyPos: Var("pos"),
+					"Value":     Var("val"),
+				}),
+				// case 2: interpolation
+				Var("part"),
+			)),
+		}),
 	),
-	// ConstructorDeclaration is similar to MethodDeclaration, but it may include a
-	// base class initializer that require a special transformation.
-	MapSemantic("ConstructorDeclaration", uast.FunctionGroup{}, MapObj(
+
+	mapSemantic("TrueLiteralExpression", uast.Bool{}, MapObj(
 		Obj{
-			// Same as to MethodDeclaration above
-			"Identifier": Var("name"),
-			"ParameterList": Obj{
-				uast.KeyType:         String("ParameterList"),
-				uast.KeyPos:          Any(),
-				"OpenParenToken":     Any(),
-				"CloseParenToken":    Any(),
-				"IsMissing":          Bool(false),
-				"IsStructuredTrivia": Bool(false),
-				"Parameters":         Var("params"),
+			"Token": Obj{
+				uast.KeyType: String("TrueKeyword"),
+				uast.KeyPos:  Any(),
+
+				"Text":      String("true"),
+				"Value":     Bool(true),
+				"ValueText": String("true"),
+
+				"IsMissing": Bool(false),
 			},
 			"IsMissing":          Bool(false),
 			"IsStructuredTrivia": Bool(false),
-			"SemicolonToken":     Any(),
-			"AttributeLists": Cases("caseAttrs",
-				Arr(),
-				Check(OfKind(nodes.KindArray), Var("attr")),
-				Check(OfKind(nodes.KindObject), Var("attr")),
-			),
-
-			// won't be set for a constructor
-			"ExpressionBody": Is(nil),
+		},
+		Obj{
+			"Value": Bool(true),
+		},
+	)),
 
-			// Initializer is an expression to initialize the base class.
-			// Here we consider case if it's exists in the AST node.
-			//
-			// Initializer is basically a function call that will init the base class.
-			// So we will consider it a first statement of a function body.
-			//
-			// For this we dig into Body above to get the list of statements.
-			// If hasBaseInit is set (initializer exists), we will prepend it
-			// to the array of statement in Body.
-			"Initializer": If("hasBaseInit",
-				// case 1: has base initializer
-				Check(HasType("BaseConstructorInitializer"), Var("baseInit")),
-				// case 2: no initializer
+	mapSemantic("FalseLiteralExpression", uast.Bool{}, MapObj(
+		Obj{
+			"Token": Obj{
+				uast.KeyType: String("FalseKeyword"),
+				uast.KeyPos:  Any(),
+
+				"Text":      String("false"),
+				"Value":     Bool(false),
+				"ValueText": String("false"),
+
+				"IsMissing": Bool(false),
+			},
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			"Value": Bool(false),
+		},
+	)),
+
+	// Using declarations (using var x = ...;) dispose resources at the end of the enclosing
+	// block. Convert them to UsingStatement nodes with the rest of the block as a body,
+	// see opUsingDeclarations.
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("Block"),
+			"Statements": Var("stmts"),
+		}),
+		Part("_", Obj{
+			uast.KeyType: String("Block"),
+			"Statements": opUsingDeclarations{Var("stmts")},
+		}),
+	),
+	mapSemantic("Block", uast.Block{}, MapObj(
+		Obj{
+			"Statements": Var("stmts"),
+			// attributes are not allowed on blocks
+			"AttributeLists": Arr(),
+			// TODO(dennwc): remap to custom positional fields
+			"OpenBraceToken":     Any(),
+			"CloseBraceToken":    Any(),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			"Statements": Var("stmts"),
+		},
+	)),
+
+	// Older versions of Roslyn have no await using statements,
+	// add an empty field to be able to use the same mapping.
+	Map(
+		Check(
+			Not(Has{"AwaitKeyword": Any()}),
+			Part("_", Obj{
+				uast.KeyType: String("UsingStatement"),
+			}),
+		),
+		Part("_", Obj{
+			uast.KeyType:   String("UsingStatement"),
+			"AwaitKeyword": Is(nil),
+		}),
+	),
+	// using (var x = ...) { ... } and using (expr) { ... }
+	//
+	// The resource is either a variable declaration or an expression. The body is always
+	// a uast:Block, a single statement is wrapped into a new block.
+	Map(
+		Obj{
+			uast.KeyType: String("UsingStatement"),
+			uast.KeyPos:  Var("pos"),
+			"AwaitKeyword": Cases("caseAwait",
 				Is(nil),
+				opToken("None"),
+				opToken("AwaitKeyword"),
 			),
-			"Body": Part("bodyMap", Obj{
-				"Statements": Var("stmts"),
-			}),
-			"Modifiers": Cases("caseMods",
-				Arr(),
-				NotEmpty(Var("modifiers")),
+			"Declaration": Var("decl"),
+			"Expression":  Var("expr"),
+			"Statement": Cases("caseBlock",
+				Check(HasType(uast.Block{}), Var("body")),
+				Check(Not(HasType(uast.Block{})), Var("stmt")),
 			),
+
+			// TODO: remap to custom positional fields
+			"UsingKeyword":    Any(),
+			"OpenParenToken":  Any(),
+			"CloseParenToken": Any(),
+
+			// attributes are not allowed on statements
+			"AttributeLists": Arr(),
+
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
 		},
 		Obj{
-			"Nodes": Arr(
-				Cases("caseAttrs",
-					Is(nil),
-					Var("attr"),
-					Arr(Var("attr")),
-				),
-				Cases("caseMods",
-					Is(nil),
-					NotEmpty(Var("modifiers")),
-				),
+			uast.KeyType:  String("UsingStatement"),
+			uast.KeyPos:   Var("pos"),
+			"Await":       Cases("caseAwait", Bool(false), Bool(false), Bool(true)),
+			"Declaration": Var("decl"),
+			"Expression":  Var("expr"),
+			"Body": Cases("caseBlock",
+				// a new block has no positions
+				Check(HasFields{uast.KeyPos: true}, Var("body")),
+				UASTType(uast.Block{}, Obj{
+					"Statements": Arr(Var("stmt")),
+				}),
+			),
+			// set for using declarations, see opUsingDeclarations
+			"ImplicitBody": Bool(false),
+		},
+	),
+
+	mapSemantic("SingleLineCommentTrivia", uast.Comment{}, MapObj(
+		Obj{
+			uast.KeyToken: commentText([2]string{"//", ""}, "text"),
+			"IsDirective": Bool(false),
+		},
+		CommentNode(false, "text", nil),
+	)),
+
+	mapSemantic("MultiLineCommentTrivia", uast.Comment{}, MapObj(
+		Obj{
+			uast.KeyToken: commentText([2]string{"/*", "*/"}, uast.KeyToken),
+			"IsDirective": Bool(false),
+		},
+		CommentNode(true, uast.KeyToken, nil),
+	)),
+
+	// XML documentation comments: /// and /** */
+	docMapping("SingleLineDocumentationCommentTrivia", [2]string{"///", ""}, false),
+	docMapping("MultiLineDocumentationCommentTrivia", [2]string{"/**", "*/"}, true),
+
+	// Script directives: #r "System.Net.Http" and #load "common.csx".
+	//
+	// Both are converted to uast:Import with the path as uast:String. The #r directive
+	// references an assembly or a package, thus it doesn't import any symbols on its own.
+	// The #load directive includes all declarations from the loaded script.
+	directiveMap("ReferenceDirectiveTrivia", false, "reference"),
+	directiveMap("LoadDirectiveTrivia", true, "load"),
+
+	// Import (aka UsingDirectiveSyntax) is more or less trivial.
+	//
+	// "Name" field is QualifiedIdentifier or Identifier and we remap to
+	// "Path" in Import.
+	//
+	// StaticKeyword indicates if the "using" directive is static.
+	// In this case we Set a import target scope to an object with static = true.
+	//
+	// Alias field may be set as well - we will as usual remap it to
+	// an uast:Alias object in the Import's Path field.
+	//
+	// Also, C# assumes that "using" statement imports all the symbols
+	// from that package, so we also set an "All" field on Import.
+	mapSemantic("UsingDirective", uast.Import{}, MapObj(
+		Obj{
+			"NamespaceOrType": Var("path"),
+			// the same as NamespaceOrType, or nil if the alias refers to a type that is not a name
+			"Name": Cases("caseName",
+				Check(Not(Is(nil)), Var("path")),
+				Is(nil),
+			),
+
+			// TODO(dennwc): remap to custom positional fields
+			"SemicolonToken": Any(),
+			"UsingKeyword":   Any(),
+
+			// TODO: global and unsafe using directives are not supported yet
+			"GlobalKeyword": opToken("None"),
+			"UnsafeKeyword": opToken("None"),
+
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"StaticKeyword": If("isStatic",
+				opToken("StaticKeyword"),
+				opToken("None"),
+			),
+			"Alias": If("isAlias",
+				Obj{
+					uast.KeyType:         String("NameEquals"),
+					uast.KeyPos:          Any(),
+					"EqualsToken":        Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Name":               Var("alias"),
+				},
+				Is(nil),
+			),
+		},
+		Obj{
+			"Path": If("isAlias",
 				UASTType(uast.Alias{}, Obj{
-					"Name": Var("name"),
-					"Node": UASTType(uast.Function{}, Obj{
-						// Restore the function body.
-						//
-						// We will also prepend a base class initializer here, see above.
-						"Body": Part("bodyMap", Obj{
-							"Statements": If("hasBaseInit",
-								// case 1: has base initializer
-								PrependOne(Var("baseInit"), Var("stmts")),
-								// case 2: no initializer
-								Var("stmts"),
-							),
-						}),
-						"Type": UASTType(uast.FunctionType{}, Obj{
-							"Arguments": Var("params"),
-						}),
+					"Name": Var("alias"),
+					"Node": importPath(),
+				}),
+				importPath(),
+			),
+			"All": Bool(true),
+			"Target": If("isStatic",
+				Obj{"static": Bool(true)},
+				Is(nil),
+			),
+		},
+	)),
+
+	// QualifiedIdentifier case is interesting in the sense that AST nodes
+	// are organized as a linked list.
+	//
+	// The root QualifiedNameSyntax node will have the "Right" field pointing
+	// to an Identifier (it was already converted from IdentifierNameSyntax)
+	// and the "Left" field may either point to another Identifier or
+	// to the next QualifiedNameSyntax (down to root of the package hierarchy).
+	//
+	// For the first case, we create a single QualifiedIdentifier node
+	// by making a "Names" array from "Left" and "Right" Identifiers.
+	//
+	// For the second case, we rely on the fact that transforms are
+	// using the DFS order. We assert that "Left" is already a
+	// QualifiedIdentifier (all children were converted by DFS) and
+	// save its "Names". Then we can simply create a new QualifiedIdentifier
+	// and append "Right" (Identifier) to the end of the saved "Names" array.
+	mapSemantic("QualifiedName", uast.QualifiedIdentifier{}, MapObj(
+		CasesObj("case",
+			// common
+			Obj{
+				"Right":              Var("right"),
+				"Arity":              Int(0),
+				"DotToken":           Any(),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"IsUnmanaged":        Bool(false),
+				"IsVar":              Bool(false),
+				"IsNint":             Bool(false),
+				"IsNuint":            Bool(false),
+				"IsNotNull":          Bool(false),
+			},
+			// cases
+			Objs{
+				// the last name = identifier
+				{
+					"Left": Check(HasType(uast.Identifier{}), Var("left")),
+				},
+				// linked list
+				{
+					"Left": UASTType(uast.QualifiedIdentifier{}, Obj{
+						// FIXME: start position
+						uast.KeyPos: Any(),
+						"Names":     Var("names"),
 					}),
+				},
+			},
+		),
+		CasesObj("case", nil,
+			Objs{
+				// the last name = identifier
+				{
+					"Names": Arr(Var("left"), Var("right")),
+				},
+				// linked list
+				{
+					"Names": Append(Var("names"), Arr(Var("right"))),
+				},
+			},
+		),
+	)),
+
+	// Old style multiple arguments: argument with the magic name "__arglist"
+	mapSemanticExt("Parameter", uast.Argument{}, Obj{
+		"Attributes": Arr(),
+	}, MapObj(
+		Obj{
+			"Identifier": Check(
+				Has{
+					uast.KeyType: String(uast.TypeOf(uast.Identifier{})),
+					"Name":       String("__arglist"),
+				}, Var("name")),
+			// __arglist cannot have attributes, modifiers or a default value
+			"AttributeLists":     Arr(),
+			"Default":            Is(nil),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"Modifiers":          Arr(),
+			"Type":               Var("type"),
+		},
+		Obj{
+			"Name":        Var("name"),
+			"Type":        Var("type"),
+			"Init":        Is(nil),
+			"Variadic":    Bool(true),
+			"MapVariadic": Bool(false),
+			"Receiver":    Bool(false),
+		},
+	)),
+
+	// Normal parameter, potential multiple args expressed by "params" in modifiers.
+	paramDefMap(Arr(), nil),
+	// Parameters with other modifiers (scoped, readonly, etc.) are not fully supported yet.
+	// The modifiers are kept in the Modifiers field of the argument.
+	paramDefMap(NotEmpty(Var("mods")), Obj{
+		"Modifiers": Var("mods"),
+	}),
+
+	// Explicit interface name that prefixes the name of a method or a property, for example
+	// IDisposable in IDisposable.Dispose. It is always stored as a uast:QualifiedIdentifier,
+	// unless it's a generic interface, or an alias-qualified name.
+	Map(
+		Obj{
+			uast.KeyType:         String("ExplicitInterfaceSpecifier"),
+			uast.KeyPos:          Var("pos"),
+			"DotToken":           Any(),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"Name": Cases("caseName",
+				Check(HasType(uast.Identifier{}), Var("name")),
+				Check(Not(HasType(uast.Identifier{})), Var("name")),
+			),
+		},
+		Obj{
+			uast.KeyType: String("ExplicitInterface"),
+			uast.KeyPos:  Var("pos"),
+			"Name": Cases("caseName",
+				UASTType(uast.QualifiedIdentifier{}, Obj{
+					"Names": Arr(Var("name")),
+				}),
+				Var("name"),
+			),
+		},
+	),
+
+	// Type parameter constraints: where T : class, struct, unmanaged, new(), default, Base,
+	// allows ref struct
+	//
+	// All of them are converted to GenericConstraint with a Kind field, a Type field
+	// for type constraints and a Nullable flag for "class?". Constraint clauses are later
+	// joined with type parameters by opGenericParams.
+	Map(
+		Obj{
+			uast.KeyType:           String("ClassOrStructConstraint_ClassConstraint"),
+			uast.KeyPos:            Var("pos"),
+			"ClassOrStructKeyword": Any(),
+			"QuestionToken": Cases("caseNullable",
+				opToken("None"),
+				opToken("QuestionToken"),
+			),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("class"),
+			"Type":       Is(nil),
+			"Nullable":   Cases("caseNullable", Bool(false), Bool(true)),
+		},
+	),
+	Map(
+		Obj{
+			uast.KeyType:           String("ClassOrStructConstraint_StructConstraint"),
+			uast.KeyPos:            Var("pos"),
+			"ClassOrStructKeyword": Any(),
+			"QuestionToken": Cases("caseNullable",
+				opToken("None"),
+				opToken("QuestionToken"),
+			),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("struct"),
+			"Type":       Is(nil),
+			"Nullable":   Cases("caseNullable", Bool(false), Bool(true)),
+		},
+	),
+	Map(
+		Obj{
+			uast.KeyType:         String("ConstructorConstraint"),
+			uast.KeyPos:          Var("pos"),
+			"NewKeyword":         Any(),
+			"OpenParenToken":     Any(),
+			"CloseParenToken":    Any(),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("new"),
+			"Type":       Is(nil),
+			"Nullable":   Bool(false),
+		},
+	),
+	// "unmanaged" is parsed as a type constraint with an identifier
+	Map(
+		Obj{
+			uast.KeyType: String("TypeConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Type": UASTType(uast.Identifier{}, Obj{
+				uast.KeyPos: Any(),
+				"Name":      String("unmanaged"),
+			}),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("unmanaged"),
+			"Type":       Is(nil),
+			"Nullable":   Bool(false),
+		},
+	),
+	Map(
+		Obj{
+			uast.KeyType:         String("TypeConstraint"),
+			uast.KeyPos:          Var("pos"),
+			"Type":               Var("type"),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("type"),
+			"Type":       Var("type"),
+			"Nullable":   Bool(false),
+		},
+	),
+	Map(
+		Obj{
+			uast.KeyType:         String("DefaultConstraint"),
+			uast.KeyPos:          Var("pos"),
+			"DefaultKeyword":     Any(),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("default"),
+			"Type":       Is(nil),
+			"Nullable":   Bool(false),
+		},
+	),
+	// "allows" is a separate clause with a list of anti-constraints, but "ref struct"
+	// is the only one defined by the language
+	Map(
+		Obj{
+			uast.KeyType:    String("AllowsConstraintClause"),
+			uast.KeyPos:     Var("pos"),
+			"AllowsKeyword": Any(),
+			"Constraints": Arr(Obj{
+				uast.KeyType:         String("RefStructConstraint"),
+				uast.KeyPos:          Any(),
+				"RefKeyword":         Any(),
+				"StructKeyword":      Any(),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+			}),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("GenericConstraint"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       String("allows ref struct"),
+			"Type":       Is(nil),
+			"Nullable":   Bool(false),
+		},
+	),
+
+	funcDefMap("MethodDeclaration", true, Var("name"),
+		Obj{
+			// number of parameters - safe to ignore
+			"Arity": Any(),
+			// explicit interface implementation: void IFoo.Bar()
+			// already converted to ExplicitInterface, or nil
+			"ExplicitInterfaceSpecifier": Var("iface"),
+			// type parameters are stored in the FunctionGroup, see funcDefMap
+			"ConstraintClauses": Var("constraints"),
+			"TypeParameterList": typeParamList(),
+		},
+		Obj{
+			"ExplicitInterface": Var("iface"),
+		},
+	),
+	// Operators have no name, thus we generate it from the operator token.
+	// See opOperatorName for details.
+	Map(
+		opOperatorName{Var("op")},
+		Check(
+			Has{uast.KeyType: In(
+				nodes.String("OperatorDeclaration"),
+				nodes.String("ConversionOperatorDeclaration"),
+			)},
+			Var("op"),
+		),
+	),
+	funcDefMap("OperatorDeclaration", true, Check(operatorName(binaryOperators, unaryOperators), Var("name")), Obj{
+		"OperatorKeyword": Any(),
+		// TODO: checked operators and operators of interfaces are not supported yet
+		"CheckedKeyword":             opToken("None"),
+		"ExplicitInterfaceSpecifier": Is(nil),
+	}, nil),
+	funcDefMap("ConversionOperatorDeclaration", true, Check(operatorName(conversionOperators), Var("name")), Obj{
+		"OperatorKeyword": Any(),
+		// TODO: checked operators and operators of interfaces are not supported yet
+		"CheckedKeyword":             opToken("None"),
+		"ExplicitInterfaceSpecifier": Is(nil),
+	}, nil),
+	// Local functions have no attributes in older versions of Roslyn,
+	// add an empty field to be able to use funcDefMap for them.
+	Map(
+		Check(
+			Not(Has{"AttributeLists": Any()}),
+			Part("_", Obj{
+				uast.KeyType: String("LocalFunctionStatement"),
+			}),
+		),
+		Part("_", Obj{
+			uast.KeyType:     String("LocalFunctionStatement"),
+			"AttributeLists": Arr(),
+		}),
+	),
+	funcDefMap("LocalFunctionStatement", true, Var("name"),
+		Obj{
+			// type parameters are stored in the FunctionGroup, see funcDefMap
+			"ConstraintClauses": Var("constraints"),
+			"TypeParameterList": typeParamList(),
+		},
+		nil,
+	),
+	// x => x + 1
+	lambdaMap("SimpleLambdaExpression", true,
+		Obj{
+			"Parameter": Var("param"),
+		},
+		Var("pos"),
+		UASTType(uast.FunctionType{}, Obj{
+			"Arguments": Arr(Var("param")),
+		}),
+	),
+	// (x, y) => x + y
+	lambdaMap("ParenthesizedLambdaExpression", true,
+		Obj{
+			// TODO: explicit return types of lambdas are not supported yet
+			"ReturnType": Is(nil),
+			"ParameterList": Obj{
+				uast.KeyType:         String("ParameterList"),
+				uast.KeyPos:          Var("params_pos"),
+				"OpenParenToken":     Any(),
+				"CloseParenToken":    Any(),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"Parameters":         Var("params"),
+			},
+		},
+		Var("pos"),
+		UASTType(uast.FunctionType{}, Obj{
+			uast.KeyPos: Var("params_pos"),
+			"Arguments": Var("params"),
+		}),
+	),
+	// delegate(int x) { return x + 1; }
+	lambdaMap("AnonymousMethodExpression", false,
+		Obj{
+			uast.KeyPos: fullSpanPositions,
+			"DelegateKeyword": Obj{
+				uast.KeyType: String("DelegateKeyword"),
+				uast.KeyPos: UASTType(uast.Positions{}, Obj{
+					uast.KeyStart: Var(KeyDelegate),
+					uast.KeyEnd:   Any(),
+					KeyFullStart:  Any(),
+					KeyFullEnd:    Any(),
+				}),
+				"IsMissing": Bool(false),
+				"Text":      String("delegate"),
+				"Value":     String("delegate"),
+				"ValueText": String("delegate"),
+			},
+			// the same as Body
+			"Block":          Any(),
+			"ExpressionBody": Is(nil),
+			"Body":           Var("body"),
+			// parameter list can be omitted: delegate { }
+			"ParameterList": Cases("caseParams",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("ParameterList"),
+					uast.KeyPos:          Var("params_pos"),
+					"OpenParenToken":     Any(),
+					"CloseParenToken":    Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Parameters":         Var("params"),
+				},
+			),
+		},
+		UASTType(uast.Positions{}, Fields{
+			{Name: uast.KeyStart, Op: Var(uast.KeyStart), Optional: uast.KeyStart + "_exists"},
+			{Name: uast.KeyEnd, Op: Var(uast.KeyEnd), Optional: uast.KeyEnd + "_exists"},
+			{Name: KeyFullStart, Op: Var(KeyFullStart), Optional: KeyFullStart + "_exists"},
+			{Name: KeyFullEnd, Op: Var(KeyFullEnd), Optional: KeyFullEnd + "_exists"},
+			{Name: KeyDelegate, Op: Var(KeyDelegate)},
+		}),
+		Cases("caseParams",
+			UASTType(uast.FunctionType{}, Obj{
+				"Arguments": Is(nil),
+			}),
+			UASTType(uast.FunctionType{}, Obj{
+				uast.KeyPos: Var("params_pos"),
+				"Arguments": Var("params"),
+			}),
+		),
+	),
+	// ConstructorDeclaration is similar to MethodDeclaration, but it may include a
+	// base class initializer that require a special transformation.
+	mapSemanticExt("ConstructorDeclaration", uast.FunctionGroup{}, Obj{
+		"Attributes": Var("attrs"),
+	}, MapObj(
+		Obj{
+			// Same as to MethodDeclaration above
+			"Identifier": Var("name"),
+			"ParameterList": Obj{
+				uast.KeyType:         String("ParameterList"),
+				uast.KeyPos:          Any(),
+				"OpenParenToken":     Any(),
+				"CloseParenToken":    Any(),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"Parameters":         Var("params"),
+			},
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"SemicolonToken":     Any(),
+			"AttributeLists":     Var("attrs"),
+
+			// won't be set for a constructor
+			"ExpressionBody": Is(nil),
+
+			// Initializer is an expression to initialize the base class.
+			// Here we consider case if it's exists in the AST node.
+			//
+			// Initializer is basically a function call that will init the base class.
+			// So we will consider it a first statement of a function body.
+			//
+			// For this we dig into Body above to get the list of statements.
+			// If hasBaseInit is set (initializer exists), we will prepend it
+			// to the array of statement in Body.
+			"Initializer": If("hasBaseInit",
+				// case 1: has base initializer
+				Check(HasType("BaseConstructorInitializer"), Var("baseInit")),
+				// case 2: no initializer
+				Is(nil),
+			),
+			"Body": Part("bodyMap", Obj{
+				"Statements": Var("stmts"),
+			}),
+			"Modifiers": Cases("caseMods",
+				Arr(),
+				NotEmpty(Var("modifiers")),
+			),
+		},
+		Obj{
+			"Nodes": modsAndAlias(
+				UASTType(uast.Alias{}, Obj{
+					"Name": Var("name"),
+					"Node": UASTType(uast.Function{}, Obj{
+						// Restore the function body.
+						//
+						// We will also prepend a base class initializer here, see above.
+						"Body": Part("bodyMap", Obj{
+							"Statements": If("hasBaseInit",
+								// case 1: has base initializer
+								PrependOne(Check(HasType("BaseConstructorInitializer"), Var("baseInit")), Var("stmts")),
+								// case 2: no initializer
+								Var("stmts"),
+							),
+						}),
+						"Type": UASTType(uast.FunctionType{}, Obj{
+							"Arguments": Var("params"),
+						}),
+					}),
+				}),
+			),
+		},
+	)),
+	// Destructor is named after the class, the same way as it's declared: ~Class.
+	// It allows to tell destructors and constructors apart.
+	funcDefMap("DestructorDeclaration", false, opNamePrefix{prefix: "~", sub: Var("name")}, Obj{
+		"TildeToken": Any(),
+	}, nil),
+
+	accessorDefMap("GetAccessorDeclaration", "get"),
+	accessorDefMap("SetAccessorDeclaration", "set"),
+	accessorDefMap("InitAccessorDeclaration", "init"),
+	accessorDefMap("AddAccessorDeclaration", "add"),
+	accessorDefMap("RemoveAccessorDeclaration", "remove"),
+	// Accessors without a body are not functions. These are the accessors of auto-properties
+	// and we only keep their kind, attributes and modifiers.
+	Map(
+		Obj{
+			uast.KeyType: Cases("caseAccessor",
+				String("GetAccessorDeclaration"),
+				String("SetAccessorDeclaration"),
+				String("InitAccessorDeclaration"),
+				String("AddAccessorDeclaration"),
+				String("RemoveAccessorDeclaration"),
+			),
+			uast.KeyPos: Var("pos"),
+			"Keyword": Obj{
+				uast.KeyType: Cases("caseAccessor",
+					String("GetKeyword"),
+					String("SetKeyword"),
+					String("InitKeyword"),
+					String("AddKeyword"),
+					String("RemoveKeyword"),
+				),
+				uast.KeyPos: Any(),
+				"IsMissing": Bool(false),
+				"Text":      accessorKind(),
+				"Value":     accessorKind(),
+				"ValueText": accessorKind(),
+			},
+			"Body":               Is(nil),
+			"ExpressionBody":     Is(nil),
+			"SemicolonToken":     Any(),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"AttributeLists":     Var("attrs"),
+			"Modifiers":          Var("modifiers"),
+		},
+		Obj{
+			uast.KeyType: String("AccessorDeclaration"),
+			uast.KeyPos:  Var("pos"),
+			"Kind":       accessorKind(),
+			"Attributes": Var("attrs"),
+			"Modifiers":  Var("modifiers"),
+		},
+	),
+	propDefMap("PropertyDeclaration", "property", true,
+		Obj{
+			// TODO: remap to custom positional fields
+			"Semicolon":      Any(),
+			"SemicolonToken": Any(),
+			"Initializer": Cases("caseInit",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("EqualsValueClause"),
+					uast.KeyPos:          Any(),
+					"EqualsToken":        Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Value":              Var("init"),
+				},
+			),
+		},
+		Cases("caseInit", Is(nil), Var("init")),
+	),
+	indexerDefMap(),
+	propDefMap("EventDeclaration", "event", false,
+		Obj{
+			// TODO: remap to custom positional fields
+			"EventKeyword":   Any(),
+			"SemicolonToken": Any(),
+		},
+		Is(nil),
+	),
+
+	typeDefMap("ClassDeclaration", "class"),
+	typeDefMap("StructDeclaration", "struct"),
+	typeDefMap("InterfaceDeclaration", "interface"),
+	recordDefMap("RecordDeclaration", "record"),
+	recordDefMap("RecordDeclaration_RecordStructDeclaration", "record struct"),
+
+	// x switch { pattern when condition => value, ... }
+	Map(
+		Obj{
+			uast.KeyType:          String("SwitchExpression"),
+			uast.KeyPos:           Var("pos"),
+			"GoverningExpression": Var("expr"),
+			"Arms":                Var("arms"),
+
+			// TODO: remap to custom positional fields
+			"SwitchKeyword":   Any(),
+			"OpenBraceToken":  Any(),
+			"CloseBraceToken": Any(),
+
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("SwitchExpression"),
+			uast.KeyPos:  Var("pos"),
+			"Expression": Var("expr"),
+			"Arms":       Var("arms"),
+		},
+	),
+	// The condition of the when clause is stored directly in the arm.
+	Map(
+		Obj{
+			uast.KeyType: String("SwitchExpressionArm"),
+			uast.KeyPos:  Var("pos"),
+			"Pattern":    Var("pattern"),
+			"WhenClause": Cases("caseWhen",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("WhenClause"),
+					uast.KeyPos:          Any(),
+					"WhenKeyword":        Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Condition":          Var("when"),
+				},
+			),
+			"Expression": Var("expr"),
+
+			// TODO: remap to custom positional fields
+			"EqualsGreaterThanToken": Any(),
+
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("SwitchExpressionArm"),
+			uast.KeyPos:  Var("pos"),
+			"Pattern":    Var("pattern"),
+			"When":       Cases("caseWhen", Is(nil), Var("when")),
+			"Expression": Var("expr"),
+		},
+	),
+	// Type { Prop: pattern } or Type(pattern, pattern) with an optional designation.
+	// Sub-patterns of both clauses are stored directly in the node.
+	Map(
+		Obj{
+			uast.KeyType: String("RecursivePattern"),
+			uast.KeyPos:  Var("pos"),
+			"Type":       Var("type"),
+			"PositionalPatternClause": Cases("casePositional",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("PositionalPatternClause"),
+					uast.KeyPos:          Any(),
+					"OpenParenToken":     Any(),
+					"CloseParenToken":    Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Subpatterns":        Var("positional"),
+				},
+			),
+			"PropertyPatternClause": Cases("caseProps",
+				Is(nil),
+				Obj{
+					uast.KeyType:         String("PropertyPatternClause"),
+					uast.KeyPos:          Any(),
+					"OpenBraceToken":     Any(),
+					"CloseBraceToken":    Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Subpatterns":        Var("props"),
+				},
+			),
+			"Designation":        Var("desig"),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType:  String("RecursivePattern"),
+			uast.KeyPos:   Var("pos"),
+			"Type":        Var("type"),
+			"Positional":  Cases("casePositional", Is(nil), Var("positional")),
+			"Properties":  Cases("caseProps", Is(nil), Var("props")),
+			"Designation": Var("desig"),
+		},
+	),
+	// Older versions of Roslyn have no ExpressionColon for extended property patterns,
+	// add it to be able to use the same mapping for sub-patterns.
+	Map(
+		Check(
+			Not(Has{"ExpressionColon": Any()}),
+			Part("_", Obj{
+				uast.KeyType: String("Subpattern"),
+				"NameColon":  Var("name"),
+			}),
+		),
+		// the name is dropped from NameColon by the reverse of the mapping below,
+		// thus it's not possible to tell if ExpressionColon was added by this mapping
+		Check(
+			Has{"NameColon": Not(Is(nil))},
+			Part("_", Obj{
+				uast.KeyType:      String("Subpattern"),
+				"NameColon":       Var("name"),
+				"ExpressionColon": Var("name"),
+			}),
+		),
+	),
+	// Name: pattern, or A.B: pattern
+	Map(
+		Obj{
+			uast.KeyType: String("Subpattern"),
+			uast.KeyPos:  Var("pos"),
+			// the same as ExpressionColon, or nil
+			"NameColon": Any(),
+			"ExpressionColon": Cases("caseName",
+				Is(nil),
+				// newer versions of Roslyn duplicate the name in the Expression field
+				Obj{
+					uast.KeyType:         String("NameColon"),
+					uast.KeyPos:          Any(),
+					"ColonToken":         Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Name":               Var("name"),
+					"Expression":         Any(),
+				},
+				Obj{
+					uast.KeyType:         String("NameColon"),
+					uast.KeyPos:          Any(),
+					"ColonToken":         Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Name":               Var("name"),
+				},
+				Obj{
+					uast.KeyType:         String("ExpressionColon"),
+					uast.KeyPos:          Any(),
+					"ColonToken":         Any(),
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+					"Expression":         Var("name"),
+				},
+			),
+			"Pattern":            Var("pattern"),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		// a simple name and an extended property path are kept in separate fields,
+		// since the latter cannot be used in NameColon
+		CasesObj("caseName",
+			// common
+			Obj{
+				uast.KeyType: String("Subpattern"),
+				uast.KeyPos:  Var("pos"),
+				"Pattern":    Var("pattern"),
+			},
+			Objs{
+				{"Name": Is(nil), "Expression": Is(nil)},
+				{"Name": Var("name"), "Expression": Is(nil)},
+				{"Name": Var("name"), "Expression": Is(nil)},
+				{"Name": Is(nil), "Expression": Var("name")},
+			},
+		),
+	),
+	// [pattern, .., pattern]
+	Map(
+		Obj{
+			uast.KeyType:  String("ListPattern"),
+			uast.KeyPos:   Var("pos"),
+			"Patterns":    Var("patterns"),
+			"Designation": Var("desig"),
+
+			// TODO: remap to custom positional fields
+			"OpenBracketToken":  Any(),
+			"CloseBracketToken": Any(),
+
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType:  String("ListPattern"),
+			uast.KeyPos:   Var("pos"),
+			"Patterns":    Var("patterns"),
+			"Designation": Var("desig"),
+		},
+	),
+	// .. or .. pattern inside of a list pattern
+	Map(
+		Obj{
+			uast.KeyType: String("SlicePattern"),
+			uast.KeyPos:  Var("pos"),
+			"Pattern":    Var("pattern"),
+
+			// TODO: remap to custom positional fields
+			"DotDotToken": Any(),
+
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("SlicePattern"),
+			uast.KeyPos:  Var("pos"),
+			"Pattern":    Var("pattern"),
+		},
+	),
+
+	// All other patterns have the same shape as the patterns above: tokens are dropped,
+	// sub-patterns are stored in Pattern, Left and Right fields, values in Expression,
+	// types in Type and variables in Designation.
+	patternMap("ConstantPattern", nil, "Expression"),
+	patternMap("DeclarationPattern", nil, "Type", "Designation"),
+	patternMap("TypePattern", nil, "Type"),
+	patternMap("VarPattern", map[string]string{"VarKeyword": "VarKeyword"}, "Designation"),
+	patternMap("DiscardPattern", map[string]string{"UnderscoreToken": "UnderscoreToken"}),
+	patternMap("ParenthesizedPattern", map[string]string{
+		"OpenParenToken":  "OpenParenToken",
+		"CloseParenToken": "CloseParenToken",
+	}, "Pattern"),
+	// The kind of binary and unary patterns is a part of the type, thus the operator is dropped.
+	patternMap("BinaryPattern_AndPattern", map[string]string{"OperatorToken": "AndKeyword"}, "Left", "Right"),
+	patternMap("BinaryPattern_OrPattern", map[string]string{"OperatorToken": "OrKeyword"}, "Left", "Right"),
+	patternMap("UnaryPattern_NotPattern", map[string]string{"OperatorToken": "NotKeyword"}, "Pattern"),
+	// < value, <= value, > value or >= value
+	Map(
+		Obj{
+			uast.KeyType: String("RelationalPattern"),
+			uast.KeyPos:  Var("pos"),
+			"OperatorToken": Cases("caseOp",
+				opToken("LessThanToken"),
+				opToken("LessThanEqualsToken"),
+				opToken("GreaterThanToken"),
+				opToken("GreaterThanEqualsToken"),
+			),
+			"Expression":         Var("expr"),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("RelationalPattern"),
+			uast.KeyPos:  Var("pos"),
+			"Operator": Cases("caseOp",
+				String("<"),
+				String("<="),
+				String(">"),
+				String(">="),
+			),
+			"Expression": Var("expr"),
+		},
+	),
+
+	// [Name(arg, ...)]
+	Map(
+		Obj{
+			uast.KeyType: String("Attribute"),
+			uast.KeyPos:  Var("pos"),
+			"Name":       Var("name"),
+			"ArgumentList": Cases("caseArgs",
+				Is(nil),
+				Obj{
+					uast.KeyType: String("AttributeArgumentList"),
+					uast.KeyPos:  Any(),
+					"Arguments":  Var("args"),
+
+					// TODO: remap to custom positional fields
+					"OpenParenToken":  Any(),
+					"CloseParenToken": Any(),
+
+					"IsMissing":          Bool(false),
+					"IsStructuredTrivia": Bool(false),
+				},
+			),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+		},
+		Obj{
+			uast.KeyType: String("Attribute"),
+			uast.KeyPos:  Var("pos"),
+			"Name":       Var("name"),
+			// set by opAttributes
+			"Target":    Is(nil),
+			"Arguments": Cases("caseArgs", Arr(), Var("args")),
+		},
+	),
+	// Name = expr
+	//
+	// Named arguments that set a property or a field of the attribute are marked as Property.
+	// It is a separate mapping, so the reverse transformation can distinguish it from name: expr.
+	Map(
+		Obj{
+			uast.KeyType:         String("AttributeArgument"),
+			uast.KeyPos:          Var("pos"),
+			"Expression":         Var("value"),
+			"IsMissing":          Bool(false),
+			"IsStructuredTrivia": Bool(false),
+			"NameColon":          Is(nil),
+			"NameEquals": Obj{
+				uast.KeyType:         String("NameEquals"),
+				uast.KeyPos:          Any(),
+				"EqualsToken":        Any(),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+				"Name":               Var("name"),
+			},
+		},
+		Obj{
+			uast.KeyType: String("AttributeArgument"),
+			uast.KeyPos:  Var("pos"),
+			"Name":       Var("name"),
+			"Value":      Var("value"),
+			"Property":   Bool(true),
+		},
+	),
+	// expr or name: expr
+	Map(
+		CasesObj("caseName",
+			// common
+			Obj{
+				uast.KeyType:         String("AttributeArgument"),
+				uast.KeyPos:          Var("pos"),
+				"Expression":         Var("value"),
+				"IsMissing":          Bool(false),
+				"IsStructuredTrivia": Bool(false),
+			},
+			Objs{
+				// case 1: positional argument
+				{
+					"NameColon":  Is(nil),
+					"NameEquals": Is(nil),
+				},
+				// case 2: name: expr
+				{
+					// newer versions of Roslyn duplicate the name in the Expression field
+					"NameColon": Obj{
+						uast.KeyType:         String("NameColon"),
+						uast.KeyPos:          Any(),
+						"ColonToken":         Any(),
+						"IsMissing":          Bool(false),
+						"IsStructuredTrivia": Bool(false),
+						"Name":               Var("name"),
+						"Expression":         Any(),
+					},
+					"NameEquals": Is(nil),
+				},
+				// case 3: name: expr
+				{
+					"NameColon": Obj{
+						uast.KeyType:         String("NameColon"),
+						uast.KeyPos:          Any(),
+						"ColonToken":         Any(),
+						"IsMissing":          Bool(false),
+						"IsStructuredTrivia": Bool(false),
+						"Name":               Var("name"),
+					},
+					"NameEquals": Is(nil),
+				},
+			},
+		),
+		Obj{
+			uast.KeyType: String("AttributeArgument"),
+			uast.KeyPos:  Var("pos"),
+			"Name":       Cases("caseName", Is(nil), Var("name"), Var("name")),
+			"Value":      Var("value"),
+			"Property":   Bool(false),
+		},
+	),
+
+	// Namespaces have no attributes and modifiers in older versions of Roslyn,
+	// add empty fields to be able to use namespaceDefMap for them.
+	Map(
+		Check(
+			Not(Has{"AttributeLists": Any()}),
+			Part("_", Obj{
+				uast.KeyType: String("NamespaceDeclaration"),
+			}),
+		),
+		Part("_", Obj{
+			uast.KeyType:     String("NamespaceDeclaration"),
+			"AttributeLists": Arr(),
+			"Modifiers":      Arr(),
+		}),
+	),
+	// namespace A.B { ... }
+	namespaceDefMap("NamespaceDeclaration", false, Obj{
+		// TODO: remap to custom positional fields
+		"OpenBraceToken":  Any(),
+		"CloseBraceToken": Any(),
+	}),
+	// namespace A.B;
+	namespaceDefMap("FileScopedNamespaceDeclaration", true, nil),
+
+	// Top-level statements of C# 9 programs and C# scripts are wrapped into GlobalStatement.
+	// All of them are moved to an implicit entry point function, see opEntryPoint.
+	Map(
+		Part("_", Obj{
+			uast.KeyType: String("CompilationUnit"),
+			"Members":    Var("members"),
+		}),
+		Part("_", Obj{
+			uast.KeyType: String("CompilationUnit"),
+			"Members":    opEntryPoint{Var("members")},
+		}),
+	),
+
+	// All other declarations keep the attributes in the same field.
+	//
+	// Nodes produced by the mappings above also have the Attributes field, thus they are
+	// excluded for the reverse transformation. AttributeList is excluded for the same reason.
+	Map(
+		Part("_", Obj{"AttributeLists": Var("attrs")}),
+		Check(
+			Not(Has{uast.KeyType: In(
+				nodes.String(typeFuncGroup),
+				nodes.String(uast.TypeOf(uast.Argument{})),
+				nodes.String("TypeDeclaration"),
+				nodes.String("BasePropertyDeclaration"),
+				nodes.String("AccessorDeclaration"),
+				nodes.String("GenericParameter"),
+				nodes.String("AttributeList"),
+			)}),
+			Part("_", Obj{"Attributes": Var("attrs")}),
+		),
+	),
+
+	// Merge uast:Group with uast:FunctionGroup.
+	Map(
+		opMergeGroups{Var("group")},
+		Check(
+			Has{uast.KeyType: In(
+				nodes.String(typeFuncGroup),
+				nodes.String(typeGroup),
+			)},
+			Var("group"),
+		),
+	),
+}
+
+// dropNils accepts a array node, removes all nil values from it and passes it to
+// a specified suboperation.
+// It will not restore nil values when constructing nodes. This is not an issue for
+// the reverse transformation, since Normalize drops them again.
+type dropNils struct {
+	op Op
+}
+
+func (op dropNils) Kinds() nodes.Kind {
+	return nodes.KindArray
+}
+
+func (op dropNils) Check(st *State, n nodes.Node) (bool, error) {
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return false, nil
+	}
+	out := make(nodes.Array, 0, len(arr))
+	for _, e := range arr {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return op.op.Check(st, out)
+}
+
+func (op dropNils) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	return op.op.Construct(st, n)
+}
+
+var (
+	typeGroup     = uast.TypeOf(uast.Group{})
+	typeFuncGroup = uast.TypeOf(uast.FunctionGroup{})
+)
+
+// triviaField specified a field with an array to put trivias into.
+var triviaField = map[string]string{
+	"Block":           "Statements",
+	"CompilationUnit": "Members",
+}
+
+// firstWithType returns an index of the first node type of which matches the filter function.
+func firstWithType(arr nodes.Array, fnc func(typ string) bool) int {
+	for i, sub := range arr {
+		if fnc(uast.TypeOf(sub)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstField specifies a field that holds the first child of the node, if it has no
+// attributes and modifiers.
+var firstField = map[string]string{
+	"FieldDeclaration":          "Declaration",
+	"EventFieldDeclaration":     "Declaration",
+	"LocalDeclarationStatement": "Declaration",
+	"VariableDeclaration":       "Type",
+	"PropertyDeclaration":       "Type",
+	"IndexerDeclaration":        "Type",
+}
+
+// firstChild returns the first child of a declaration that may contain leading trivia
+// of the declaration, and a function to replace it in a copy of the node.
+//
+// The first child is either the first attribute list, the first modifier, or a field
+// specified in firstField.
+func firstChild(obj nodes.Object) (nodes.Node, func(obj nodes.Object, n nodes.Node)) {
+	for _, key := range []string{"AttributeLists", "Modifiers"} {
+		arr, _ := obj[key].(nodes.Array)
+		if len(arr) == 0 {
+			continue
+		}
+		return arr[0], func(obj nodes.Object, n nodes.Node) {
+			arr = arr.CloneList()
+			arr[0] = n
+			obj[key] = arr
+		}
+	}
+	key, ok := firstField[uast.TypeOf(obj)]
+	if !ok {
+		return nil, nil
+	}
+	return obj[key], func(obj nodes.Object, n nodes.Node) {
+		obj[key] = n
+	}
+}
+
+// opMoveTrivias cuts trivia nodes from LeadingTrivia/TrailingTrivia fields
+// and wraps the node into uast:Group that contains those trivias.
+type opMoveTrivias struct {
+	sub Op
+}
+
+func (op opMoveTrivias) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+// Check implements the logic to move the trivia out of the node into a Group that will
+// wrap the trivia and the node itself.
+//
+// The function is a bit more complex than it should be because there are some edge cases
+// where instead of wrapping the node we will add trivia to a specific field of the node.
+//
+// There are two general cases here that may overlap.
+//
+// First, some nodes will have a Leading/TrailingTrivia fields. We will remove those fields
+// from the node, and will wrap the node itself into a uast:Group with an array consisting
+// of (leading trivia + node + trailing trivia).
+//
+// There are some edge cases here. For example, we don't want to wrap a CompilationUnit nodes
+// so we will add trivia nodes to it's Members slice (see triviaField map for all such cases).
+//
+// But, we can't stop here because the Group will prevent other annotations to match against
+// the original node. To fix this, we also try to access few known fields and check if they
+// already contain a Group. If it does, we unwrap the node and join its trivia into our
+// leading/trailing slice. This is possible because DSL guarantees that transforms always
+// happen in DFS order, thus all child nodes were already visited by this transform.
+func (op opMoveTrivias) Check(st *State, n nodes.Node) (bool, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	modified := false
+	leading, ok1 := obj["LeadingTrivia"].(nodes.Array)
+	trailing, ok2 := obj["TrailingTrivia"].(nodes.Array)
+	if ok1 || ok2 {
+		// we saved the leading and trailing trivias, now wipe them from the node
+		obj = obj.CloneObject()
+		modified = true
+		delete(obj, "LeadingTrivia")
+		delete(obj, "TrailingTrivia")
+	}
+
+	// move comments out of keywords and tokens into actual AST nodes
+	// TODO(dennwc): handle more cases:
+	//				 - Modifiers?
+	for key, sub := range obj {
+		if key != "ReturnType" &&
+			!strings.HasSuffix(key, "Token") &&
+			!strings.HasSuffix(key, "Keyword") {
+			continue
+		}
+		if uast.TypeOf(sub) != typeGroup {
+			continue
+		}
+		group := sub.(nodes.Object)
+		arr, ok := group["Nodes"].(nodes.Array)
+		if !ok {
+			continue
+		}
+		// we already joined trivias and the node into a single array,
+		// so we will have to find its index now
+		ind := firstWithType(arr, func(typ string) bool {
+			return !strings.HasSuffix(typ, "Trivia")
+		})
+
+		var node nodes.Node
+		if ind < 0 {
+			// cannot determine an index - pretend everything is a leading trivia
+			// TODO(dennwc): this should not happen in practice, since leading/trailing
+			//  			 trivias are always attached to a node, and this node should
+			//  			 be somewhere in this slice
+			//  			 but future annotations may drop this node, so we will need
+			//  			 to find a different way of splitting leading and trailing
+			// 				 trivia if it happens in practice
+			leading = append(leading.CloneList(), arr...)
+		} else {
+			node = arr[ind]
+			leading = append(leading.CloneList(), arr[:ind]...)
+			trailing = append(arr[ind+1:len(arr):len(arr)], trailing...)
+		}
+		if !modified {
+			obj = obj.CloneObject()
+			modified = true
+		}
+		obj[key] = node
+	}
+
+	// the first token of a declaration may also be the first attribute or modifier,
+	// or the type of a field, move comments (including documentation) from it to
+	// the declaration itself
+	if first, set := firstChild(obj); uast.TypeOf(first) == typeGroup {
+		group := first.(nodes.Object)
+		sub, _ := group["Nodes"].(nodes.Array)
+		ind := firstWithType(sub, func(typ string) bool {
+			return !strings.HasSuffix(typ, "Trivia")
+		})
+		if ind > 0 {
+			if !modified {
+				obj = obj.CloneObject()
+				modified = true
+			}
+			leading = append(sub[:ind:ind], leading...)
+			if ind+1 < len(sub) {
+				// keep trailing trivia of the first child in place
+				group = group.CloneObject()
+				group["Nodes"] = sub[ind:]
+				set(obj, group)
+			} else {
+				set(obj, sub[ind])
+			}
+		}
+	}
+
+	if len(leading) == 0 && len(trailing) == 0 {
+		if !modified {
+			return false, nil // unmodified
+		}
+		// removed the trivia fields
+		return op.sub.Check(st, obj)
+	}
+
+	if field, ok := triviaField[uast.TypeOf(obj)]; ok {
+		// instead of wrapping the node, join trivias to a specified field
+		old, ok := obj[field].(nodes.Array)
+		if !ok {
+			return false, fmt.Errorf("expected %q field to be an array", field)
+		}
+		arr := make(nodes.Array, 0, len(leading)+len(old)+len(trailing))
+		arr = append(arr, leading...)
+		arr = append(arr, old...)
+		arr = append(arr, trailing...)
+
+		obj[field] = arr
+		return op.sub.Check(st, obj)
+	}
+
+	// wrap the node into a uast:Group
+	arr := make(nodes.Array, 0, len(leading)+1+len(trailing))
+	arr = append(arr, leading...)
+	arr = append(arr, obj)
+	arr = append(arr, trailing...)
+
+	group, err := uast.ToNode(uast.Group{})
+	if err != nil {
+		return false, err
+	}
+	// the group spans the node together with its trivia, which is the FullSpan of the node
+	pos := fullSpanOf(obj)
+
+	// note that we overwrite a variable - it was the current node
+	// and now it is a Group wrapping the current node
+	obj = group.(nodes.Object)
+	obj["Nodes"] = arr
+	if pos != nil {
+		obj[uast.KeyPos] = pos.ToObject()
+	}
+	return op.sub.Check(st, obj)
+}
+
+// Construct unwraps the node from a uast:Group, and moves the trivia of the group to
+// the Leading/TrailingTrivia fields of the node.
+//
+// Trivia that was moved from tokens and children of the node to the group is moved to the
+// node itself, and trivia in triviaField arrays is kept in place. Both are normalized to
+// the same groups by Check.
+func (op opMoveTrivias) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	group, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(group) != typeGroup {
+		return n, nil
+	}
+	arr, ok := group["Nodes"].(nodes.Array)
+	if !ok {
+		return nil, errors.New("expected an array in Group.Nodes")
+	}
+	notTrivia := func(typ string) bool {
+		return !strings.HasSuffix(typ, "Trivia")
+	}
+	ind := firstWithType(arr, notTrivia)
+	if ind < 0 || firstWithType(arr[ind+1:], notTrivia) >= 0 {
+		// not created by this op
+		return n, nil
+	}
+	obj, ok := arr[ind].(nodes.Object)
+	if !ok {
+		return n, nil
+	}
+	leading, _ := obj["LeadingTrivia"].(nodes.Array)
+	trailing, _ := obj["TrailingTrivia"].(nodes.Array)
+
+	obj = obj.CloneObject()
+	obj["LeadingTrivia"] = append(arr[:ind:ind], leading...)
+	obj["TrailingTrivia"] = append(trailing.CloneList(), arr[ind+1:]...)
+	return obj, nil
+}
+
+// opMergeGroups finds the uast:Group nodes and merges them into a child
+// uast:FunctionGroup, if it exists.
+//
+// This transform is necessary because opMoveTrivias will wrap all nodes that contain trivia
+// into a Group node, and the same will happen with MethodDeclaration nodes. But according
+// to a UAST schema defined in SDK, the comments (trivia) should be directly inside the
+// FunctionGroup node that wraps functions in Semantic mode.
+type opMergeGroups struct {
+	sub Op
+}
+
+func (op opMergeGroups) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+// Check tests if a current node is uast:Group and uast:FuncGroup and contains group of
+// another kind. It will remove the second group and merge children into current one.
+// uast:FuncGroup is preferred.
+//
+// See https://github.com/bblfsh/sdk/issues/361.
+func (op opMergeGroups) Check(st *State, n nodes.Node) (bool, error) {
+	group, ok := n.(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	switch uast.TypeOf(group) {
+	case typeGroup:
+		return op.checkGroup(st, group)
+	case typeFuncGroup:
+		return op.checkFuncGroup(st, group)
+	}
+	return false, nil
+}
+
+// checkGroup tests if the current node is uast:Group and if it contains a uast:FunctionGroup
+// node, it will rebuild the node by removing the current node and merge other children into
+// the FunctionGroup. The changed node will be passed to the sub-operation.
+func (op opMergeGroups) checkGroup(st *State, group nodes.Object) (bool, error) {
+	arr, ok := group["Nodes"].(nodes.Array)
+	if !ok {
+		return false, errors.New("expected an array in Group.Nodes")
+	}
+	ind := firstWithType(arr, func(typ string) bool {
+		return typ == typeFuncGroup
+	})
+	if ind < 0 {
+		return false, nil
+	}
+	leading := arr[:ind]
+	fgroup := arr[ind].(nodes.Object)
+	trailing := arr[ind+1:]
+
+	arr, ok = fgroup["Nodes"].(nodes.Array)
+	if !ok {
+		return false, errors.New("expected an array in Group.Nodes")
+	}
+	out := make(nodes.Array, 0, len(leading)+len(arr)+len(trailing))
+	out = append(out, leading...)
+	out = append(out, arr...)
+	out = append(out, trailing...)
+
+	fgroup = fgroup.CloneObject()
+	fgroup["Nodes"] = out
+
+	return op.sub.Check(st, fgroup)
+}
+
+// checkFuncGroup tests if the current node is uast:FuncGroup and if any of its sub-arrays
+// contain a uast:Group, it will be removed and the children will be flattened into a sub-array.
+func (op opMergeGroups) checkFuncGroup(st *State, fgroup nodes.Object) (bool, error) {
+	// primary nodes array in the function group
+	arr, ok := fgroup["Nodes"].(nodes.Array)
+	if !ok {
+		return false, errors.New("expected an array in FuncGroup.Nodes")
+	}
+	modified := false
+	for i := 0; i < len(arr); i++ {
+		v := arr[i]
+		// Since we will run this for every group, let's clean a group
+		// array from nils here. It could be a separate transform, but
+		// it may affect performance, effectively running all checks twice.
+		if v == nil {
+			if !modified {
+				arr = arr.CloneList()
+				modified = true
+			}
+			arr = append(arr[:i], arr[i+1:]...)
+			i--
+			continue
+		}
+		// secondary arrays the group annotations/modifiers, etc
+		arr2, ok := v.(nodes.Array)
+		if !ok {
+			continue
+		}
+		// find a group node there
+		ind := firstWithType(arr2, func(typ string) bool {
+			return typ == typeGroup
+		})
+		if ind < 0 {
+			continue
+		}
+		group := arr2[ind].(nodes.Object)
+		// children array of an inner group
+		arr3, ok := group["Nodes"].(nodes.Array)
+		if !ok {
+			return false, errors.New("expected an array in Group.Nodes")
+		}
+		// flatten inner array into the secondary array
+		out := make(nodes.Array, 0, len(arr2)-1+len(arr3))
+		out = append(out, arr2[:ind]...)
+		out = append(out, arr3...)
+		out = append(out, arr2[ind+1:]...)
+		if !modified {
+			arr = arr.CloneList()
+			modified = true
+		}
+		arr[i] = out
+	}
+	if !modified {
+		return false, nil
+	}
+	fgroup = fgroup.CloneObject()
+	fgroup["Nodes"] = arr
+	return op.sub.Check(st, fgroup)
+}
+
+// Construct is the reverse of Check. If the uast:FuncGroup node starts or ends with trivia,
+// it's moved to a uast:Group that wraps the node. Trivia in sub-arrays of the node is
+// wrapped into a uast:Group with an adjacent node.
+//
+// Nil values removed by Check are not restored, see dropNils.
+func (op opMergeGroups) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	fgroup, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(fgroup) != typeFuncGroup {
+		return n, nil
+	}
+	arr, ok := fgroup["Nodes"].(nodes.Array)
+	if !ok {
+		return nil, errors.New("expected an array in FuncGroup.Nodes")
+	}
+	start, end := 0, len(arr)
+	for start < end && isTrivia(arr[start]) {
+		start++
+	}
+	for end > start && isTrivia(arr[end-1]) {
+		end--
+	}
+	out := make(nodes.Array, 0, end-start)
+	for _, v := range arr[start:end] {
+		if arr2, ok := v.(nodes.Array); ok {
+			v, err = groupTrivia(arr2)
+			if err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, v)
+	}
+	fgroup = fgroup.CloneObject()
+	fgroup["Nodes"] = out
+	if start == 0 && end == len(arr) {
+		return fgroup, nil
+	}
+	group, err := uast.ToNode(uast.Group{})
+	if err != nil {
+		return nil, err
+	}
+	obj := group.(nodes.Object)
+	nodesArr := make(nodes.Array, 0, len(arr)-len(out)+1)
+	nodesArr = append(nodesArr, arr[:start]...)
+	nodesArr = append(nodesArr, fgroup)
+	nodesArr = append(nodesArr, arr[end:]...)
+	obj["Nodes"] = nodesArr
+	return obj, nil
+}
+
+// groupTrivia is the reverse of checkFuncGroup for a single sub-array. It wraps the first
+// sequence of trivia nodes into a uast:Group together with the preceding node, or with
+// the following node, if there is none.
+func groupTrivia(arr nodes.Array) (nodes.Array, error) {
+	start := -1
+	for i, v := range arr {
+		if uast.TypeOf(v) == typeGroup {
+			// the first group was flattened, thus the trivia must precede it
+			break
+		} else if isTrivia(v) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return arr, nil
+	}
+	end := start
+	for end < len(arr) && isTrivia(arr[end]) {
+		end++
+	}
+	if start > 0 {
+		start--
+	} else if end < len(arr) {
+		end++
+	}
+	group, err := uast.ToNode(uast.Group{})
+	if err != nil {
+		return nil, err
+	}
+	obj := group.(nodes.Object)
+	obj["Nodes"] = append(nodes.Array{}, arr[start:end]...)
+
+	out := make(nodes.Array, 0, len(arr)-(end-start)+1)
+	out = append(out, arr[:start]...)
+	out = append(out, obj)
+	out = append(out, arr[end:]...)
+	return out, nil
+}
+
+// isTrivia checks if the node is a trivia node, either native or normalized.
+func isTrivia(n nodes.Node) bool {
+	switch typ := uast.TypeOf(n); typ {
+	case uast.TypeOf(uast.Comment{}), "DocumentationComment":
+		return true
+	default:
+		return strings.HasSuffix(typ, "Trivia")
+	}
+}
+
+// opAccessors joins the names of accessors with the name of the property, for example
+// "get" accessor of a property "Name" will become "get_Name", as in CLR.
+//
+// It also fills the implicit signature of accessors: getters return the type of the property
+// and all other accessors accept a "value" argument of this type.
+//
+// The property is marked as Auto if none of the accessors were converted to a FunctionGroup.
+type opAccessors struct {
+	sub Op
+}
+
+func (op opAccessors) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+func (op opAccessors) Check(st *State, n nodes.Node) (bool, error) {
+	alias, ok := n.(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	prop, ok := alias["Node"].(nodes.Object)
+	if !ok || uast.TypeOf(prop) != "BasePropertyDeclaration" {
+		return false, nil
+	}
+	name, err := identName(alias["Name"])
+	if err != nil {
+		return false, err
+	}
+	accessors, ok := prop["Accessors"].(nodes.Array)
+	if !ok {
+		return false, nil
+	}
+	accessors, err = restoreAccessors(accessors, name)
+	if err != nil {
+		return false, err
+	}
+	prop = prop.CloneObject()
+	delete(prop, "Auto")
+	prop["Accessors"] = accessors
+	alias = alias.CloneObject()
+	alias["Node"] = prop
+	return op.sub.Check(st, alias)
+}
+
+func (op opAccessors) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	alias, ok := n.(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, n)
+	}
+	id, ok := alias["Name"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, alias["Name"])
+	}
+	name, _ := id["Name"].(nodes.String)
+	prop, ok := alias["Node"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, alias["Node"])
+	}
+	accessors, ok := prop["Accessors"].(nodes.Array)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, prop["Accessors"])
+	}
+	accessors, auto, err := renameAccessors(accessors, name, prop["Type"], nil)
+	if err != nil {
+		return nil, err
+	}
+	prop = prop.CloneObject()
+	prop["Accessors"] = accessors
+	prop["Auto"] = nodes.Bool(auto)
+	alias = alias.CloneObject()
+	alias["Node"] = prop
+	return alias, nil
+}
+
+// renameAccessors joins the names of accessor FunctionGroups in the array with a property name
+// using accessorAlias. It returns a new array and a flag indicating that none of the accessors
+// have a body.
+func renameAccessors(accessors nodes.Array, name nodes.String, typ nodes.Node, params nodes.Array) (nodes.Array, bool, error) {
+	auto := true
+	accessors = accessors.CloneList()
+	for i, sub := range accessors {
+		if uast.TypeOf(sub) != typeFuncGroup {
+			continue
+		}
+		auto = false
+		group := sub.(nodes.Object).CloneObject()
+		arr, ok := group["Nodes"].(nodes.Array)
+		if !ok {
+			return nil, false, errors.New("expected an array in FuncGroup.Nodes")
+		}
+		arr = arr.CloneList()
+		ind := firstWithType(arr, func(typ string) bool {
+			return typ == uast.TypeOf(uast.Alias{})
+		})
+		if ind < 0 {
+			return nil, false, errors.New("expected an alias in accessor FuncGroup")
+		}
+		fnc, err := accessorAlias(arr[ind].(nodes.Object), name, typ, params)
+		if err != nil {
+			return nil, false, err
+		}
+		arr[ind] = fnc
+		group["Nodes"] = arr
+		accessors[i] = group
+	}
+	return accessors, auto, nil
+}
+
+// restoreAccessors is the reverse of renameAccessors. It restores the temporary names of
+// accessor aliases and removes their implicit signatures.
+func restoreAccessors(accessors nodes.Array, name nodes.String) (nodes.Array, error) {
+	accessors = accessors.CloneList()
+	for i, sub := range accessors {
+		if uast.TypeOf(sub) != typeFuncGroup {
+			continue
+		}
+		group := sub.(nodes.Object).CloneObject()
+		arr, ok := group["Nodes"].(nodes.Array)
+		if !ok {
+			return nil, errors.New("expected an array in FuncGroup.Nodes")
+		}
+		arr = arr.CloneList()
+		ind := firstWithType(arr, func(typ string) bool {
+			return typ == uast.TypeOf(uast.Alias{})
+		})
+		if ind < 0 {
+			return nil, errors.New("expected an alias in accessor FuncGroup")
+		}
+		fnc, err := accessorKeyword(arr[ind].(nodes.Object), name)
+		if err != nil {
+			return nil, err
+		}
+		arr[ind] = fnc
+		group["Nodes"] = arr
+		accessors[i] = group
+	}
+	return accessors, nil
+}
+
+// opIndexerAccessors is similar to opAccessors, but works directly on an array of accessors
+// of the indexer. All the accessors are named after the CLR name of the indexer property (Item)
+// and accept parameters of the indexer, as in CLR: get_Item(params) and set_Item(params, value).
+type opIndexerAccessors struct {
+	typ    Op
+	params Op
+	sub    Op
+}
+
+func (op opIndexerAccessors) Kinds() nodes.Kind {
+	return nodes.KindArray
+}
+
+func (op opIndexerAccessors) Check(st *State, n nodes.Node) (bool, error) {
+	accessors, ok := n.(nodes.Array)
+	if !ok {
+		return false, nil
+	}
+	accessors, err := restoreAccessors(accessors, "Item")
+	if err != nil {
+		return false, err
+	}
+	return op.sub.Check(st, accessors)
+}
+
+func (op opIndexerAccessors) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	typ, err := op.typ.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := op.params.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := nd.(nodes.Array)
+	if !ok && nd != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, nd)
+	}
+	n, err = op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	accessors, ok := n.(nodes.Array)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, n)
+	}
+	accessors, _, err = renameAccessors(accessors, "Item", typ, params)
+	if err != nil {
+		return nil, err
+	}
+	return accessors, nil
+}
+
+// accessorAlias renames a temporary accessor alias created by accessorDefMap and sets
+// an implicit signature of the accessor function. Parameters of indexers are prepended
+// to the arguments of all accessors.
+func accessorAlias(alias nodes.Object, prop nodes.String, typ nodes.Node, params nodes.Array) (nodes.Object, error) {
+	id, ok := alias["Name"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, alias["Name"])
+	}
+	kw, ok := id["Name"].(nodes.String)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.String(""), id["Name"])
+	}
+	fnc, ok := alias["Node"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, alias["Node"])
+	}
+	ftyp, ok := fnc["Type"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, fnc["Type"])
+	}
+	arg, err := uast.ToNode(uast.Argument{})
+	if err != nil {
+		return nil, err
+	}
+	argObj := arg.(nodes.Object)
+	// implicit argument has no positions
+	delete(argObj, uast.KeyPos)
+	argObj["Type"] = typ
+
+	args := make(nodes.Array, 0, len(params)+1)
+	for _, p := range params {
+		if p != nil {
+			p = p.Clone()
+		}
+		args = append(args, p)
+	}
+	ftyp = ftyp.CloneObject()
+	if kw == "get" {
+		ftyp["Returns"] = nodes.Array{argObj}
+	} else {
+		name, err := uast.ToNode(uast.Identifier{Name: "value"})
+		if err != nil {
+			return nil, err
+		}
+		nameObj := name.(nodes.Object)
+		delete(nameObj, uast.KeyPos)
+		argObj["Name"] = nameObj
+		args = append(args, argObj)
+	}
+	if len(args) != 0 {
+		ftyp["Arguments"] = args
+	}
+	fnc = fnc.CloneObject()
+	fnc["Type"] = ftyp
+
+	id = id.CloneObject()
+	id["Name"] = kw + "_" + prop
+
+	alias = alias.CloneObject()
+	alias["Name"] = id
+	alias["Node"] = fnc
+	return alias, nil
+}
+
+// accessorKeyword is the reverse of accessorAlias. It restores the temporary name of
+// the accessor alias from the CLR name and removes the implicit signature of the function.
+func accessorKeyword(alias nodes.Object, prop nodes.String) (nodes.Object, error) {
+	id, ok := alias["Name"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, alias["Name"])
+	}
+	name, ok := id["Name"].(nodes.String)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.String(""), id["Name"])
+	}
+	kw := strings.TrimSuffix(string(name), "_"+string(prop))
+	if kw == string(name) {
+		return nil, fmt.Errorf("accessor %q doesn't match the property %q", name, prop)
+	}
+	fnc, ok := alias["Node"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, alias["Node"])
+	}
+	ftyp, ok := fnc["Type"].(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, fnc["Type"])
+	}
+	ftyp = ftyp.CloneObject()
+	ftyp["Arguments"] = nil
+	if kw == "get" {
+		ftyp["Returns"] = nil
+	}
+	fnc = fnc.CloneObject()
+	fnc["Type"] = ftyp
+
+	id = id.CloneObject()
+	id["Name"] = nodes.String(kw)
+
+	alias = alias.CloneObject()
+	alias["Name"] = id
+	alias["Node"] = fnc
+	return alias, nil
+}
+
+// binaryOperators maps binary operator tokens to CLR names of operator methods.
+var binaryOperators = map[string]string{
+	"PlusToken":                   "op_Addition",
+	"MinusToken":                  "op_Subtraction",
+	"AsteriskToken":               "op_Multiply",
+	"SlashToken":                  "op_Division",
+	"PercentToken":                "op_Modulus",
+	"AmpersandToken":              "op_BitwiseAnd",
+	"BarToken":                    "op_BitwiseOr",
+	"CaretToken":                  "op_ExclusiveOr",
+	"LessThanLessThanToken":       "op_LeftShift",
+	"GreaterThanGreaterThanToken": "op_RightShift",
+	"EqualsEqualsToken":           "op_Equality",
+	"ExclamationEqualsToken":      "op_Inequality",
+	"LessThanToken":               "op_LessThan",
+	"GreaterThanToken":            "op_GreaterThan",
+	"LessThanEqualsToken":         "op_LessThanOrEqual",
+	"GreaterThanEqualsToken":      "op_GreaterThanOrEqual",
+}
+
+// unaryOperators maps unary operator tokens to CLR names of operator methods.
+var unaryOperators = map[string]string{
+	"PlusToken":        "op_UnaryPlus",
+	"MinusToken":       "op_UnaryNegation",
+	"ExclamationToken": "op_LogicalNot",
+	"TildeToken":       "op_OnesComplement",
+	"PlusPlusToken":    "op_Increment",
+	"MinusMinusToken":  "op_Decrement",
+	"TrueKeyword":      "op_True",
+	"FalseKeyword":     "op_False",
+}
+
+// conversionOperators maps conversion operator keywords to CLR names of operator methods.
+var conversionOperators = map[string]string{
+	"ImplicitKeyword": "op_Implicit",
+	"ExplicitKeyword": "op_Explicit",
+}
+
+// opOperatorName generates an Identifier field for OperatorDeclaration and
+// ConversionOperatorDeclaration nodes, so they can be normalized by funcDefMap.
+//
+// The name is derived from the operator token, following the CLR naming of operator
+// methods (op_Addition, op_Implicit, etc). The token is removed from the node, and its
+// position is used for the identifier. Since the same token may be used both for unary
+// and binary operators, we use the number of parameters to select the name.
+//
+// The Type field of the conversion operator is also renamed to ReturnType.
+type opOperatorName struct {
+	sub Op
+}
+
+func (op opOperatorName) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+func (op opOperatorName) Check(st *State, n nodes.Node) (bool, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	var (
+		tokField string
+		names    map[string]string
+	)
+	switch uast.TypeOf(obj) {
+	case "OperatorDeclaration":
+		tokField = "OperatorToken"
+		names = binaryOperators
+		if list, ok := obj["ParameterList"].(nodes.Object); ok {
+			if params, ok := list["Parameters"].(nodes.Array); ok && len(params) == 1 {
+				names = unaryOperators
+			}
+		}
+	case "ConversionOperatorDeclaration":
+		tokField = "ImplicitOrExplicitKeyword"
+		names = conversionOperators
+	default:
+		return false, nil
+	}
+	tok, ok := obj[tokField].(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	name, ok := names[uast.TypeOf(tok)]
+	if !ok {
+		return false, nil
+	}
+	id, err := uast.ToNode(uast.Identifier{Name: name})
+	if err != nil {
+		return false, err
+	}
+	idObj := id.(nodes.Object)
+	idObj[uast.KeyPos] = tok[uast.KeyPos]
+
+	obj = obj.CloneObject()
+	delete(obj, tokField)
+	obj["Identifier"] = idObj
+	if typ, ok := obj["Type"]; ok {
+		delete(obj, "Type")
+		obj["ReturnType"] = typ
+	}
+	return op.sub.Check(st, obj)
+}
+
+func (op opOperatorName) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return n, nil
+	}
+	var names []map[string]string
+	tokField := "OperatorToken"
+	switch uast.TypeOf(obj) {
+	case "OperatorDeclaration":
+		names = []map[string]string{binaryOperators, unaryOperators}
+	case "ConversionOperatorDeclaration":
+		tokField = "ImplicitOrExplicitKeyword"
+		names = []map[string]string{conversionOperators}
+	default:
+		return n, nil
+	}
+	id, ok := obj["Identifier"].(nodes.Object)
+	if !ok || uast.TypeOf(id) != uast.TypeOf(uast.Identifier{}) {
+		return n, nil
+	}
+	name, _ := id["Name"].(nodes.String)
+	for _, m := range names {
+		for typ, opName := range m {
+			if opName != string(name) {
+				continue
+			}
+			obj = obj.CloneObject()
+			delete(obj, "Identifier")
+			obj[tokField] = nodes.Object{
+				uast.KeyType: nodes.String(typ),
+				uast.KeyPos:  id[uast.KeyPos],
+			}
+			if typ, ok := obj["ReturnType"]; ok && tokField != "OperatorToken" {
+				delete(obj, "ReturnType")
+				obj["Type"] = typ
+			}
+			return obj, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operator name: %q", name)
+}
+
+// operatorName checks that the name of uast:Identifier is one of the names of operator methods.
+func operatorName(names ...map[string]string) Sel {
+	var list []nodes.Value
+	for _, m := range names {
+		for _, name := range m {
+			list = append(list, nodes.String(name))
+		}
+	}
+	return Has{"Name": In(list...)}
+}
+
+// opNamePrefix adds a prefix to the name of uast:Identifier node. The reverse transformation
+// only accepts identifiers with this prefix, and removes it.
+type opNamePrefix struct {
+	prefix string
+	sub    Op
+}
+
+func (op opNamePrefix) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+func (op opNamePrefix) Check(st *State, n nodes.Node) (bool, error) {
+	id, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(id) != uast.TypeOf(uast.Identifier{}) {
+		return false, nil
+	}
+	name, _ := id["Name"].(nodes.String)
+	if !strings.HasPrefix(string(name), op.prefix) {
+		return false, nil
+	}
+	id = id.CloneObject()
+	id["Name"] = name[len(op.prefix):]
+	return op.sub.Check(st, id)
+}
+
+func (op opNamePrefix) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(id) != uast.TypeOf(uast.Identifier{}) {
+		return nil, ErrUnexpectedType.New(uast.Identifier{}, n)
+	}
+	name, _ := id["Name"].(nodes.String)
+	id = id.CloneObject()
+	id["Name"] = nodes.String(op.prefix) + name
+	return id, nil
+}
+
+// varianceKeywords maps variance keywords of type parameters to the variance name.
+var varianceKeywords = map[string]string{
+	"InKeyword":  "in",
+	"OutKeyword": "out",
+}
+
+// opGenericParams joins an array of TypeParameter nodes with an array of constraint clauses
+// and constructs an array of GenericParameter nodes.
+//
+// Each GenericParameter has a Name (uast:Identifier), a Variance ("in", "out" or an empty
+// string), an array of Attributes and an array of Constraints. Constraints are GenericConstraint
+// nodes, produced by the normalizer from the constraint clause of this type parameter.
+//
+// Constraint clauses for names that are not declared as type parameters are appended to the
+// array as TypeParameterConstraintClause nodes.
+type opGenericParams struct {
+	params      Op
+	constraints Op
+}
+
+func (op opGenericParams) Kinds() nodes.Kind {
+	return nodes.KindArray
+}
+
+func (op opGenericParams) Check(st *State, n nodes.Node) (bool, error) {
+	arr, ok := n.(nodes.Array)
+	if !ok && n != nil {
+		return false, nil
+	}
+	var params nodes.Array
+	clauses := nodes.Array{}
+	for _, p := range arr {
+		gp, ok := p.(nodes.Object)
+		if ok && uast.TypeOf(gp) == "TypeParameterConstraintClause" {
+			// clause for an unknown type parameter, see Construct
+			clauses = append(clauses, gp)
+			continue
+		}
+		if !ok || uast.TypeOf(gp) != "GenericParameter" {
+			return false, fmt.Errorf("unexpected node in type parameters: %v", uast.TypeOf(p))
+		}
+		variance := noneToken()
+		if v, _ := gp["Variance"].(nodes.String); v != "" {
+			for kw, name := range varianceKeywords {
+				if name == string(v) {
+					variance = nodes.Object{uast.KeyType: nodes.String(kw)}
+				}
+			}
+			if uast.TypeOf(variance) == "None" {
+				return false, fmt.Errorf("unknown variance of type parameter: %q", v)
+			}
+		}
+		param := nodes.Object{
+			uast.KeyType:         nodes.String("TypeParameter"),
+			"Identifier":         gp["Name"],
+			"VarianceKeyword":    variance,
+			"Attributes":         gp["Attributes"],
+			"IsMissing":          nodes.Bool(false),
+			"IsStructuredTrivia": nodes.Bool(false),
+		}
+		if pos, ok := gp[uast.KeyPos]; ok {
+			param[uast.KeyPos] = pos
+		}
+		params = append(params, param)
+		if cons, _ := gp["Constraints"].(nodes.Array); len(cons) != 0 {
+			name := gp["Name"]
+			if id, ok := name.(nodes.Object); ok {
+				// positions of the name in the constraint clause are not preserved
+				id = id.CloneObject()
+				id[uast.KeyPos] = nil
+				name = id
+			}
+			clauses = append(clauses, nodes.Object{
+				uast.KeyType:         nodes.String("TypeParameterConstraintClause"),
+				"Name":               name,
+				"Constraints":        cons,
+				"IsMissing":          nodes.Bool(false),
+				"IsStructuredTrivia": nodes.Bool(false),
+			})
+		}
+	}
+	// clauses may be declared in a different order than type parameters
+	sort.SliceStable(clauses, func(i, j int) bool {
+		return constraintsStart(clauses[i]) < constraintsStart(clauses[j])
+	})
+	var pn nodes.Node
+	if len(params) != 0 {
+		// an empty list means that there was no TypeParameterList
+		pn = params
+	}
+	if ok, err := op.params.Check(st, pn); err != nil || !ok {
+		return ok, err
+	}
+	return op.constraints.Check(st, clauses)
+}
+
+func (op opGenericParams) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	nd, err := op.params.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := nd.(nodes.Array)
+	if !ok && nd != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, nd)
+	}
+	nd, err = op.constraints.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	clauses, ok := nd.(nodes.Array)
+	if !ok && nd != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, nd)
+	}
+	declared := make(map[nodes.String]bool, len(params))
+	for _, p := range params {
+		param, ok := p.(nodes.Object)
+		if !ok || uast.TypeOf(param) != "TypeParameter" {
+			return nil, fmt.Errorf("unexpected node in type parameters: %v", uast.TypeOf(p))
+		}
+		name, err := identName(param["Identifier"])
+		if err != nil {
+			return nil, err
+		}
+		declared[name] = true
+	}
+	// index constraints by the name of the type parameter
+	constraints := make(map[nodes.String]nodes.Array, len(clauses))
+	var unknown nodes.Array
+	for _, c := range clauses {
+		clause, ok := c.(nodes.Object)
+		if !ok || uast.TypeOf(clause) != "TypeParameterConstraintClause" {
+			return nil, fmt.Errorf("unexpected node in constraint clauses: %v", uast.TypeOf(c))
+		}
+		name, err := identName(clause["Name"])
+		if err != nil {
+			return nil, err
+		}
+		if !declared[name] {
+			// the code is invalid, but the parser accepts it; keep the clause as is
+			unknown = append(unknown, clause)
+			continue
+		}
+		arr, _ := clause["Constraints"].(nodes.Array)
+		constraints[name] = append(constraints[name], arr...)
+	}
+	out := make(nodes.Array, 0, len(params)+len(unknown))
+	for _, p := range params {
+		param := p.(nodes.Object)
+		name, _ := identName(param["Identifier"])
+		variance := varianceKeywords[uast.TypeOf(param["VarianceKeyword"])]
+		// already renamed from AttributeLists, the same as for other declarations
+		attrs, _ := param["Attributes"].(nodes.Array)
+		if attrs == nil {
+			attrs = nodes.Array{}
+		}
+		cons := constraints[name]
+		if cons == nil {
+			cons = nodes.Array{}
+		}
+		gp := nodes.Object{
+			uast.KeyType:  nodes.String("GenericParameter"),
+			"Name":        param["Identifier"],
+			"Variance":    nodes.String(variance),
+			"Attributes":  attrs,
+			"Constraints": cons,
+		}
+		if pos, ok := param[uast.KeyPos]; ok {
+			gp[uast.KeyPos] = pos
+		}
+		out = append(out, gp)
+	}
+	return append(out, unknown...), nil
+}
+
+// constraintsStart returns the start offset of the first constraint of the clause,
+// or zero if it has no positions.
+func constraintsStart(clause nodes.Node) uint32 {
+	cons, _ := clause.(nodes.Object)["Constraints"].(nodes.Array)
+	first, _ := cons[0].(nodes.Object)
+	if start := uast.PositionsOf(first).Start(); start != nil {
+		return start.Offset
+	}
+	return 0
+}
+
+// identName returns the name of the uast:Identifier node.
+func identName(n nodes.Node) (nodes.String, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(obj) != uast.TypeOf(uast.Identifier{}) {
+		return "", fmt.Errorf("expected an identifier, got: %v", uast.TypeOf(n))
+	}
+	name, ok := obj["Name"].(nodes.String)
+	if !ok {
+		return "", ErrUnexpectedType.New(nodes.String(""), obj["Name"])
+	}
+	return name, nil
+}
+
+// opNamespace sets the FullName field of the Namespace node constructed by the sub-operation.
+//
+// Transforms are applied in DFS order, thus nested namespaces were already converted and
+// their FullName is relative to the current namespace. The operation prefixes FullName of
+// all nested namespaces with the name of the current one, and sets FullName of the current
+// namespace to its own name. Parent namespaces will prefix it the same way.
+type opNamespace struct {
+	sub Op
+}
+
+func (op opNamespace) Kinds() nodes.Kind {
+	return nodes.KindObject
+}
+
+// Check removes the FullName field of the namespace. The full name must end with the name
+// of the namespace, and the rest of it must be the full name of the parent namespace.
+// The latter is not checked, since the parent namespace was already reversed.
+func (op opNamespace) Check(st *State, n nodes.Node) (bool, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return false, nil
+	}
+	full, err := qualifiedNames(obj["FullName"])
+	if err != nil {
+		return false, nil
+	}
+	names, err := qualifiedNames(obj["Name"])
+	if err != nil {
+		return false, nil
+	}
+	if len(full) < len(names) || !nodes.Equal(full[len(full)-len(names):], names) {
+		return false, nil
+	}
+	obj = obj.CloneObject()
+	delete(obj, "FullName")
+	return op.sub.Check(st, obj)
+}
+
+func (op opNamespace) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, n)
+	}
+	names, err := qualifiedNames(obj["Name"])
+	if err != nil {
+		return nil, err
+	}
+	members, ok := obj["Members"].(nodes.Array)
+	if !ok && obj["Members"] != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, obj["Members"])
+	}
+	obj = obj.CloneObject()
+	obj["Members"], err = prefixNamespaces(members, names)
+	if err != nil {
+		return nil, err
+	}
+	obj["FullName"] = nodes.Object{
+		uast.KeyType: nodes.String(uast.TypeOf(uast.QualifiedIdentifier{})),
+		"Names":      names.CloneList(),
+	}
+	return obj, nil
+}
+
+// prefixNamespaces finds all Namespace nodes in the members array, including nested ones,
+// and prepends the prefix to the names in their FullName field. Namespaces wrapped into
+// uast:Group with comments are handled as well.
+func prefixNamespaces(members nodes.Array, prefix nodes.Array) (nodes.Array, error) {
+	var out nodes.Array
+	for i, m := range members {
+		obj, ok := m.(nodes.Object)
+		if !ok {
+			continue
+		}
+		switch uast.TypeOf(obj) {
+		case typeGroup:
+			arr, ok := obj["Nodes"].(nodes.Array)
+			if !ok {
+				continue
+			}
+			arr, err := prefixNamespaces(arr, prefix)
+			if err != nil {
+				return nil, err
+			}
+			obj = obj.CloneObject()
+			obj["Nodes"] = arr
+		case "Namespace":
+			full, ok := obj["FullName"].(nodes.Object)
+			if !ok {
+				return nil, ErrUnexpectedType.New(nodes.Object{}, obj["FullName"])
+			}
+			names, err := qualifiedNames(full)
+			if err != nil {
+				return nil, err
+			}
+			sub, _ := obj["Members"].(nodes.Array)
+			sub, err = prefixNamespaces(sub, prefix)
+			if err != nil {
+				return nil, err
+			}
+			full = full.CloneObject()
+			full["Names"] = append(prefix.CloneList(), names...)
+			obj = obj.CloneObject()
+			obj["FullName"] = full
+			if sub != nil {
+				obj["Members"] = sub
+			}
+		default:
+			continue
+		}
+		if out == nil {
+			out = members.CloneList()
+		}
+		out[i] = obj
+	}
+	if out == nil {
+		return members, nil
+	}
+	return out, nil
+}
+
+// qualifiedNames returns the Names array of the uast:QualifiedIdentifier node.
+func qualifiedNames(n nodes.Node) (nodes.Array, error) {
+	obj, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(obj) != uast.TypeOf(uast.QualifiedIdentifier{}) {
+		return nil, fmt.Errorf("expected a qualified identifier, got: %v", uast.TypeOf(n))
+	}
+	names, ok := obj["Names"].(nodes.Array)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, obj["Names"])
+	}
+	return names, nil
+}
+
+// directiveMap creates a mapping for #r and #load directives of C# scripts.
+//
+// A comment after the path is moved to a uast:Group together with the File token by
+// triviaMappings. In this case the uast:Import is wrapped into the same group instead.
+func directiveMap(typ string, all bool, target string) Mapping {
+	imp := UASTType(uast.Import{}, Obj{
+		uast.KeyPos: fullSpanPositions,
+		"Path": UASTType(uast.String{}, Obj{
+			uast.KeyPos: Var("path_pos"),
+			"Value":     Var("path"),
+		}),
+		"All":    Bool(all),
+		"Target": Obj{target: Bool(true)},
+	})
+	return Map(
+		Obj{
+			uast.KeyType: String(typ),
+			uast.KeyPos:  fullSpanPositions,
+			"File": Cases("caseFileTrivia",
+				directiveFile(),
+				UASTType(uast.Group{}, Obj{
+					uast.KeyPos: Var("group_pos"),
+					"Nodes":     PrependOne(directiveFile(), Var("trivia")),
 				}),
 			),
+			"IsDirective": Bool(true),
 		},
-	)),
-	funcDefMap("DestructorDeclaration", false, Obj{
-		"TildeToken": Any(),
-	}),
-
-	// Merge uast:Group with uast:FunctionGroup.
-	Map(
-		opMergeGroups{Var("group")},
-		Check(
-			Has{uast.KeyType: In(
-				nodes.String(typeFuncGroup),
-				nodes.String(typeGroup),
-			)},
-			Var("group"),
+		Cases("caseFileTrivia",
+			imp,
+			UASTType(uast.Group{}, Obj{
+				uast.KeyPos: Var("group_pos"),
+				// other groups may start with an import of the directive as well,
+				// for example the group of a using directive with leading directives
+				"Nodes": PrependOne(imp, Check(
+					Not(AnyElem(Not(HasType(uast.Comment{})))),
+					Var("trivia"),
+				)),
+			}),
 		),
-	),
+	)
 }
 
-// dropNils accepts a array node, removes all nil values from it and passes it to
-// a specified suboperation.
-// It will not restore nil values when constructing nodes (not reversible).
-type dropNils struct {
-	op Op
+// directiveFile matches the File token of the #r or #load directive and stores the path
+// and its positions to variables.
+func directiveFile() Op {
+	return Obj{
+		uast.KeyType: String("StringLiteralToken"),
+		uast.KeyPos:  Var("path_pos"),
+		"IsMissing":  Bool(false),
+		// contains escaped value, we don't need it in canonical UAST
+		"Text": Any(),
+		// both values are the same
+		"Value":     Var("path"),
+		"ValueText": Var("path"),
+	}
 }
 
-func (op dropNils) Kinds() nodes.Kind {
+// entryPointName is the name of the entry point function generated by the compiler
+// for top-level statements.
+const entryPointName = "<Main>$"
+
+// opEntryPoint moves all GlobalStatement nodes from the members array to the body of
+// an implicit entry point function named <Main>$. The function is inserted in place of
+// the first top-level statement. Statements wrapped into uast:Group with comments are
+// moved together with the group.
+type opEntryPoint struct {
+	members Op
+}
+
+func (op opEntryPoint) Kinds() nodes.Kind {
 	return nodes.KindArray
 }
 
-func (op dropNils) Check(st *State, n nodes.Node) (bool, error) {
-	arr, ok := n.(nodes.Array)
-	if !ok && n != nil {
-		return false, nil
+// Check replaces the entry point function with GlobalStatement nodes for each statement
+// of its body. Attributes, modifiers and positions of GlobalStatement nodes are not restored.
+func (op opEntryPoint) Check(st *State, n nodes.Node) (bool, error) {
+	members, ok := n.(nodes.Array)
+	if !ok {
+		return op.members.Check(st, n)
 	}
-	out := make(nodes.Array, 0, len(arr))
-	for _, e := range arr {
-		if e != nil {
-			out = append(out, e)
+	for i, m := range members {
+		stmts, ok := entryPointBody(m)
+		if !ok {
+			continue
 		}
+		out := make(nodes.Array, 0, len(members)+len(stmts)-1)
+		out = append(out, members[:i]...)
+		for _, stmt := range stmts {
+			out = append(out, toGlobalStatement(stmt))
+		}
+		out = append(out, members[i+1:]...)
+		return op.members.Check(st, out)
 	}
-	return op.op.Check(st, out)
+	return op.members.Check(st, n)
 }
 
-func (op dropNils) Construct(st *State, n nodes.Node) (nodes.Node, error) {
-	return op.op.Construct(st, n)
+func (op opEntryPoint) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.members.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	members, ok := n.(nodes.Array)
+	if !ok {
+		return n, nil
+	}
+	var (
+		out        nodes.Array
+		stmts      nodes.Array
+		first      = -1
+		start, end nodes.Object
+	)
+	for _, m := range members {
+		stmt, global := globalStatement(m)
+		if stmt == nil {
+			out = append(out, m)
+			continue
+		}
+		if first < 0 {
+			first = len(out)
+			start = global
+		}
+		if uast.PositionsOf(global).End() != nil {
+			end = global
+		}
+		stmts = append(stmts, stmt)
+	}
+	if first < 0 {
+		return members, nil
+	}
+	block := nodes.Object{
+		uast.KeyType: nodes.String(uast.TypeOf(uast.Block{})),
+		"Statements": stmts,
+	}
+	if pos := spanPositions(start, end); pos != nil {
+		block[uast.KeyPos] = pos.ToObject()
+	}
+	group := nodes.Object{
+		uast.KeyType: nodes.String(typeFuncGroup),
+		"Nodes": nodes.Array{
+			nodes.Object{
+				uast.KeyType: nodes.String(uast.TypeOf(uast.Alias{})),
+				"Name": nodes.Object{
+					uast.KeyType: nodes.String(uast.TypeOf(uast.Identifier{})),
+					"Name":       nodes.String(entryPointName),
+				},
+				"Node": nodes.Object{
+					uast.KeyType: nodes.String(uast.TypeOf(uast.Function{})),
+					"Type": nodes.Object{
+						uast.KeyType: nodes.String(uast.TypeOf(uast.FunctionType{})),
+						"Arguments":  nodes.Array{},
+						"Returns":    nodes.Array{},
+					},
+					"Body": block,
+				},
+			},
+		},
+	}
+	out = append(out[:first], append(nodes.Array{group}, out[first:]...)...)
+	return out, nil
 }
 
-var (
-	typeGroup     = uast.TypeOf(uast.Group{})
-	typeFuncGroup = uast.TypeOf(uast.FunctionGroup{})
-)
+// globalStatement returns a statement wrapped into the GlobalStatement node and the node itself.
+// If the node is wrapped into uast:Group, the group is returned with GlobalStatement replaced
+// by the statement. It returns nil if the node is not a top-level statement.
+func globalStatement(n nodes.Node) (nodes.Node, nodes.Object) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return nil, nil
+	}
+	switch uast.TypeOf(obj) {
+	case "GlobalStatement":
+		return obj["Statement"], obj
+	case typeGroup:
+		arr, ok := obj["Nodes"].(nodes.Array)
+		if !ok {
+			return nil, nil
+		}
+		for i, sub := range arr {
+			stmt, global := globalStatement(sub)
+			if stmt == nil {
+				continue
+			}
+			arr = arr.CloneList()
+			arr[i] = stmt
+			obj = obj.CloneObject()
+			obj["Nodes"] = arr
+			return obj, global
+		}
+	}
+	return nil, nil
+}
 
-// triviaField specified a field with an array to put trivias into.
-var triviaField = map[string]string{
-	"Block":           "Statements",
-	"CompilationUnit": "Members",
+// entryPointBody returns statements of the entry point function generated by opEntryPoint.
+// It returns false if the node is not an entry point.
+func entryPointBody(n nodes.Node) (nodes.Array, bool) {
+	group, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(group) != typeFuncGroup {
+		return nil, false
+	}
+	arr, _ := group["Nodes"].(nodes.Array)
+	if len(arr) != 1 {
+		return nil, false
+	}
+	alias, _ := arr[0].(nodes.Object)
+	if name, err := identName(alias["Name"]); err != nil || name != entryPointName {
+		return nil, false
+	}
+	fnc, _ := alias["Node"].(nodes.Object)
+	body, _ := fnc["Body"].(nodes.Object)
+	stmts, ok := body["Statements"].(nodes.Array)
+	return stmts, ok
 }
 
-// firstWithType returns an index of the first node type of which matches the filter function.
-func firstWithType(arr nodes.Array, fnc func(typ string) bool) int {
-	for i, sub := range arr {
-		if fnc(uast.TypeOf(sub)) {
-			return i
+// toGlobalStatement wraps the statement into the GlobalStatement node. It is the reverse
+// of globalStatement: if the statement is wrapped into uast:Group, the first node of the
+// group that is not a trivia is wrapped.
+func toGlobalStatement(n nodes.Node) nodes.Node {
+	obj, ok := n.(nodes.Object)
+	if ok && uast.TypeOf(obj) == typeGroup {
+		arr, _ := obj["Nodes"].(nodes.Array)
+		for i, sub := range arr {
+			if isTrivia(sub) {
+				continue
+			}
+			arr = arr.CloneList()
+			arr[i] = toGlobalStatement(sub)
+			obj = obj.CloneObject()
+			obj["Nodes"] = arr
+			return obj
 		}
 	}
-	return -1
+	return nodes.Object{
+		uast.KeyType:         nodes.String("GlobalStatement"),
+		"AttributeLists":     nodes.Array{},
+		"Modifiers":          nodes.Array{},
+		"IsMissing":          nodes.Bool(false),
+		"IsStructuredTrivia": nodes.Bool(false),
+		"Statement":          n,
+	}
 }
 
-// opMoveTrivias cuts trivia nodes from LeadingTrivia/TrailingTrivia fields
-// and wraps the node into uast:Group that contains those trivias.
-type opMoveTrivias struct {
-	sub Op
+// opRecord completes the TypeDeclaration of a record.
+//
+// Base types of the record are converted the same way as for classes. If the record passes
+// arguments to the base record constructor (record B(int X) : A(X)), the PrimaryConstructorBaseType
+// node is kept as the first statement of the generated constructor, similar to a base class
+// initializer of a regular constructor.
+//
+// If the record has a parameter list, a public constructor with the same arguments is
+// prepended to the members of the type, followed by auto-properties for each parameter.
+// Properties have get and init accessors, or get and set for mutable record structs.
+// No property is generated if a member with the same name is declared explicitly.
+type opRecord struct {
+	name      Op
+	params    Op
+	paramsPos Op
+	bases     Op
+	sub       Op
 }
 
-func (op opMoveTrivias) Kinds() nodes.Kind {
+func (op opRecord) Kinds() nodes.Kind {
 	return nodes.KindObject
 }
 
-// Check implements the logic to move the trivia out of the node into a Group that will
-// wrap the trivia and the node itself.
-//
-// The function is a bit more complex than it should be because there are some edge cases
-// where instead of wrapping the node we will add trivia to a specific field of the node.
-//
-// There are two general cases here that may overlap.
-//
-// First, some nodes will have a Leading/TrailingTrivia fields. We will remove those fields
-// from the node, and will wrap the node itself into a uast:Group with an array consisting
-// of (leading trivia + node + trailing trivia).
-//
-// There are some edge cases here. For example, we don't want to wrap a CompilationUnit nodes
-// so we will add trivia nodes to it's Members slice (see triviaField map for all such cases).
-//
-// But, we can't stop here because the Group will prevent other annotations to match against
-// the original node. To fix this, we also try to access few known fields and check if they
-// already contain a Group. If it does, we unwrap the node and join its trivia into our
-// leading/trailing slice. This is possible because DSL guarantees that transforms always
-// happen in DFS order, thus all child nodes were already visited by this transform.
-func (op opMoveTrivias) Check(st *State, n nodes.Node) (bool, error) {
-	obj, ok := n.(nodes.Object)
+func (op opRecord) Check(st *State, n nodes.Node) (bool, error) {
+	typ, ok := n.(nodes.Object)
 	if !ok {
 		return false, nil
 	}
-	modified := false
-	leading, ok1 := obj["LeadingTrivia"].(nodes.Array)
-	trailing, ok2 := obj["TrailingTrivia"].(nodes.Array)
-	if ok1 || ok2 {
-		// we saved the leading and trailing trivias, now wipe them from the node
-		obj = obj.CloneObject()
-		modified = true
-		delete(obj, "LeadingTrivia")
-		delete(obj, "TrailingTrivia")
+	bases, ok := typ["Bases"].(nodes.Array)
+	if !ok && typ["Bases"] != nil {
+		return false, nil
+	}
+	members, ok := typ["Members"].(nodes.Array)
+	if !ok && typ["Members"] != nil {
+		return false, nil
+	}
+	var (
+		params   nodes.Node
+		pos      nodes.Node
+		baseInit nodes.Object
+	)
+	if len(members) != 0 {
+		if ftyp, body := recordCtor(members[0]); ftyp != nil {
+			params = ftyp["Arguments"]
+			if params == nil {
+				params = nodes.Array{}
+			}
+			pos = members[0].(nodes.Object)[uast.KeyPos]
+			if stmts, _ := body["Statements"].(nodes.Array); len(stmts) == 1 {
+				baseInit, _ = stmts[0].(nodes.Object)
+			}
+			members = removeRecordProps(members[1:], params.(nodes.Array))
+		}
+	}
+	native := make(nodes.Array, 0, len(bases))
+	for _, b := range bases {
+		if baseInit != nil && nodes.Equal(baseInit["Type"], b) {
+			native = append(native, baseInit)
+			baseInit = nil
+			continue
+		}
+		native = append(native, nodes.Object{
+			uast.KeyType:         nodes.String("SimpleBaseType"),
+			"IsMissing":          nodes.Bool(false),
+			"IsStructuredTrivia": nodes.Bool(false),
+			"Type":               b,
+		})
+	}
+	if baseInit != nil {
+		// the constructor body doesn't match any of the base types
+		return false, nil
+	}
+	typ = typ.CloneObject()
+	delete(typ, "Bases")
+	typ["Members"] = members
+	if ok, err := op.sub.Check(st, typ); err != nil || !ok {
+		return false, err
+	}
+	if ok, err := op.bases.Check(st, native); err != nil || !ok {
+		return false, err
+	}
+	if ok, err := op.params.Check(st, params); err != nil || !ok {
+		return false, err
+	}
+	return op.paramsPos.Check(st, pos)
+}
+
+func (op opRecord) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	typ, ok := n.(nodes.Object)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.Object{}, n)
+	}
+	nd, err := op.bases.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := nd.(nodes.Array)
+	if !ok && nd != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, nd)
+	}
+	bases := make(nodes.Array, 0, len(arr))
+	var baseInit nodes.Node
+	for _, b := range arr {
+		bobj, ok := b.(nodes.Object)
+		if !ok {
+			return nil, ErrUnexpectedType.New(nodes.Object{}, b)
+		}
+		switch uast.TypeOf(bobj) {
+		case "SimpleBaseType":
+		case "PrimaryConstructorBaseType":
+			baseInit = bobj
+		default:
+			return nil, fmt.Errorf("unexpected base type: %s", uast.TypeOf(bobj))
+		}
+		bases = append(bases, bobj["Type"])
+	}
+	typ = typ.CloneObject()
+	typ["Bases"] = bases
+
+	nd, err = op.params.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := nd.(nodes.Array)
+	if !ok {
+		if nd != nil {
+			return nil, ErrUnexpectedType.New(nodes.Array{}, nd)
+		}
+		// no primary constructor
+		return typ, nil
+	}
+	name, err := op.name.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := op.paramsPos.Construct(st, nil)
+	if err != nil {
+		return nil, err
+	}
+	members, ok := typ["Members"].(nodes.Array)
+	if !ok && typ["Members"] != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, typ["Members"])
+	}
+	var stmts nodes.Array
+	if baseInit != nil {
+		stmts = nodes.Array{baseInit}
+	}
+	ctor := nodes.Object{
+		uast.KeyType: nodes.String(typeFuncGroup),
+		"Attributes": nodes.Array{},
+		"Nodes": nodes.Array{
+			nodes.Array{publicKeyword()},
+			nodes.Object{
+				uast.KeyType: nodes.String(uast.TypeOf(uast.Alias{})),
+				"Name":       name,
+				"Node": nodes.Object{
+					uast.KeyType: nodes.String(uast.TypeOf(uast.Function{})),
+					"Type": nodes.Object{
+						uast.KeyType: nodes.String(uast.TypeOf(uast.FunctionType{})),
+						"Arguments":  params,
+						"Returns":    nil,
+					},
+					"Body": nodes.Object{
+						uast.KeyType: nodes.String(uast.TypeOf(uast.Block{})),
+						"Statements": stmts,
+					},
+				},
+			},
+		},
+	}
+	if pos != nil {
+		ctor[uast.KeyPos] = pos
+	}
+	// readonly record structs and record classes have init-only properties
+	setter := "init"
+	if typ["Kind"] == nodes.String("record struct") && !hasKeyword(typ["Modifiers"], "ReadOnlyKeyword") {
+		setter = "set"
+	}
+	gen := nodes.Array{ctor}
+	for _, p := range params {
+		arg, ok := p.(nodes.Object)
+		if !ok {
+			return nil, ErrUnexpectedType.New(nodes.Object{}, p)
+		}
+		id, ok := arg["Name"].(nodes.Object)
+		if !ok || hasMember(members, id["Name"]) {
+			continue
+		}
+		gen = append(gen, nodes.Object{
+			uast.KeyType: nodes.String(uast.TypeOf(uast.Alias{})),
+			"Name":       id,
+			"Node": nodes.Object{
+				uast.KeyType: nodes.String("BasePropertyDeclaration"),
+				"Kind":       nodes.String("property"),
+				// attributes are applied to the parameter, not to the property
+				"Attributes":        nodes.Array{},
+				"Modifiers":         nodes.Array{publicKeyword()},
+				"Type":              arg["Type"],
+				"ExplicitInterface": nil,
+				"Init":              nil,
+				"Accessors": nodes.Array{
+					autoAccessor("get"),
+					autoAccessor(setter),
+				},
+				"Auto": nodes.Bool(true),
+			},
+		})
+	}
+	typ["Members"] = append(gen, members...)
+	return typ, nil
+}
+
+// recordCtor checks if a member is a primary constructor generated by opRecord. It returns
+// the type and the body of the constructor function, or nil if the member was declared
+// explicitly. Generated constructor has a single public modifier and a body without positions.
+func recordCtor(n nodes.Node) (ftyp, body nodes.Object) {
+	group, ok := n.(nodes.Object)
+	if !ok || uast.TypeOf(group) != typeFuncGroup {
+		return nil, nil
+	}
+	arr, ok := group["Nodes"].(nodes.Array)
+	if !ok || len(arr) != 2 {
+		return nil, nil
+	}
+	if mods, ok := arr[0].(nodes.Array); !ok || len(mods) != 1 || uast.TypeOf(mods[0]) != "PublicKeyword" {
+		return nil, nil
+	}
+	alias, ok := arr[1].(nodes.Object)
+	if !ok || uast.TypeOf(alias) != uast.TypeOf(uast.Alias{}) {
+		return nil, nil
+	}
+	fnc, ok := alias["Node"].(nodes.Object)
+	if !ok || uast.TypeOf(fnc) != uast.TypeOf(uast.Function{}) {
+		return nil, nil
+	}
+	ftyp, _ = fnc["Type"].(nodes.Object)
+	body, _ = fnc["Body"].(nodes.Object)
+	if ftyp == nil || ftyp["Returns"] != nil || body == nil {
+		return nil, nil
+	}
+	if _, ok := body[uast.KeyPos]; ok {
+		return nil, nil
+	}
+	return ftyp, body
+}
+
+// removeRecordProps removes properties that were generated by opRecord for parameters
+// of the primary constructor. Generated properties have no positions.
+func removeRecordProps(members nodes.Array, params nodes.Array) nodes.Array {
+	out := make(nodes.Array, 0, len(members))
+	for _, m := range members {
+		if alias, ok := m.(nodes.Object); ok && uast.TypeOf(alias) == uast.TypeOf(uast.Alias{}) {
+			_, hasPos := alias[uast.KeyPos]
+			prop, _ := alias["Node"].(nodes.Object)
+			if !hasPos && uast.TypeOf(prop) == "BasePropertyDeclaration" && hasParam(params, alias["Name"]) {
+				continue
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// hasParam checks if an array of uast:Argument nodes has an argument with a given name.
+func hasParam(params nodes.Array, name nodes.Node) bool {
+	for _, p := range params {
+		if arg, ok := p.(nodes.Object); ok && nodes.Equal(arg["Name"], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicKeyword returns a public modifier token for generated declarations.
+func publicKeyword() nodes.Object {
+	return nodes.Object{
+		uast.KeyType: nodes.String("PublicKeyword"),
+		"IsMissing":  nodes.Bool(false),
+		"Text":       nodes.String("public"),
+		"Value":      nodes.String("public"),
+		"ValueText":  nodes.String("public"),
+	}
+}
+
+// autoAccessor returns an accessor without a body for generated auto-properties.
+func autoAccessor(kind string) nodes.Object {
+	return nodes.Object{
+		uast.KeyType: nodes.String("AccessorDeclaration"),
+		"Kind":       nodes.String(kind),
+		"Attributes": nodes.Array{},
+		"Modifiers":  nodes.Array{},
+	}
+}
+
+// hasKeyword checks if an array of modifiers contains a keyword of a given type.
+func hasKeyword(mods nodes.Node, typ string) bool {
+	arr, _ := mods.(nodes.Array)
+	for _, m := range arr {
+		if uast.TypeOf(m) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMember checks if an array of members contains a named declaration with a given name.
+// Members wrapped into uast:Group with comments are checked as well.
+func hasMember(members nodes.Array, name nodes.Node) bool {
+	for _, m := range members {
+		obj, ok := m.(nodes.Object)
+		if !ok {
+			continue
+		}
+		switch uast.TypeOf(obj) {
+		case uast.TypeOf(uast.Alias{}):
+			if id, ok := obj["Name"].(nodes.Object); ok && nodes.Equal(id["Name"], name) {
+				return true
+			}
+		case typeGroup, typeFuncGroup:
+			if arr, ok := obj["Nodes"].(nodes.Array); ok && hasMember(arr, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// opUsingDeclarations converts using declarations in an array of block statements to
+// UsingStatement nodes, the same way as the compiler does it. All statements that follow
+// the declaration become the body of the UsingStatement. Declarations wrapped into
+// uast:Group with comments are converted as well.
+type opUsingDeclarations struct {
+	stmts Op
+}
+
+func (op opUsingDeclarations) Kinds() nodes.Kind {
+	return nodes.KindArray | nodes.KindNil
+}
+
+// Check converts the UsingStatement with an implicit body back to the using declaration
+// followed by statements of the body. Nested declarations are converted as well.
+func (op opUsingDeclarations) Check(st *State, n nodes.Node) (bool, error) {
+	stmts, ok := n.(nodes.Array)
+	if !ok {
+		return op.stmts.Check(st, n)
 	}
+	return op.stmts.Check(st, toUsingDeclarations(stmts))
+}
 
-	// move comments out of keywords and tokens into actual AST nodes
-	// TODO(dennwc): handle more cases:
-	//				 - Modifiers?
-	for key, sub := range obj {
-		if key != "ReturnType" &&
-			!strings.HasSuffix(key, "Token") &&
-			!strings.HasSuffix(key, "Keyword") {
+func (op opUsingDeclarations) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.stmts.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	stmts, ok := n.(nodes.Array)
+	if !ok {
+		return n, nil
+	}
+	changed := false
+	// go backward, so nested declarations are already converted when they become a body
+	for i := len(stmts) - 1; i >= 0; i-- {
+		decl, group := usingDeclaration(stmts[i])
+		if decl == nil {
 			continue
 		}
-		if uast.TypeOf(sub) != typeGroup {
-			continue
+		if !changed {
+			stmts = stmts.CloneList()
+			changed = true
 		}
-		group := sub.(nodes.Object)
-		arr, ok := group["Nodes"].(nodes.Array)
-		if !ok {
-			continue
+		body := nodes.Object{
+			uast.KeyType: nodes.String(uast.TypeOf(uast.Block{})),
+			"Statements": append(nodes.Array{}, stmts[i+1:]...),
 		}
-		// we already joined trivias and the node into a single array,
-		// so we will have to find its index now
-		ind := firstWithType(arr, func(typ string) bool {
-			return !strings.HasSuffix(typ, "Trivia")
-		})
-
-		var node nodes.Node
-		if ind < 0 {
-			// cannot determine an index - pretend everything is a leading trivia
-			// TODO(dennwc): this should not happen in practice, since leading/trailing
-			//  			 trivias are always attached to a node, and this node should
-			//  			 be somewhere in this slice
-			//  			 but future annotations may drop this node, so we will need
-			//  			 to find a different way of splitting leading and trailing
-			// 				 trivia if it happens in practice
-			leading = append(leading.CloneList(), arr...)
-		} else {
-			node = arr[ind]
-			leading = append(leading.CloneList(), arr[:ind]...)
-			trailing = append(arr[ind+1:len(arr):len(arr)], trailing...)
+		if i+1 < len(stmts) {
+			if pos := spanPositions(firstObject(stmts[i+1:]), lastObject(stmts[i+1:])); pos != nil {
+				body[uast.KeyPos] = pos.ToObject()
+			}
 		}
-		if !modified {
-			obj = obj.CloneObject()
-			modified = true
+		using := nodes.Object{
+			uast.KeyType:  nodes.String("UsingStatement"),
+			"Await":       nodes.Bool(uast.TypeOf(decl["AwaitKeyword"]) == "AwaitKeyword"),
+			"Declaration": decl["Declaration"],
+			"Expression":  nil,
+			"Body":        body,
+			// the body is the rest of the enclosing block
+			"ImplicitBody": nodes.Bool(true),
 		}
-		obj[key] = node
+		if pos, ok := decl[uast.KeyPos]; ok {
+			using[uast.KeyPos] = pos
+		}
+		var stmt nodes.Node = using
+		if group != nil {
+			group = group.CloneObject()
+			arr := group["Nodes"].(nodes.Array).CloneList()
+			for j, sub := range arr {
+				if d, _ := usingDeclaration(sub); d != nil {
+					arr[j] = using
+				}
+			}
+			group["Nodes"] = arr
+			stmt = group
+		}
+		stmts = append(stmts[:i], stmt)
 	}
+	return stmts, nil
+}
 
-	if len(leading) == 0 && len(trailing) == 0 {
-		if !modified {
-			return false, nil // unmodified
+// toUsingDeclarations is the reverse of opUsingDeclarations. Only the last statement can be
+// a UsingStatement with an implicit body.
+func toUsingDeclarations(stmts nodes.Array) nodes.Array {
+	if len(stmts) == 0 {
+		return stmts
+	}
+	i := len(stmts) - 1
+	using, group := implicitUsing(stmts[i])
+	if using == nil {
+		return stmts
+	}
+	await := nodes.Object{
+		uast.KeyType: nodes.String("None"),
+		"IsMissing":  nodes.Bool(false),
+		"Text":       nodes.String(""),
+		"ValueText":  nodes.String(""),
+	}
+	if using["Await"] == nodes.Bool(true) {
+		await = keywordToken("AwaitKeyword", "await")
+	}
+	decl := nodes.Object{
+		uast.KeyType:         nodes.String("LocalDeclarationStatement"),
+		"AttributeLists":     nodes.Array{},
+		"Modifiers":          nodes.Array{},
+		"AwaitKeyword":       await,
+		"UsingKeyword":       keywordToken("UsingKeyword", "using"),
+		"Declaration":        using["Declaration"],
+		"IsConst":            nodes.Bool(false),
+		"IsMissing":          nodes.Bool(false),
+		"IsStructuredTrivia": nodes.Bool(false),
+		// dropped by the normalizer
+		"SemicolonToken": nil,
+	}
+	if pos, ok := using[uast.KeyPos]; ok {
+		decl[uast.KeyPos] = pos
+	}
+	var stmt nodes.Node = decl
+	if group != nil {
+		arr := group["Nodes"].(nodes.Array).CloneList()
+		for j, sub := range arr {
+			if nodes.Same(sub, using) {
+				arr[j] = decl
+			}
 		}
-		// removed the trivia fields
-		return op.sub.Check(st, obj)
+		group = group.CloneObject()
+		group["Nodes"] = arr
+		stmt = group
 	}
+	out := append(stmts[:i:i], stmt)
+	body, _ := using["Body"].(nodes.Object)
+	rest, _ := body["Statements"].(nodes.Array)
+	return append(out, toUsingDeclarations(rest)...)
+}
 
-	if field, ok := triviaField[uast.TypeOf(obj)]; ok {
-		// instead of wrapping the node, join trivias to a specified field
-		old, ok := obj[field].(nodes.Array)
-		if !ok {
-			return false, fmt.Errorf("expected %q field to be an array", field)
+// implicitUsing returns a UsingStatement node if it was created from a using declaration.
+// If the node is wrapped into uast:Group, the group is returned as well.
+func implicitUsing(n nodes.Node) (nodes.Object, nodes.Object) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return nil, nil
+	}
+	switch uast.TypeOf(obj) {
+	case "UsingStatement":
+		if obj["ImplicitBody"] == nodes.Bool(true) {
+			return obj, nil
 		}
-		arr := make(nodes.Array, 0, len(leading)+len(old)+len(trailing))
-		arr = append(arr, leading...)
-		arr = append(arr, old...)
-		arr = append(arr, trailing...)
+	case typeGroup:
+		arr, _ := obj["Nodes"].(nodes.Array)
+		for _, sub := range arr {
+			if using, _ := implicitUsing(sub); using != nil {
+				return using, obj
+			}
+		}
+	}
+	return nil, nil
+}
 
-		obj[field] = arr
-		return op.sub.Check(st, obj)
+// keywordToken creates a native token node for the keyword.
+func keywordToken(typ, text string) nodes.Object {
+	return nodes.Object{
+		uast.KeyType: nodes.String(typ),
+		"IsMissing":  nodes.Bool(false),
+		"Text":       nodes.String(text),
+		"Value":      nodes.String(text),
+		"ValueText":  nodes.String(text),
 	}
+}
 
-	// wrap the node into a uast:Group
-	arr := make(nodes.Array, 0, len(leading)+1+len(trailing))
-	arr = append(arr, leading...)
-	arr = append(arr, obj)
-	arr = append(arr, trailing...)
+// usingDeclaration returns a LocalDeclarationStatement if the node is a using declaration.
+// If the declaration is wrapped into uast:Group, the group is returned as well.
+func usingDeclaration(n nodes.Node) (nodes.Object, nodes.Object) {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return nil, nil
+	}
+	switch uast.TypeOf(obj) {
+	case "LocalDeclarationStatement":
+		if uast.TypeOf(obj["UsingKeyword"]) == "UsingKeyword" {
+			return obj, nil
+		}
+	case typeGroup:
+		arr, _ := obj["Nodes"].(nodes.Array)
+		for _, sub := range arr {
+			if decl, _ := usingDeclaration(sub); decl != nil {
+				return decl, obj
+			}
+		}
+	}
+	return nil, nil
+}
 
-	// TODO(dennwc): it will be nice if we could extract FullSpan position into the Group
-	group, err := uast.ToNode(uast.Group{})
-	if err != nil {
-		return false, err
+// firstObject returns the first object in the array that has positions.
+func firstObject(arr nodes.Array) nodes.Object {
+	for _, n := range arr {
+		if obj, ok := n.(nodes.Object); ok && uast.PositionsOf(obj).Start() != nil {
+			return obj
+		}
 	}
+	return nil
+}
 
-	// note that we overwrite a variable - it was the current node
-	// and now it is a Group wrapping the current node
-	obj = group.(nodes.Object)
-	obj["Nodes"] = arr
-	return op.sub.Check(st, obj)
+// spanPositions returns positions that span from the start of the first node to the end
+// of the last node, or nil if either of them has no positions. Full span positions are
+// set only if both nodes have them.
+func spanPositions(first, last nodes.Object) uast.Positions {
+	fpos, lpos := uast.PositionsOf(first), uast.PositionsOf(last)
+	start, end := fpos.Start(), lpos.End()
+	if start == nil || end == nil {
+		return nil
+	}
+	pos := uast.Positions{
+		uast.KeyStart: *start,
+		uast.KeyEnd:   *end,
+	}
+	fstart, ok1 := fpos[KeyFullStart]
+	fend, ok2 := lpos[KeyFullEnd]
+	if ok1 && ok2 {
+		pos[KeyFullStart] = fstart
+		pos[KeyFullEnd] = fend
+	}
+	return pos
 }
 
-func (op opMoveTrivias) Construct(st *State, n nodes.Node) (nodes.Node, error) {
-	// TODO(dennwc): implement when we will need a reversal
-	//				 see https://github.com/bblfsh/sdk/issues/355
-	return op.sub.Construct(st, n)
+// lastObject returns the last object in the array that has positions.
+func lastObject(arr nodes.Array) nodes.Object {
+	for i := len(arr) - 1; i >= 0; i-- {
+		if obj, ok := arr[i].(nodes.Object); ok && uast.PositionsOf(obj).End() != nil {
+			return obj
+		}
+	}
+	return nil
 }
 
-// opMergeGroups finds the uast:Group nodes and merges them into a child
-// uast:FunctionGroup, if it exists.
+var _ Op = opAttributes{}
+
+// opAttributes flattens an array of AttributeList nodes into an array of Attribute nodes.
 //
-// This transform is necessary because opMoveTrivias will wrap all nodes that contain trivia
-// into a Group node, and the same will happen with MethodDeclaration nodes. But according
-// to a UAST schema defined in SDK, the comments (trivia) should be directly inside the
-// FunctionGroup node that wraps functions in Semantic mode.
-type opMergeGroups struct {
+// The target of the attribute list (assembly, return, field, etc.) is copied to the Target
+// field of each attribute. Lists wrapped into uast:Group (because of comments) are replaced
+// with a Group of the same comments and all attributes of the list.
+type opAttributes struct {
 	sub Op
 }
 
-func (op opMergeGroups) Kinds() nodes.Kind {
-	return nodes.KindObject
+func (op opAttributes) Kinds() nodes.Kind {
+	return nodes.KindArray | nodes.KindNil
 }
 
-// Check tests if a current node is uast:Group and uast:FuncGroup and contains group of
-// another kind. It will remove the second group and merge children into current one.
-// uast:FuncGroup is preferred.
-//
-// See https://github.com/bblfsh/sdk/issues/361.
-func (op opMergeGroups) Check(st *State, n nodes.Node) (bool, error) {
-	group, ok := n.(nodes.Object)
+// Check is the reverse of Construct. Adjacent attributes with the same target are joined
+// into a single AttributeList node.
+func (op opAttributes) Check(st *State, n nodes.Node) (bool, error) {
+	arr, ok := n.(nodes.Array)
 	if !ok {
-		return false, nil
+		return op.sub.Check(st, n)
 	}
-	switch uast.TypeOf(group) {
-	case typeGroup:
-		return op.checkGroup(st, group)
-	case typeFuncGroup:
-		return op.checkFuncGroup(st, group)
+	lists, err := attributeLists(arr)
+	if err != nil {
+		return false, err
 	}
-	return false, nil
+	return op.sub.Check(st, lists)
 }
 
-// checkGroup tests if the current node is uast:Group and if it contains a uast:FunctionGroup
-// node, it will rebuild the node by removing the current node and merge other children into
-// the FunctionGroup. The changed node will be passed to the sub-operation.
-func (op opMergeGroups) checkGroup(st *State, group nodes.Object) (bool, error) {
-	arr, ok := group["Nodes"].(nodes.Array)
+func (op opAttributes) Construct(st *State, n nodes.Node) (nodes.Node, error) {
+	n, err := op.sub.Construct(st, n)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := n.(nodes.Array)
 	if !ok {
-		return false, errors.New("expected an array in Group.Nodes")
+		return n, nil
 	}
-	ind := firstWithType(arr, func(typ string) bool {
-		return typ == typeFuncGroup
-	})
-	if ind < 0 {
-		return false, nil
+	out := make(nodes.Array, 0, len(arr))
+	for _, sub := range arr {
+		obj, ok := sub.(nodes.Object)
+		if !ok {
+			out = append(out, sub)
+			continue
+		}
+		switch uast.TypeOf(obj) {
+		case "AttributeList":
+			attrs, err := attributesOf(obj)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, attrs...)
+		case typeGroup:
+			nodesArr, _ := obj["Nodes"].(nodes.Array)
+			group := make(nodes.Array, 0, len(nodesArr))
+			for _, gn := range nodesArr {
+				if uast.TypeOf(gn) != "AttributeList" {
+					group = append(group, gn)
+					continue
+				}
+				attrs, err := attributesOf(gn.(nodes.Object))
+				if err != nil {
+					return nil, err
+				}
+				group = append(group, attrs...)
+			}
+			obj = obj.CloneObject()
+			obj["Nodes"] = group
+			out = append(out, obj)
+		default:
+			out = append(out, obj)
+		}
 	}
-	leading := arr[:ind]
-	fgroup := arr[ind].(nodes.Object)
-	trailing := arr[ind+1:]
+	return out, nil
+}
 
-	arr, ok = fgroup["Nodes"].(nodes.Array)
-	if !ok {
-		return false, errors.New("expected an array in Group.Nodes")
+// attributesOf returns attributes of the AttributeList node with the Target field set
+// to the target of the list, or to nil if the list has no target.
+func attributesOf(list nodes.Object) (nodes.Array, error) {
+	arr, ok := list["Attributes"].(nodes.Array)
+	if !ok && list["Attributes"] != nil {
+		return nil, ErrUnexpectedType.New(nodes.Array{}, list["Attributes"])
 	}
-	out := make(nodes.Array, 0, len(leading)+len(arr)+len(trailing))
-	out = append(out, leading...)
-	out = append(out, arr...)
-	out = append(out, trailing...)
-
-	fgroup = fgroup.CloneObject()
-	fgroup["Nodes"] = out
+	var target nodes.Node
+	if spec, ok := list["Target"].(nodes.Object); ok {
+		switch id := spec["Identifier"].(type) {
+		case nodes.Object:
+			if name, ok := id["ValueText"].(nodes.String); ok {
+				// a keyword token
+				target = name
+			} else if name, ok := id["Name"].(nodes.String); ok {
+				// already converted to uast:Identifier
+				target = name
+			}
+		}
+		if target == nil {
+			return nil, fmt.Errorf("unsupported attribute target: %v", spec["Identifier"])
+		}
+	}
+	start := uast.PositionsOf(list).Start()
+	out := make(nodes.Array, 0, len(arr))
+	for _, sub := range arr {
+		if attr, ok := sub.(nodes.Object); ok && uast.TypeOf(attr) == "Attribute" {
+			attr = attr.CloneObject()
+			attr["Target"] = target
+			if start != nil {
+				if err := setListStart(attr, *start); err != nil {
+					return nil, err
+				}
+				start = nil
+			}
+			sub = attr
+		}
+		out = append(out, sub)
+	}
+	return out, nil
+}
 
-	return op.sub.Check(st, fgroup)
+// setListStart stores the start of the attribute list in positions of the attribute,
+// see KeyAttributeList.
+func setListStart(attr nodes.Object, start uast.Position) error {
+	pos, ok := attr[uast.KeyPos].(nodes.Object)
+	if !ok {
+		pos = nodes.Object{uast.KeyType: nodes.String(uast.TypeOf(uast.Positions{}))}
+	}
+	sp, err := uast.ToNode(start)
+	if err != nil {
+		return err
+	}
+	pos = pos.CloneObject()
+	pos[KeyAttributeList] = sp
+	attr[uast.KeyPos] = pos
+	return nil
 }
 
-// checkFuncGroup tests if the current node is uast:FuncGroup and if any of its sub-arrays
-// contain a uast:Group, it will be removed and the children will be flattened into a sub-array.
-func (op opMergeGroups) checkFuncGroup(st *State, fgroup nodes.Object) (bool, error) {
-	// primary nodes array in the function group
-	arr, ok := fgroup["Nodes"].(nodes.Array)
+// listStart removes the start of the attribute list from positions of the attribute.
+// It reports if the attribute is the first one in the list.
+func listStart(attr nodes.Object) bool {
+	pos, ok := attr[uast.KeyPos].(nodes.Object)
 	if !ok {
-		return false, errors.New("expected an array in FuncGroup.Nodes")
+		return false
 	}
-	modified := false
-	for i := 0; i < len(arr); i++ {
-		v := arr[i]
-		// Since we will run this for every group, let's clean a group
-		// array from nils here. It could be a separate transform, but
-		// it may affect performance, effectively running all checks twice.
-		if v == nil {
-			if !modified {
-				arr = arr.CloneList()
-				modified = true
+	if _, ok = pos[KeyAttributeList]; !ok {
+		return false
+	}
+	pos = pos.CloneObject()
+	delete(pos, KeyAttributeList)
+	attr[uast.KeyPos] = pos
+	return true
+}
+
+// attributeTargets maps targets of attribute lists to the types of keyword tokens.
+var attributeTargets = map[string]string{
+	"assembly": "AssemblyKeyword",
+	"module":   "ModuleKeyword",
+	"field":    "FieldKeyword",
+	"event":    "EventKeyword",
+	"method":   "MethodKeyword",
+	"param":    "ParamKeyword",
+	"property": "PropertyKeyword",
+	"return":   "ReturnKeyword",
+	"type":     "TypeKeyword",
+	"typevar":  "TypeVarKeyword",
+}
+
+// attributeLists is the reverse of attributesOf. It joins adjacent Attribute nodes with the same
+// target into AttributeList nodes, unless the attribute starts a new list (see KeyAttributeList).
+// Attributes in uast:Group nodes are joined the same way.
+func attributeLists(arr nodes.Array) (nodes.Array, error) {
+	out := make(nodes.Array, 0, len(arr))
+	// index of the last list in out, and the target of this list
+	last := -1
+	var target nodes.Node
+	for _, sub := range arr {
+		obj, ok := sub.(nodes.Object)
+		if ok && uast.TypeOf(obj) == typeGroup {
+			nodesArr, _ := obj["Nodes"].(nodes.Array)
+			group, err := attributeLists(nodesArr)
+			if err != nil {
+				return nil, err
 			}
-			arr = append(arr[:i], arr[i+1:]...)
-			i--
+			obj = obj.CloneObject()
+			obj["Nodes"] = group
+			out = append(out, obj)
+			last = -1
 			continue
 		}
-		// secondary arrays the group annotations/modifiers, etc
-		arr2, ok := v.(nodes.Array)
-		if !ok {
+		if !ok || uast.TypeOf(obj) != "Attribute" {
+			out = append(out, sub)
+			last = -1
 			continue
 		}
-		// find a group node there
-		ind := firstWithType(arr2, func(typ string) bool {
-			return typ == typeGroup
-		})
-		if ind < 0 {
+		attr := obj.CloneObject()
+		// the field is removed by the reverse of the Attribute mapping
+		attr["Target"] = nil
+		first := listStart(attr)
+		if last >= 0 && !first && nodes.Equal(target, obj["Target"]) {
+			list := out[last].(nodes.Object)
+			list["Attributes"] = append(list["Attributes"].(nodes.Array), attr)
 			continue
 		}
-		group := arr2[ind].(nodes.Object)
-		// children array of an inner group
-		arr3, ok := group["Nodes"].(nodes.Array)
-		if !ok {
-			return false, errors.New("expected an array in Group.Nodes")
-		}
-		// flatten inner array into the secondary array
-		out := make(nodes.Array, 0, len(arr2)-1+len(arr3))
-		out = append(out, arr2[:ind]...)
-		out = append(out, arr3...)
-		out = append(out, arr2[ind+1:]...)
-		if !modified {
-			arr = arr.CloneList()
-			modified = true
+		target = obj["Target"]
+		spec, err := attributeTarget(target)
+		if err != nil {
+			return nil, err
 		}
-		arr[i] = out
-	}
-	if !modified {
-		return false, nil
+		last = len(out)
+		out = append(out, nodes.Object{
+			uast.KeyType:         nodes.String("AttributeList"),
+			"Target":             spec,
+			"Attributes":         nodes.Array{attr},
+			"IsMissing":          nodes.Bool(false),
+			"IsStructuredTrivia": nodes.Bool(false),
+		})
 	}
-	fgroup = fgroup.CloneObject()
-	fgroup["Nodes"] = arr
-	return op.sub.Check(st, fgroup)
+	return out, nil
 }
 
-func (op opMergeGroups) Construct(st *State, n nodes.Node) (nodes.Node, error) {
-	// TODO(dennwc): implement when we will need a reversal
-	//				 see https://github.com/bblfsh/sdk/issues/355
-	return op.sub.Construct(st, n)
+// attributeTarget creates an AttributeTargetSpecifier node for the target of the attribute list.
+// It returns nil if the list has no target.
+func attributeTarget(target nodes.Node) (nodes.Node, error) {
+	if target == nil {
+		return nil, nil
+	}
+	name, ok := target.(nodes.String)
+	if !ok {
+		return nil, ErrUnexpectedType.New(nodes.String(""), target)
+	}
+	var id nodes.Object
+	if kw, ok := attributeTargets[string(name)]; ok {
+		id = nodes.Object{
+			uast.KeyType: nodes.String(kw),
+			"IsMissing":  nodes.Bool(false),
+			"Text":       name,
+			"Value":      name,
+			"ValueText":  name,
+		}
+	} else {
+		id = nodes.Object{
+			uast.KeyType: nodes.String(uast.TypeOf(uast.Identifier{})),
+			"Name":       name,
+		}
+	}
+	return nodes.Object{
+		uast.KeyType:         nodes.String("AttributeTargetSpecifier"),
+		"Identifier":         id,
+		"IsMissing":          nodes.Bool(false),
+		"IsStructuredTrivia": nodes.Bool(false),
+	}, nil
 }
@@ -0,0 +1,127 @@
+package normalizer
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	. "github.com/bblfsh/sdk/v3/uast/transformer"
+)
+
+var _ CodeTransformer = FromUTF16Offset{}
+
+// FromUTF16Offset converts UTF-16 offsets reported by Roslyn to byte offsets, and sets line
+// and column of all positions in the tree.
+//
+// It's similar to positioner.FromUTF16Offset, but lines are split the same way as Roslyn does
+// it: "\r\n", "\n", a lone "\r" and Unicode line separators (U+0085, U+2028 and U+2029) all end
+// a line. Columns are 1-based byte offsets in a line, as defined by uast.Position.
+//
+// A UTF-8 BOM at the start of the file is passed to Roslyn as a U+FEFF character, which is
+// parsed as a whitespace. Thus, it's counted in offsets and columns of the first line, the same
+// way as other characters.
+type FromUTF16Offset struct{}
+
+// OnCode implements CodeTransformer.
+func (FromUTF16Offset) OnCode(code string) Transformer {
+	idx := newUTF16Index(code)
+	return TransformObjFunc(func(o nodes.Object) (nodes.Object, bool, error) {
+		pos := uast.AsPosition(o)
+		if pos == nil {
+			return o, false, nil
+		}
+		off, err := idx.Offset(int(pos.Offset))
+		if err != nil {
+			return o, false, err
+		}
+		pos.Offset = uint32(off)
+		line, col := idx.LineCol(off)
+		pos.Line, pos.Col = uint32(line), uint32(col)
+		o = o.CloneObject()
+		for k, v := range pos.ToObject() {
+			o[k] = v
+		}
+		return o, true, nil
+	})
+}
+
+// utf16Rune is a non-ASCII character of the source code.
+type utf16Rune struct {
+	off16, off8   int // UTF-16 and byte offsets of the character
+	size16, size8 int // size of the character in UTF-16 code units and in bytes
+}
+
+// utf16Index maps UTF-16 offsets to byte offsets, and byte offsets to lines and columns.
+type utf16Index struct {
+	// non-ASCII characters; offsets of other characters are computed from them
+	runes []utf16Rune
+	// byte offsets of line starts
+	lines []int
+	size8 int
+	// size of the source in UTF-16 code units
+	size16 int
+}
+
+func newUTF16Index(code string) *utf16Index {
+	idx := &utf16Index{size8: len(code), lines: []int{0}}
+	off16 := 0
+	for i := 0; i < len(code); {
+		r, n := utf8.DecodeRuneInString(code[i:])
+		size16 := 1
+		if r >= 0x10000 {
+			// surrogate pair
+			size16 = 2
+		}
+		if n > 1 {
+			idx.runes = append(idx.runes, utf16Rune{
+				off16: off16, off8: i,
+				size16: size16, size8: n,
+			})
+		}
+		switch r {
+		case '\r':
+			if i+1 < len(code) && code[i+1] == '\n' {
+				// \r\n is a single line break, the line starts after \n
+				break
+			}
+			idx.lines = append(idx.lines, i+n)
+		case '\n', '\u0085', '\u2028', '\u2029':
+			idx.lines = append(idx.lines, i+n)
+		}
+		off16 += size16
+		i += n
+	}
+	idx.size16 = off16
+	return idx
+}
+
+// Offset returns a byte offset for a UTF-16 offset. An offset that points to the middle
+// of a surrogate pair is mapped to the start of the character.
+func (idx *utf16Index) Offset(off16 int) (int, error) {
+	if off16 < 0 || off16 > idx.size16 {
+		return 0, fmt.Errorf("UTF-16 offset out of bounds: %d [0, %d]", off16, idx.size16)
+	}
+	// find the last non-ASCII character that starts before the offset
+	i := sort.Search(len(idx.runes), func(i int) bool {
+		return idx.runes[i].off16 > off16
+	}) - 1
+	if i < 0 {
+		return off16, nil
+	}
+	r := idx.runes[i]
+	if off16 < r.off16+r.size16 {
+		return r.off8, nil
+	}
+	// all characters after this one are ASCII
+	return r.off8 + r.size8 + (off16 - r.off16 - r.size16), nil
+}
+
+// LineCol returns a 1-based line and column for a byte offset.
+func (idx *utf16Index) LineCol(off int) (line, col int) {
+	line = sort.Search(len(idx.lines), func(i int) bool {
+		return idx.lines[i] > off
+	})
+	return line, off - idx.lines[line-1] + 1
+}
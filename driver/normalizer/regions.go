@@ -0,0 +1,327 @@
+package normalizer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	. "github.com/bblfsh/sdk/v3/uast/transformer"
+)
+
+var _ Transformer = RegionGroups{}
+
+// RegionGroups is an optional transformation of the semantic UAST that pairs #region and
+// #endregion directives and wraps members and statements between them into Region nodes.
+//
+// The Region node has the name of the region, positions that span both directives, and
+// an array of Nodes in the region. A region is put into the innermost Members or Statements
+// array that contains it. Directives without a pair are left as is.
+//
+// It must be executed after Normalize, see TransformsWithRegions.
+type RegionGroups struct{}
+
+// regionFields is a set of fields that contain members or statements.
+var regionFields = []string{"Members", "Statements"}
+
+// region is a pair of #region and #endregion directives.
+type region struct {
+	name       string
+	start, end uast.Position
+	// full span of both directives, if set
+	full uast.Positions
+	// done is set when the region is inserted into the tree
+	done bool
+}
+
+// Do implements Transformer.
+func (RegionGroups) Do(root nodes.Node) (nodes.Node, error) {
+	var (
+		regions []*region
+		dirs    []nodes.Object
+	)
+	nodes.WalkPreOrder(root, func(n nodes.Node) bool {
+		obj, ok := n.(nodes.Object)
+		if !ok {
+			return true
+		}
+		switch uast.TypeOf(obj) {
+		case "RegionDirectiveTrivia", "EndRegionDirectiveTrivia":
+			if uast.PositionsOf(obj).Start() != nil {
+				dirs = append(dirs, obj)
+			}
+			return false
+		}
+		return true
+	})
+	if len(dirs) == 0 {
+		return root, nil
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return uast.PositionsOf(dirs[i]).Start().Offset < uast.PositionsOf(dirs[j]).Start().Offset
+	})
+	// pair directives and find the ones that can be removed from the tree
+	paired := make(map[uint32]bool)
+	var stack []nodes.Object
+	for _, d := range dirs {
+		if uast.TypeOf(d) == "RegionDirectiveTrivia" {
+			stack = append(stack, d)
+			continue
+		} else if len(stack) == 0 {
+			continue
+		}
+		open := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		start, end := uast.PositionsOf(open).Start(), uast.PositionsOf(d).End()
+		if end == nil {
+			end = uast.PositionsOf(d).Start()
+		}
+		paired[start.Offset] = true
+		paired[uast.PositionsOf(d).Start().Offset] = true
+		r := &region{
+			name:  regionName(open),
+			start: *start,
+			end:   *end,
+		}
+		if pos := spanPositions(open, d); pos[KeyFullStart] != (uast.Position{}) {
+			r.full = uast.Positions{KeyFullStart: pos[KeyFullStart], KeyFullEnd: pos[KeyFullEnd]}
+		}
+		regions = append(regions, r)
+	}
+	if len(regions) == 0 {
+		return root, nil
+	}
+	// process inner regions first
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].end.Offset-regions[i].start.Offset < regions[j].end.Offset-regions[j].start.Offset
+	})
+	root, _ = removeDirectives(root, paired)
+	root, _ = insertRegions(root, regions, nil)
+	return root, nil
+}
+
+// regionName returns the text of the #region directive after the keyword.
+func regionName(d nodes.Object) string {
+	tok, _ := d[uast.KeyToken].(nodes.String)
+	s := strings.TrimSpace(string(tok))
+	s = strings.TrimSpace(strings.TrimPrefix(s, "#"))
+	s = strings.TrimPrefix(s, "region")
+	return strings.TrimSpace(s)
+}
+
+// removeDirectives removes paired region directives from all arrays of the tree.
+// Groups that contain a single node after the removal are replaced with that node.
+// It returns false if the node was not changed.
+func removeDirectives(n nodes.Node, paired map[uint32]bool) (nodes.Node, bool) {
+	switch n := n.(type) {
+	case nodes.Object:
+		var out nodes.Object
+		for k, v := range n {
+			v2, changed := removeDirectives(v, paired)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = n.CloneObject()
+			}
+			out[k] = v2
+		}
+		if out == nil {
+			return n, false
+		}
+		if uast.TypeOf(out) == typeGroup {
+			if arr, ok := out["Nodes"].(nodes.Array); ok && len(arr) == 1 {
+				return arr[0], true
+			}
+		}
+		return out, true
+	case nodes.Array:
+		var out nodes.Array
+		for i, v := range n {
+			if isPairedDirective(v, paired) {
+				if out == nil {
+					out = append(nodes.Array{}, n[:i]...)
+				}
+				continue
+			}
+			v2, changed := removeDirectives(v, paired)
+			if out == nil && changed {
+				out = append(nodes.Array{}, n[:i]...)
+			}
+			if out != nil {
+				out = append(out, v2)
+			}
+		}
+		if out == nil {
+			return n, false
+		}
+		return out, true
+	}
+	return n, false
+}
+
+// isPairedDirective checks if the node is a region directive that has a pair.
+func isPairedDirective(n nodes.Node, paired map[uint32]bool) bool {
+	obj, ok := n.(nodes.Object)
+	if !ok {
+		return false
+	}
+	switch uast.TypeOf(obj) {
+	case "RegionDirectiveTrivia", "EndRegionDirectiveTrivia":
+	default:
+		return false
+	}
+	start := uast.PositionsOf(obj).Start()
+	return start != nil && paired[start.Offset]
+}
+
+// insertRegions wraps members and statements of the tree into regions. Children are
+// processed first, thus regions are inserted into the innermost node that contains them.
+//
+// Nodes without positions use positions of the parent. For example, TypeDeclaration
+// uses positions of uast:Alias. It returns false if the node was not changed.
+func insertRegions(n nodes.Node, regions []*region, parent uast.Positions) (nodes.Node, bool) {
+	switch n := n.(type) {
+	case nodes.Array:
+		var out nodes.Array
+		for i, v := range n {
+			v2, changed := insertRegions(v, regions, parent)
+			if out == nil && changed {
+				out = append(nodes.Array{}, n[:i]...)
+			}
+			if out != nil {
+				out = append(out, v2)
+			}
+		}
+		if out == nil {
+			return n, false
+		}
+		return out, true
+	case nodes.Object:
+		pos := uast.PositionsOf(n)
+		if pos.Start() == nil || pos.End() == nil {
+			pos = parent
+		}
+		var out nodes.Object
+		for k, v := range n {
+			v2, changed := insertRegions(v, regions, pos)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = n.CloneObject()
+			}
+			out[k] = v2
+		}
+		cur := n
+		if out != nil {
+			cur = out
+		}
+		for _, f := range regionFields {
+			arr, ok := cur[f].(nodes.Array)
+			if !ok {
+				continue
+			}
+			start, end := pos.Start(), pos.End()
+			if start == nil || end == nil {
+				break
+			}
+			for _, r := range regions {
+				if r.done || r.start.Offset < start.Offset || r.end.Offset > end.Offset {
+					continue
+				}
+				r.done = true
+				arr = wrapRegion(arr, r)
+				if out == nil {
+					out = n.CloneObject()
+					cur = out
+				}
+				out[f] = arr
+			}
+		}
+		return cur, out != nil
+	}
+	return n, false
+}
+
+// wrapRegion replaces nodes of the array that are inside of the region with a Region node.
+func wrapRegion(arr nodes.Array, r *region) nodes.Array {
+	var (
+		inner nodes.Array
+		out   = make(nodes.Array, 0, len(arr)+1)
+		ind   = -1
+	)
+	for _, v := range arr {
+		start, end := nodeSpan(v)
+		if start != nil && end != nil && start.Offset >= r.start.Offset && end.Offset <= r.end.Offset {
+			if ind < 0 {
+				ind = len(out)
+			}
+			inner = append(inner, v)
+			continue
+		}
+		if ind < 0 && start != nil && start.Offset >= r.end.Offset {
+			// an empty region
+			ind = len(out)
+		}
+		out = append(out, v)
+	}
+	if ind < 0 {
+		ind = len(out)
+	}
+	if inner == nil {
+		inner = nodes.Array{}
+	}
+	pos := uast.Positions{
+		uast.KeyStart: r.start,
+		uast.KeyEnd:   r.end,
+	}
+	for k, v := range r.full {
+		pos[k] = v
+	}
+	reg := nodes.Object{
+		uast.KeyType: nodes.String("Region"),
+		uast.KeyPos:  pos.ToObject(),
+		"Name":       nodes.String(r.name),
+		"Nodes":      inner,
+	}
+	out = append(out, nil)
+	copy(out[ind+1:], out[ind:])
+	out[ind] = reg
+	return out
+}
+
+// nodeSpan returns the start and end positions of the node. If the node has no positions,
+// they are computed from its children.
+func nodeSpan(n nodes.Node) (start, end *uast.Position) {
+	switch n := n.(type) {
+	case nodes.Object:
+		pos := uast.PositionsOf(n)
+		if s, e := pos.Start(), pos.End(); s != nil && e != nil {
+			return s, e
+		}
+		for k, v := range n {
+			if k == uast.KeyPos {
+				continue
+			}
+			start, end = joinSpan(start, end, v)
+		}
+	case nodes.Array:
+		for _, v := range n {
+			start, end = joinSpan(start, end, v)
+		}
+	}
+	return start, end
+}
+
+// joinSpan extends the span with positions of the node.
+func joinSpan(start, end *uast.Position, n nodes.Node) (*uast.Position, *uast.Position) {
+	s, e := nodeSpan(n)
+	if s != nil && (start == nil || s.Offset < start.Offset) {
+		start = s
+	}
+	if e != nil && (end == nil || e.Offset > end.Offset) {
+		end = e
+	}
+	return start, end
+}
@@ -0,0 +1,628 @@
+package normalizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+	. "github.com/bblfsh/sdk/v3/uast/transformer"
+)
+
+// Denormalize is the reverse of Normalize. It converts a semantic UAST produced by Normalize
+// back to the native AST, as it was after the Preprocess stage.
+//
+// The normalizer drops punctuation, some of the keywords and positions of nodes that have
+// no counterpart in the semantic UAST (parentheses, semicolons, parameter lists, etc.), and
+// these fields are missing in the result. Tokens that are restored from other fields of
+// the semantic node (modifiers, operators, etc.) only have the type. All other fields, including
+// trivia of tokens, are the same as in the native AST, and no semantic nodes are left in the tree.
+// It allows to edit the semantic UAST and convert it back to the native AST.
+//
+// The list of fields that are not restored is maintained in the reverse tests of fixtures.
+// See ToNative for converting the UAST returned by the driver.
+var Denormalize = []Transformer{
+	reverseMappings(Normalizers),
+	identifierNames{},
+	reverseMappings(triviaMappings),
+	tokenTrivia{},
+}
+
+// ToNative converts a semantic UAST returned by the driver back to the native AST.
+//
+// It removes the namespace of the driver and roles from all nodes, and runs Denormalize.
+// The result has the same limitations as Denormalize: fields dropped by the normalizer
+// are missing.
+func ToNative(ast nodes.Node) (nodes.Node, error) {
+	ast = stripAnnotations(ast)
+	var err error
+	for _, t := range Denormalize {
+		ast, err = t.Do(ast)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ast, nil
+}
+
+// textTokenTypes is a list of native token types that have their Text field renamed to
+// the token by Annotations. All other tokens have the Value field renamed instead.
+var textTokenTypes = map[string]bool{
+	"NumericLiteralToken":   true,
+	"CharacterLiteralToken": true,
+	"StringLiteralToken":    true,
+	"IdentifierToken":       true,
+}
+
+// stripAnnotations removes roles and the namespace prefix of node types added by
+// the Annotations stage of the driver, and restores token fields renamed by it.
+func stripAnnotations(n nodes.Node) nodes.Node {
+	switch n := n.(type) {
+	case nodes.Object:
+		out := make(nodes.Object, len(n))
+		for k, v := range n {
+			switch k {
+			case uast.KeyRoles:
+				continue
+			case uast.KeyType:
+				if typ, ok := v.(nodes.String); ok {
+					v = nodes.String(strings.TrimPrefix(string(typ), "csharp:"))
+				}
+			default:
+				v = stripAnnotations(v)
+			}
+			out[k] = v
+		}
+		if tok, ok := out[uast.KeyToken]; ok {
+			typ := uast.TypeOf(out)
+			switch {
+			case textTokenTypes[typ]:
+				delete(out, uast.KeyToken)
+				out["Text"] = tok
+			case !isSourceToken(typ):
+				delete(out, uast.KeyToken)
+				out["Value"] = tok
+			}
+		}
+		return out
+	case nodes.Array:
+		out := make(nodes.Array, 0, len(n))
+		for _, v := range n {
+			out = append(out, stripAnnotations(v))
+		}
+		return out
+	}
+	return n
+}
+
+// isSourceToken checks if the native node gets the token from the source code, instead
+// of Annotations.
+func isSourceToken(typ string) bool {
+	for _, t := range sourceTokenTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// identifierNames wraps identifier tokens restored by the reverse transformation into
+// IdentifierName nodes, and restores fields of both nodes that are dropped by the normalizer.
+//
+// Both IdentifierToken and IdentifierName are normalized to uast:Identifier, and only the field
+// of the parent node tells them apart: tokens are always stored in the Identifier field of
+// the declaration or of the IdentifierName, while all other fields refer to IdentifierName.
+type identifierNames struct{}
+
+// Do implements Transformer.
+func (identifierNames) Do(root nodes.Node) (nodes.Node, error) {
+	return wrapIdentifiers(root, false), nil
+}
+
+// wrapIdentifiers wraps identifier tokens in the tree into IdentifierName nodes. The token
+// flag is set if the node is stored in a field of the parent that refers to the token.
+//
+// Trivia groups are not yet unwrapped at this stage, thus nodes of the group are stored in
+// the same field as the group itself.
+func wrapIdentifiers(n nodes.Node, token bool) nodes.Node {
+	switch n := n.(type) {
+	case nodes.Object:
+		group := uast.TypeOf(n) == typeGroup
+		out := make(nodes.Object, len(n))
+		for k, v := range n {
+			out[k] = wrapIdentifiers(v, k == "Identifier" || (group && k == "Nodes" && token))
+		}
+		switch typ := uast.TypeOf(out); {
+		case typ == "IdentifierName":
+			restoreIdentifierName(out)
+			return out
+		case typ != "IdentifierToken":
+			return out
+		}
+		restoreIdentifierText(out)
+		if token {
+			return out
+		}
+		name := nodes.Object{
+			uast.KeyType:         nodes.String("IdentifierName"),
+			"Identifier":         out,
+			"Arity":              nodes.Int(0),
+			"IsMissing":          nodes.Bool(false),
+			"IsStructuredTrivia": nodes.Bool(false),
+		}
+		restoreIdentifierName(name)
+		return name
+	case nodes.Array:
+		out := make(nodes.Array, 0, len(n))
+		for _, v := range n {
+			out = append(out, wrapIdentifiers(v, token))
+		}
+		return out
+	}
+	return n
+}
+
+// restoreIdentifierText restores the Text of the identifier token dropped by the normalizer.
+// It differs from the ValueText only for verbatim identifiers, and the "@" prefix is detected
+// by the length of the token. Text of identifiers with escape sequences is not restored.
+func restoreIdentifierText(tok nodes.Object) {
+	if tok["Text"] != nil {
+		return
+	}
+	val, ok := tok["ValueText"].(nodes.String)
+	if !ok {
+		return
+	}
+	pos := uast.PositionsOf(tok)
+	start, end := pos.Start(), pos.End()
+	if start == nil || end == nil {
+		return
+	}
+	switch int(end.Offset - start.Offset) {
+	case len(val):
+		tok["Text"] = val
+	case len(val) + 1:
+		tok["Text"] = "@" + val
+	}
+}
+
+// identifierFlags are the fields of IdentifierName set by the parser for contextual keywords.
+var identifierFlags = map[string]string{
+	"IsVar":       "var",
+	"IsUnmanaged": "unmanaged",
+	"IsNint":      "nint",
+	"IsNuint":     "nuint",
+	"IsNotNull":   "notnull",
+}
+
+// restoreIdentifierName restores fields of the IdentifierName node dropped by the normalizer:
+// flags of contextual keywords and positions, which are the same as for the identifier token.
+func restoreIdentifierName(obj nodes.Object) {
+	tok, ok := obj["Identifier"].(nodes.Object)
+	if ok && uast.TypeOf(tok) == typeGroup {
+		// the token with trivia
+		arr, _ := tok["Nodes"].(nodes.Array)
+		tok = nil
+		for _, v := range arr {
+			if v, ok := v.(nodes.Object); ok && uast.TypeOf(v) == "IdentifierToken" {
+				tok = v
+			}
+		}
+	}
+	if tok == nil {
+		return
+	}
+	text, ok := tok["Text"].(nodes.String)
+	if !ok {
+		// verbatim identifiers are not keywords, but the text is unknown
+		text, _ = tok["ValueText"].(nodes.String)
+	}
+	for k, kw := range identifierFlags {
+		if obj[k] == nil {
+			obj[k] = nodes.Bool(string(text) == kw)
+		}
+	}
+	if pos, ok := tok[uast.KeyPos].(nodes.Object); ok && obj[uast.KeyPos] == nil {
+		obj[uast.KeyPos] = pos.CloneObject()
+	}
+}
+
+// reverseMappings applies mappings in the reverse direction.
+//
+// Mappings are applied to each node in the reverse order, and the tree is traversed from
+// the root to leaves. This is the opposite of the way Mappings applies them, thus the parent
+// node always sees its children the same way as the forward transformation produced them.
+type reverseMappings []Mapping
+
+// Do implements Transformer.
+func (m reverseMappings) Do(root nodes.Node) (nodes.Node, error) {
+	return m.apply(NewState(), root, nil)
+}
+
+// apply reverses all mappings on the node and its children, except the mappings with
+// the skip indexes. The skip index is set for a node that was wrapped by a mapping that
+// replaces a node with one of its children (IdentifierName, etc), otherwise the node
+// would be wrapped again.
+func (m reverseMappings) apply(st *State, n nodes.Node, skip map[int]bool) (nodes.Node, error) {
+	if n == nil {
+		// nodes removed by the normalizer cannot be restored
+		return nil, nil
+	}
+	wrapped := make(map[int]nodes.Node)
+	for i := len(m) - 1; i >= 0; i-- {
+		if skip[i] {
+			continue
+		}
+		src, dst := m[i].Mapping()
+		st.Reset()
+		if ok, err := dst.Check(st, n); ErrUnusedField.Is(err) {
+			// the node has fields that are not known to the mapping,
+			// thus it was produced by a different mapping
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("reverse mapping %d: %v", i, err)
+		} else if !ok {
+			continue
+		}
+		nn, err := src.Construct(st, nil)
+		if err != nil {
+			return nil, fmt.Errorf("reverse mapping %d: %v", i, err)
+		}
+		if kind := n.Kind(); kind == nodes.KindObject || kind == nodes.KindArray {
+			wrapped[i] = n
+		}
+		n = nn
+	}
+	child := func(v nodes.Node) (nodes.Node, error) {
+		// the same node may be kept in place by multiple mappings
+		var skip map[int]bool
+		for i, w := range wrapped {
+			if v != nil && nodes.Same(v, w) {
+				if skip == nil {
+					skip = make(map[int]bool)
+				}
+				skip[i] = true
+			}
+		}
+		return m.apply(st, v, skip)
+	}
+	switch n := n.(type) {
+	case nodes.Object:
+		out := make(nodes.Object, len(n))
+		for k, v := range n {
+			v2, err := child(v)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v2
+		}
+		return out, nil
+	case nodes.Array:
+		out := make(nodes.Array, 0, len(n))
+		for _, v := range n {
+			v2, err := child(v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v2)
+		}
+		return out, nil
+	}
+	return n, nil
+}
+
+// tokenTrivia moves trivia restored by the reverse transformation back to tokens.
+//
+// Only tokens have trivia in the native AST, but opMoveTrivias moves it from tokens to the
+// parent nodes and to triviaField arrays. The token that had the trivia is found by positions,
+// since the full span of the token includes its trivia. If the token was dropped by the
+// normalizer, it is restored for known cases (see firstToken, closeToken and restoreSemicolon),
+// otherwise the trivia is kept in place.
+type tokenTrivia struct{}
+
+// span is a range of offsets in the source file.
+type span struct {
+	start, end uint32
+}
+
+// tokenSpans returns the span and the full span of the token, or false if the node is not
+// a token or has no positions.
+func tokenSpans(n nodes.Node) (sp, full span, ok bool) {
+	obj, ok := n.(nodes.Object)
+	if !ok || !isToken(uast.TypeOf(obj)) {
+		return span{}, span{}, false
+	}
+	pos := uast.PositionsOf(obj)
+	start, ok1 := pos[uast.KeyStart]
+	end, ok2 := pos[uast.KeyEnd]
+	fstart, ok3 := pos[KeyFullStart]
+	fend, ok4 := pos[KeyFullEnd]
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return span{}, span{}, false
+	}
+	return span{start.Offset, end.Offset}, span{fstart.Offset, fend.Offset}, true
+}
+
+// isToken checks if the native node type is a token. Missing optional tokens have the None type.
+func isToken(typ string) bool {
+	return typ == "None" || strings.HasSuffix(typ, "Token") || strings.HasSuffix(typ, "Keyword")
+}
+
+// triviaSpan returns the span of the trivia node, or false if the node is not a trivia
+// or has no positions.
+func triviaSpan(n nodes.Node) (span, bool) {
+	obj, ok := n.(nodes.Object)
+	if !ok || !strings.HasSuffix(uast.TypeOf(obj), "Trivia") {
+		return span{}, false
+	}
+	pos := uast.PositionsOf(obj)
+	start, ok1 := pos[uast.KeyStart]
+	end, ok2 := pos[uast.KeyEnd]
+	if !ok1 || !ok2 {
+		return span{}, false
+	}
+	return span{start.Offset, end.Offset}, true
+}
+
+// Do implements Transformer.
+func (tokenTrivia) Do(root nodes.Node) (nodes.Node, error) {
+	t := &triviaMover{
+		moved:  make(map[span]nodes.Array),
+		tokens: make(map[span]nodes.Object),
+	}
+	t.collect(root)
+	root = t.move(root)
+	for full, arr := range t.moved {
+		tok := t.tokens[full]
+		sp, _, _ := tokenSpans(tok)
+		leading, _ := tok["LeadingTrivia"].(nodes.Array)
+		trailing, _ := tok["TrailingTrivia"].(nodes.Array)
+		for _, v := range arr {
+			if tsp, _ := triviaSpan(v); tsp.end <= sp.start {
+				leading = append(leading, v)
+			} else {
+				trailing = append(trailing, v)
+			}
+		}
+		sortBySpan(leading)
+		sortBySpan(trailing)
+		tok["LeadingTrivia"] = leading
+		tok["TrailingTrivia"] = trailing
+	}
+	return root, nil
+}
+
+// sortBySpan sorts trivia nodes by the start offset.
+func sortBySpan(arr nodes.Array) {
+	sort.SliceStable(arr, func(i, j int) bool {
+		a, _ := triviaSpan(arr[i])
+		b, _ := triviaSpan(arr[j])
+		return a.start < b.start
+	})
+}
+
+type triviaMover struct {
+	// full spans of all tokens in the tree
+	spans []span
+	// trivia moved from nodes, indexed by the full span of the token
+	moved map[span]nodes.Array
+	// tokens of the new tree, indexed by the full span
+	tokens map[span]nodes.Object
+}
+
+// collect finds the full spans of all tokens in the tree.
+func (t *triviaMover) collect(n nodes.Node) {
+	switch n := n.(type) {
+	case nodes.Object:
+		if _, full, ok := tokenSpans(n); ok {
+			t.spans = append(t.spans, full)
+		}
+		for _, v := range n {
+			t.collect(v)
+		}
+	case nodes.Array:
+		for _, v := range n {
+			t.collect(v)
+		}
+	}
+}
+
+// owner returns the full span of the token that includes the trivia.
+func (t *triviaMover) owner(n nodes.Node) (span, bool) {
+	sp, ok := triviaSpan(n)
+	if !ok {
+		return span{}, false
+	}
+	for _, full := range t.spans {
+		if full.start <= sp.start && sp.end <= full.end {
+			return full, true
+		}
+	}
+	return span{}, false
+}
+
+// filter removes trivia that belongs to one of the tokens from the array. Other nodes
+// are kept in place.
+func (t *triviaMover) filter(arr nodes.Array) nodes.Array {
+	out := make(nodes.Array, 0, len(arr))
+	for _, v := range arr {
+		if full, ok := t.owner(v); ok {
+			t.moved[full] = append(t.moved[full], v)
+			continue
+		}
+		out = append(out, t.move(v))
+	}
+	return out
+}
+
+// move copies the tree and removes trivia of non-token nodes that can be moved to tokens.
+func (t *triviaMover) move(n nodes.Node) nodes.Node {
+	switch n := n.(type) {
+	case nodes.Object:
+		_, full, token := tokenSpans(n)
+		field := triviaField[uast.TypeOf(n)]
+		out := make(nodes.Object, len(n))
+		for k, v := range n {
+			arr, ok := v.(nodes.Array)
+			switch {
+			case !ok || token:
+				out[k] = t.move(v)
+			case k == "LeadingTrivia" || k == "TrailingTrivia":
+				if arr = t.filter(arr); len(arr) != 0 {
+					out[k] = arr
+				}
+			case k == field:
+				out[k] = t.filter(arr)
+			default:
+				out[k] = t.move(v)
+			}
+		}
+		if isToken(uast.TypeOf(out)) {
+			// empty trivia of tokens is dropped by the normalizer
+			for _, k := range []string{"LeadingTrivia", "TrailingTrivia"} {
+				if _, ok := out[k].(nodes.Array); !ok {
+					out[k] = nodes.Array{}
+				}
+			}
+			if token {
+				t.tokens[full] = out
+			}
+			return out
+		}
+		if arr, ok := out[field].(nodes.Array); ok {
+			out[field] = restoreCloseToken(out, arr)
+		}
+		if arr, ok := out["LeadingTrivia"].(nodes.Array); ok {
+			restoreFirstToken(out, arr)
+		}
+		if arr, ok := out["TrailingTrivia"].(nodes.Array); ok {
+			restoreSemicolon(out, arr)
+		}
+		return out
+	case nodes.Array:
+		out := make(nodes.Array, 0, len(n))
+		for _, v := range n {
+			out = append(out, t.move(v))
+		}
+		return out
+	}
+	return n
+}
+
+// tokenField is a token of the native node that is dropped by the normalizer. It has no positions
+// that would allow to find it, thus the trivia of the token is moved to the parent node.
+type tokenField struct {
+	field, typ, text string
+}
+
+// restore returns the token of the node. The token is restored if it was dropped.
+func (f tokenField) restore(obj nodes.Object) (nodes.Object, bool) {
+	tok, ok := obj[f.field].(nodes.Object)
+	if !ok {
+		tok = nodes.Object{
+			uast.KeyType: nodes.String(f.typ),
+			"IsMissing":  nodes.Bool(false),
+			"Text":       nodes.String(f.text),
+			"Value":      nodes.String(f.text),
+			"ValueText":  nodes.String(f.text),
+		}
+		obj[f.field] = tok
+	}
+	return tok, uast.TypeOf(tok) == f.typ
+}
+
+// firstToken specifies the first token of declarations, if they have no attributes and modifiers.
+var firstToken = map[string]tokenField{
+	"UsingDirective":                 {"UsingKeyword", "UsingKeyword", "using"},
+	"LocalDeclarationStatement":      {"UsingKeyword", "UsingKeyword", "using"},
+	"UsingStatement":                 {"UsingKeyword", "UsingKeyword", "using"},
+	"NamespaceDeclaration":           {"NamespaceKeyword", "NamespaceKeyword", "namespace"},
+	"FileScopedNamespaceDeclaration": {"NamespaceKeyword", "NamespaceKeyword", "namespace"},
+	"ClassDeclaration":               {"Keyword", "ClassKeyword", "class"},
+	"StructDeclaration":              {"Keyword", "StructKeyword", "struct"},
+	"InterfaceDeclaration":           {"Keyword", "InterfaceKeyword", "interface"},
+	"RecordDeclaration":              {"Keyword", "RecordKeyword", "record"},
+	"EnumDeclaration":                {"EnumKeyword", "EnumKeyword", "enum"},
+	"DelegateDeclaration":            {"DelegateKeyword", "DelegateKeyword", "delegate"},
+}
+
+// closeToken specifies the token that follows the triviaField array of the node. Trivia at the
+// end of the array is the leading trivia of this token.
+var closeToken = map[string]tokenField{
+	"Block": {"CloseBraceToken", "CloseBraceToken", "}"},
+}
+
+// awaitKeyword is the first token of "await using" statements.
+var awaitKeyword = tokenField{"AwaitKeyword", "AwaitKeyword", "await"}
+
+// openBracket is the first token of the AttributeList node.
+var openBracket = tokenField{"OpenBracketToken", "OpenBracketToken", "["}
+
+// restoreFirstToken moves the leading trivia of the declaration to its first token. It is either
+// the first token of attribute lists, or the token from firstToken if there are no modifiers.
+func restoreFirstToken(obj nodes.Object, trivia nodes.Array) {
+	owner := obj
+	first, ok := firstToken[uast.TypeOf(obj)]
+	if ok && uast.TypeOf(obj["AwaitKeyword"]) == awaitKeyword.typ {
+		// await using
+		first = awaitKeyword
+	}
+	if arr, _ := obj["AttributeLists"].(nodes.Array); len(arr) != 0 {
+		// attribute lists are restored from attributes and have no positions
+		list, ok := arr[0].(nodes.Object)
+		if !ok || uast.TypeOf(list) != "AttributeList" {
+			return
+		}
+		owner, first = list, openBracket
+	} else if arr, _ := obj["Modifiers"].(nodes.Array); !ok || len(arr) != 0 {
+		return
+	}
+	tok, ok := first.restore(owner)
+	if !ok {
+		return
+	}
+	leading, _ := tok["LeadingTrivia"].(nodes.Array)
+	tok["LeadingTrivia"] = append(trivia, leading...)
+	delete(obj, "LeadingTrivia")
+}
+
+// semicolon is the last token of statements and declarations.
+var semicolon = tokenField{"SemicolonToken", "SemicolonToken", ";"}
+
+// restoreSemicolon moves the trailing trivia of the node to its semicolon token.
+func restoreSemicolon(obj nodes.Object, trivia nodes.Array) {
+	if _, ok := obj[semicolon.field]; !ok {
+		return
+	}
+	tok, ok := semicolon.restore(obj)
+	if !ok {
+		return
+	}
+	trailing, _ := tok["TrailingTrivia"].(nodes.Array)
+	tok["TrailingTrivia"] = append(trailing, trivia...)
+	delete(obj, "TrailingTrivia")
+}
+
+// restoreCloseToken moves the trivia at the end of the triviaField array to the token that
+// follows it. It returns the array without the trivia.
+func restoreCloseToken(obj nodes.Object, arr nodes.Array) nodes.Array {
+	last, ok := closeToken[uast.TypeOf(obj)]
+	if !ok {
+		return arr
+	}
+	i := len(arr)
+	for i > 0 && isTrivia(arr[i-1]) {
+		i--
+	}
+	if i == len(arr) {
+		return arr
+	}
+	tok, ok := last.restore(obj)
+	if !ok {
+		return arr
+	}
+	leading, _ := tok["LeadingTrivia"].(nodes.Array)
+	tok["LeadingTrivia"] = append(leading, arr[i:]...)
+	return arr[:i]
+}
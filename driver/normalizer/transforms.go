@@ -9,3 +9,13 @@ var Transforms = driver.Transforms{
 	Normalize:      Normalize,
 	Annotations:    Native,
 }
+
+// TransformsWithRegions is the same as Transforms, but it also groups members between
+// #region and #endregion directives in Semantic mode, see RegionGroups.
+var TransformsWithRegions = driver.Transforms{
+	Namespace:      "csharp",
+	Preprocess:     Preprocess,
+	PreprocessCode: PreprocessCode,
+	Normalize:      append(Normalize[:len(Normalize):len(Normalize)], RegionGroups{}),
+	Annotations:    Native,
+}
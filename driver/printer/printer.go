@@ -0,0 +1,146 @@
+// Package printer prints the native C# AST back to the source code.
+//
+// The native AST must be parsed with the Trivia option of the driver (see impl.Options),
+// otherwise only the text of tokens is available and whitespaces and comments are lost.
+// A tree parsed this way is printed byte-for-byte.
+package printer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+)
+
+// token is a token of the native AST together with its trivia.
+type token struct {
+	typ string
+	// start and end of the FullSpan of the token, in UTF-16 code units,
+	// or in bytes if the span was converted to positions
+	start, end int
+	// text of the token and its trivia
+	text string
+}
+
+// Fprint writes the source code of the native AST to w.
+//
+// Fields of native nodes are not ordered, thus tokens are printed in order of their
+// FullSpan, or full_start and full_end positions if the span was converted to positions.
+// When editing the tree, new tokens must have positions between the positions of the
+// preceding and the following tokens. Leading and trailing trivia are printed with
+// the token, and are not required to have positions.
+func Fprint(w io.Writer, ast nodes.Node) error {
+	toks, err := tokens(ast)
+	if err != nil {
+		return err
+	}
+	for i, t := range toks {
+		if i > 0 && toks[i-1].start == t.start && toks[i-1].end == t.end && toks[i-1].typ == t.typ {
+			// the same token is returned by different properties of the node
+			continue
+		}
+		if _, err := io.WriteString(w, t.text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sprint returns the source code of the native AST.
+func Sprint(ast nodes.Node) (string, error) {
+	var buf strings.Builder
+	if err := Fprint(&buf, ast); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// tokens returns all tokens of the native AST in the order of the source.
+func tokens(ast nodes.Node) ([]token, error) {
+	var (
+		out  []token
+		last error
+	)
+	nodes.WalkPreOrder(ast, func(n nodes.Node) bool {
+		obj, ok := n.(nodes.Object)
+		if !ok || last != nil {
+			return last == nil
+		}
+		lead, ok1 := obj["LeadingTrivia"].(nodes.Array)
+		trail, ok2 := obj["TrailingTrivia"].(nodes.Array)
+		text, ok3 := obj["Text"].(nodes.String)
+		if !ok1 || !ok2 || !ok3 {
+			return true
+		}
+		t := token{typ: uast.TypeOf(obj)}
+		t.start, t.end, ok = fullSpan(obj)
+		if !ok {
+			last = fmt.Errorf("token %s %q has no position", t.typ, text)
+			return false
+		}
+		var buf strings.Builder
+		if err := writeTrivia(&buf, lead); err != nil {
+			last = err
+			return false
+		}
+		buf.WriteString(string(text))
+		if err := writeTrivia(&buf, trail); err != nil {
+			last = err
+			return false
+		}
+		t.text = buf.String()
+		out = append(out, t)
+		return false
+	})
+	if last != nil {
+		return nil, last
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].start != out[j].start {
+			return out[i].start < out[j].start
+		}
+		return out[i].end < out[j].end
+	})
+	return out, nil
+}
+
+// writeTrivia writes the text of all trivia in the array.
+func writeTrivia(buf *strings.Builder, arr nodes.Array) error {
+	for _, n := range arr {
+		obj, ok := n.(nodes.Object)
+		if !ok {
+			return fmt.Errorf("expected trivia object, got: %T", n)
+		}
+		text, ok := obj["Text"].(nodes.String)
+		if !ok {
+			return fmt.Errorf("trivia %s has no text; the tree must be parsed with the Trivia option", uast.TypeOf(obj))
+		}
+		buf.WriteString(string(text))
+	}
+	return nil
+}
+
+// fullSpan returns the FullSpan of the native node. If the span was already converted to
+// positions of the node, full_start and full_end positions are used instead.
+func fullSpan(obj nodes.Object) (start, end int, _ bool) {
+	span, ok := obj["FullSpan"].(nodes.Object)
+	if !ok {
+		pos := uast.PositionsOf(obj)
+		s, ok1 := pos[normalizer.KeyFullStart]
+		e, ok2 := pos[normalizer.KeyFullEnd]
+		if !ok1 || !ok2 {
+			return 0, 0, false
+		}
+		return int(s.Offset), int(e.Offset), true
+	}
+	s, ok1 := span["Start"].(nodes.Int)
+	e, ok2 := span["End"].(nodes.Int)
+	if !ok1 || !ok2 {
+		return 0, 0, false
+	}
+	return int(s), int(e), true
+}
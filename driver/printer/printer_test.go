@@ -0,0 +1,118 @@
+package printer
+
+import (
+	"testing"
+
+	"github.com/bblfsh/csharp-driver/driver/normalizer"
+	"github.com/bblfsh/sdk/v3/uast"
+	"github.com/bblfsh/sdk/v3/uast/nodes"
+)
+
+func span(start, end int) nodes.Object {
+	return nodes.Object{
+		"@type": nodes.String("TextSpan"),
+		"Start": nodes.Int(start),
+		"End":   nodes.Int(end),
+	}
+}
+
+func trivia(typ, text string) nodes.Object {
+	return nodes.Object{
+		"@type": nodes.String(typ),
+		"Text":  nodes.String(text),
+	}
+}
+
+func tok(typ, text string, start, end int, lead, trail nodes.Array) nodes.Object {
+	if lead == nil {
+		lead = nodes.Array{}
+	}
+	if trail == nil {
+		trail = nodes.Array{}
+	}
+	return nodes.Object{
+		"@type":          nodes.String(typ),
+		"FullSpan":       span(start, end),
+		"Text":           nodes.String(text),
+		"LeadingTrivia":  lead,
+		"TrailingTrivia": trail,
+	}
+}
+
+func TestSprint(t *testing.T) {
+	const src = "// f\r\nf(a, b);\n"
+	comma := tok("CommaToken", ",", 9, 11, nil, nodes.Array{trivia("WhitespaceTrivia", " ")})
+	ast := nodes.Object{
+		"@type": nodes.String("ExpressionStatement"),
+		"Expression": nodes.Object{
+			"@type": nodes.String("InvocationExpression"),
+			"ArgumentList": nodes.Object{
+				"@type": nodes.String("ArgumentList"),
+				"Arguments": nodes.Array{
+					nodes.Object{"Expression": tok("IdentifierToken", "a", 8, 9, nil, nil)},
+					nodes.Object{"Expression": tok("IdentifierToken", "b", 11, 12, nil, nil)},
+				},
+				"ArgumentsSeparators": nodes.Array{comma},
+				"CloseParenToken":     tok("CloseParenToken", ")", 12, 13, nil, nil),
+				"OpenParenToken":      tok("OpenParenToken", "(", 7, 8, nil, nil),
+			},
+			"Expression": tok("IdentifierToken", "f", 0, 7, nodes.Array{
+				trivia("SingleLineCommentTrivia", "// f"),
+				trivia("EndOfLineTrivia", "\r\n"),
+			}, nil),
+		},
+		// the same token returned by a different property
+		"LastToken":      comma,
+		"SemicolonToken": tok("SemicolonToken", ";", 13, 15, nil, nodes.Array{trivia("EndOfLineTrivia", "\n")}),
+	}
+	got, err := Sprint(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != src {
+		t.Errorf("unexpected source: %q", got)
+	}
+}
+
+func TestSprintNoTrivia(t *testing.T) {
+	ast := tok("IdentifierToken", "a", 0, 2, nil, nodes.Array{
+		nodes.Object{"@type": nodes.String("WhitespaceTrivia")},
+	})
+	if _, err := Sprint(ast); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSprintPositions(t *testing.T) {
+	const src = "a /* b */;"
+	posTok := func(typ, text string, start, end int, trail nodes.Array) nodes.Object {
+		if trail == nil {
+			trail = nodes.Array{}
+		}
+		return nodes.Object{
+			"@type": nodes.String(typ),
+			"@pos": uast.Positions{
+				normalizer.KeyFullStart: {Offset: uint32(start)},
+				normalizer.KeyFullEnd:   {Offset: uint32(end)},
+			}.ToObject(),
+			"Text":           nodes.String(text),
+			"LeadingTrivia":  nodes.Array{},
+			"TrailingTrivia": trail,
+		}
+	}
+	ast := nodes.Object{
+		"@type":          nodes.String("ExpressionStatement"),
+		"SemicolonToken": posTok("SemicolonToken", ";", 9, 10, nil),
+		"Expression": posTok("IdentifierToken", "a", 0, 9, nodes.Array{
+			trivia("WhitespaceTrivia", " "),
+			trivia("MultiLineCommentTrivia", "/* b */"),
+		}),
+	}
+	got, err := Sprint(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != src {
+		t.Errorf("unexpected source: %q", got)
+	}
+}
@@ -0,0 +1,6 @@
+class SyntaxError
+{
+    void Method()
+    {
+        int x = ;
+    }
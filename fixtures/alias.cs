@@ -1 +1,2 @@
 using Foo = Bar;
+using Ints = int[];
@@ -0,0 +1,13 @@
+class Program
+{
+    static void Main(string[] args)
+    {
+        Func<int, Task<int>> fetch = async x => await Compute(x);
+        Action log = delegate { Console.WriteLine("done"); };
+        Func<int, int, int> add = (int a, int b) => a + b;
+
+        T Identity<T>(T value) => value;
+
+        Console.WriteLine(Identity(add(1, 2)));
+    }
+}
@@ -1,6 +1,6 @@
 class Program {
     static void Main(string[] args) {
-        public async Task<string> ExampleMethodAsync()  {} 
+        async Task<string> ExampleMethodAsync()  {} 
         string c = await ExampleMethodAsync();
     }
 }
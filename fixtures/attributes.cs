@@ -0,0 +1,28 @@
+using System;
+
+[assembly: AssemblyTitle("Test")]
+
+namespace Demo
+{
+    // comment before attribute
+    [Serializable, Obsolete("old", true)]
+    public class Controller
+    {
+        [field: NonSerialized]
+        public event EventHandler Changed;
+
+        [Route("api/items", Name = "items")]
+        [HttpGet]
+        [return: MarshalAs(UnmanagedType.Bool)]
+        public bool Get([FromQuery] int id, [System.Runtime.InteropServices.Optional] string name)
+        {
+            return true;
+        }
+
+        [Obsolete(message: "use Get", error: false)]
+        public int Count { get; set; }
+
+        [Flags]
+        enum E { [Description("a")] A = 1 }
+    }
+}
@@ -0,0 +1,6 @@
+﻿// The file starts with a UTF-8 BOM
+using System;
+
+class Bom {
+    string s = "😀";
+}
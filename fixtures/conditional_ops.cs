@@ -5,6 +5,6 @@ class Program {
         a && b;
         a || b;
         x ?? y;
-        a ? b : c;
+        c = a ? b : c;
     }
 }
@@ -0,0 +1,30 @@
+namespace Demo
+{
+    /**
+     * <summary>A service.</summary>
+     * <remarks>See <see cref="Other"/>.</remarks>
+     */
+    public class Service
+    {
+        /// <summary>
+        /// Gets the item with the given <paramref name="id"/>.
+        /// </summary>
+        /// <typeparam name="T">Type of the item.</typeparam>
+        /// <param name="id">Item identifier.</param>
+        /// <returns>The item, or <see langword="null"/>.</returns>
+        /// <exception cref="System.ArgumentException">If <c>id</c> is negative.</exception>
+        /// <seealso cref="Other.Find(int)"/>
+        [Obsolete]
+        public T Get<T>(int id) { return default(T); }
+
+        /// <value>The count.</value>
+        public int Count { get; set; }
+
+        // regular comment
+        /// Not a tag &amp; text
+        int field;
+
+        /// <summary>Broken <b>xml</summary>
+        void Broken() {}
+    }
+}
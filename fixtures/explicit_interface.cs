@@ -0,0 +1,17 @@
+class Resource : IDisposable, IComparable<Resource>, System.IFormattable
+{
+    void IDisposable.Dispose()
+    {
+    }
+
+    int IComparable<Resource>.CompareTo(Resource other) => 0;
+
+    string System.IFormattable.ToString(string format, IFormatProvider provider)
+    {
+        return format;
+    }
+
+    public void Dispose()
+    {
+    }
+}
@@ -4,6 +4,8 @@ class Program {
             break;
             continue;
             goto Finish;
+        }
 Finish:
+        return;
     }
 }
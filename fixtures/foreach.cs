@@ -10,7 +10,7 @@ class Program {
             ++i;
         }
 
-        foreach(ref readonly j in fibNumbers) {
+        foreach(ref readonly int j in fibNumbers) {
             Console.WriteLine(j);
         }
     }
@@ -0,0 +1,34 @@
+#nullable enable
+using System;
+
+class Base
+{
+    public virtual void M<T>(T? value) where T : struct { }
+    public virtual void N<T>(T? value) { }
+}
+
+class Derived : Base
+{
+    public override void N<T>(T? value) where T : default { }
+}
+
+class Cache<TKey, TValue>
+    where TKey : class?
+    where TValue : class, new()
+{
+    public void Put<T>(T item) where T : class?, IDisposable { }
+}
+
+ref struct Span<T> where T : allows ref struct
+{
+}
+
+class Both<T> where T : IDisposable, allows ref struct
+{
+}
+
+// not declared as type parameters: rejected by the compiler, but accepted by the parser
+class Undeclared where T : class
+{
+    void M<T>() where T : new() where U : struct { }
+}
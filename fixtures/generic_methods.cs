@@ -0,0 +1,22 @@
+interface IConverter<in TInput, out TOutput>
+{
+    TOutput Convert(TInput input);
+}
+
+class Factory
+{
+    public T Create<T>() where T : class, new()
+    {
+        return new T();
+    }
+
+    public void Copy<TSource, TTarget>(TSource source, TTarget target)
+        where TSource : struct
+        where TTarget : IList<TSource>
+    {
+    }
+
+    public unsafe void Fill<T>(T* ptr) where T : unmanaged
+    {
+    }
+}
@@ -0,0 +1,20 @@
+interface IStore
+{
+    string this[string key] { get; set; }
+}
+
+class Store : IStore
+{
+    private Dictionary<string, string> items = new Dictionary<string, string>();
+
+    public string this[string key]
+    {
+        get
+        {
+            return items[key];
+        }
+        set => items[key] = value;
+    }
+
+    public int this[int x, int y] => x * y;
+}
@@ -0,0 +1,19 @@
+class Config
+{
+    private int port;
+
+    public string Name { get; init; }
+
+    public int Port
+    {
+        get => port;
+        init => port = value;
+    }
+
+    public string Host
+    {
+        get { return host; }
+        private init { host = value; }
+    }
+    private string host;
+}
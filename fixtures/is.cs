@@ -1,9 +1,9 @@
 class C1 {}
 class C2: C1 {}
 
-const TEST = 100;
-
 class Program {
+    const int TEST = 100;
+
     static void Main(string[] args) {
         C2 c2 = new C2();
         c2 is C1;
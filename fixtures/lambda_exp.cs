@@ -1,4 +1,5 @@
 class Program {
     static void Main(string[] args) {
         x =>  x + x;
+    }
 }
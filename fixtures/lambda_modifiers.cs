@@ -0,0 +1,14 @@
+using System;
+using System.Threading.Tasks;
+
+class Lambdas
+{
+    static void Main()
+    {
+        Func<int, int> square = static x => x * x;
+        Func<int, Task<int>> load = async static x => await Task.FromResult(x);
+        Func<int, int> id = [A] (x) => x;
+        Func<int, Task<int>> next = async x => x + 1;
+        Func<int, int> neg = static delegate (int x) { return -x; };
+    }
+}
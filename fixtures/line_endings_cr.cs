@@ -0,0 +1 @@
+// Lines end with a lone CRclass Cr {    // comment 😀    string s = "a";    int Method(int x) {        return x; /* block        comment */    }}
\ No newline at end of file
@@ -0,0 +1,12 @@
+/// <summary>
+/// Lines end with CRLF 😀
+/// </summary>
+class CrLf {
+    // comment
+    string s = "a";
+
+    int Method(int x) {
+        return x; /* block
+        comment */
+    }
+}
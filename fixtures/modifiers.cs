@@ -1,3 +1,5 @@
+extern alias Foo2;
+
 abstract class Foo
 {
     abstract public int area();
@@ -15,11 +17,13 @@ class ReadOnly
     ReadOnly(int year) { this.year = year; }
 }
 
-[DllImport("avifil32.dll")]
-static extern void AVIFileInit();
-extern alias Foo2;
+unsafe struct Native
+{
+    [DllImport("avifil32.dll")]
+    static extern void AVIFileInit();
 
-private fixed char name[30];
+    private fixed char name[30];
+}
 
 class Program {
     volatile int vol;
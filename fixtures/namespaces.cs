@@ -0,0 +1,28 @@
+// Namespaces can be nested, and may use a qualified name
+namespace Outer.Middle
+{
+    using System;
+
+    // Inner namespace
+    namespace Inner
+    {
+        class A
+        {
+        }
+
+        namespace Deep.Deeper
+        {
+            struct B
+            {
+            }
+        }
+    }
+
+    interface I
+    {
+    }
+}
+
+namespace Other
+{
+}
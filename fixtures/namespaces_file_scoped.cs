@@ -0,0 +1,21 @@
+// File-scoped namespace contains all members of the file
+namespace Outer.Middle;
+
+using System;
+
+class A
+{
+    class Nested
+    {
+    }
+}
+
+// Members after the comment are in the same namespace
+interface I
+{
+}
+
+enum E
+{
+    X,
+}
@@ -1,8 +1,8 @@
 class Program {
     static void Main(string[] args) {
         StudentName student = new StudentName {
-            FirtName = "John";
-            LastName = "Doe";
+            FirtName = "John",
+            LastName = "Doe",
         };
     }
 }
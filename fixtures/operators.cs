@@ -0,0 +1,21 @@
+struct Vector
+{
+    public static Vector operator +(Vector a, Vector b)
+    {
+        return new Vector(a.X + b.X, a.Y + b.Y);
+    }
+
+    public static Vector operator -(Vector a) => new Vector(-a.X, -a.Y);
+
+    public static bool operator ==(Vector a, Vector b) => a.Equals(b);
+
+    public static bool operator !=(Vector a, Vector b) => !a.Equals(b);
+
+    public static bool operator true(Vector a) => a.X != 0;
+
+    public static bool operator false(Vector a) => a.X == 0;
+
+    public static implicit operator Vector(int x) => new Vector(x, x);
+
+    public static explicit operator int(Vector v) => v.X;
+}
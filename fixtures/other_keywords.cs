@@ -8,7 +8,7 @@ class Program {
         int x = 1;
         var xref = __makeref(x);
         __reftype(xref);
-        __refvalue(xref);
+        __refvalue(xref, int);
         TakeVariableLengthArgs(__arglist(new StringBuilder(), 12));
     }
 }
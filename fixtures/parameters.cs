@@ -0,0 +1,28 @@
+static class Parameters
+{
+    static bool TryParse(string s, out int value)
+    {
+        value = 0;
+        return true;
+    }
+
+    static void Swap<T>(ref T a, ref T b)
+    {
+    }
+
+    static double Length(in Vector v) => v.X;
+
+    static int Count(this IEnumerable<int> items, int start = 0) => start;
+
+    static void Log(string message, [CallerMemberName] string caller = "", params object[] args)
+    {
+    }
+
+    static void Update(this ref Vector v, string? name = null)
+    {
+    }
+
+    static void Scoped(scoped ref Vector v, ref readonly Vector w)
+    {
+    }
+}